@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// agentUsage is the usage message of the agent command
+const agentUsage = "usage: sm-ssh-add agent [--socket <path>] [--ttl <duration>] " + autoLockUsage + " [<path>...]"
+
+// defaultAgentKeyTTL is how long the agent keeps a fetched private key in memory
+const defaultAgentKeyTTL = 5 * time.Minute
+
+// agentOptions holds the parsed arguments of the agent command
+type agentOptions struct {
+	paths      []string
+	socketPath string
+	autoLock   autoLockOptions
+	ttl        time.Duration
+}
+
+// parseAgentArgs parses command line arguments of the agent command.
+// Without paths, the agent serves all configured paths.
+func parseAgentArgs(args []string, cfg *config.Config) (*agentOptions, error) {
+	opts := &agentOptions{
+		ttl: defaultAgentKeyTTL,
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) == 0 || arg[0] != '-' {
+			opts.paths = append(opts.paths, arg)
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--socket"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, agentUsage)
+			}
+			opts.socketPath = value
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--ttl"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, agentUsage)
+			}
+			ttl, err := time.ParseDuration(value)
+			if err != nil || ttl < 0 {
+				return nil, fmt.Errorf("invalid --ttl %q: must be a duration such as 10m (0 disables caching)", value)
+			}
+			opts.ttl = ttl
+			continue
+		}
+
+		if ok, err := opts.autoLock.parseFlag(args, &i); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, agentUsage)
+			}
+			continue
+		}
+
+		return nil, fmt.Errorf("unknown flag: %s", arg)
+	}
+
+	if len(opts.paths) == 0 {
+		opts.paths = cfg.GetPaths()
+		if len(opts.paths) == 0 {
+			return nil, fmt.Errorf("no paths configured")
+		}
+	}
+
+	return opts, nil
+}
+
+// promptKeyPassphrase asks for the passphrase of an encrypted key
+func promptKeyPassphrase(path string) ([]byte, error) {
+	return readSecret(fmt.Sprintf("Enter passphrase for key %s: ", path))
+}
+
+// ServeAgent runs an ssh-agent that serves keys from the secret manager. Public keys are
+// advertised up front and private keys are only fetched when a signature is requested.
+func ServeAgent(provider sm.Provider, cfg *config.Config, args []string) error {
+	opts, err := parseAgentArgs(args, cfg)
+	if err != nil {
+		return err
+	}
+
+	passphrase := func(path string, keyValue *sm.KeyValue) ([]byte, error) {
+		return keyPassphrase(provider, cfg, path, keyValue)
+	}
+	store, err := ssh.NewKeyStore(provider, opts.paths, opts.ttl, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if opts.socketPath == "" {
+		socketPath, cleanup, err := ssh.DefaultSocketPath("sm-ssh-add")
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		opts.socketPath = socketPath
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := startAutoLock(ctx, store, opts.autoLock); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", opts.socketPath)
+	fmt.Fprintf(os.Stderr, "Serving %d keys on %s (private keys cached for %s)\n", len(opts.paths), opts.socketPath, opts.ttl)
+
+	return ssh.ListenAndServe(ctx, opts.socketPath, store)
+}
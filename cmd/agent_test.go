@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+// TestParseAgentArgs tests defaults and flags of the agent command
+func TestParseAgentArgs(t *testing.T) {
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+		VaultPaths:      []string{"secret/ssh/a", "secret/ssh/b"},
+	}
+
+	opts, err := parseAgentArgs(nil, cfg)
+	if err != nil {
+		t.Fatalf("parseAgentArgs() error = %v", err)
+	}
+	if !slices.Equal(opts.paths, cfg.VaultPaths) {
+		t.Errorf("paths = %v, want configured paths", opts.paths)
+	}
+	if opts.ttl != defaultAgentKeyTTL {
+		t.Errorf("ttl = %s, want %s", opts.ttl, defaultAgentKeyTTL)
+	}
+	if opts.socketPath != "" {
+		t.Errorf("socketPath = %q, want it left to DefaultSocketPath", opts.socketPath)
+	}
+
+	opts, err = parseAgentArgs([]string{"--socket", "/tmp/test.sock", "--ttl=30s", "--lock-after", "15m", "--lock-on-screen-lock", "secret/ssh/c"}, cfg)
+	if err != nil {
+		t.Fatalf("parseAgentArgs() error = %v", err)
+	}
+	if opts.socketPath != "/tmp/test.sock" {
+		t.Errorf("socketPath = %q, want /tmp/test.sock", opts.socketPath)
+	}
+	if opts.ttl != 30*time.Second {
+		t.Errorf("ttl = %s, want 30s", opts.ttl)
+	}
+	if opts.autoLock != (autoLockOptions{lockAfter: 15 * time.Minute, onScreenLock: true}) {
+		t.Errorf("autoLock = %+v, want 15m and on screen lock", opts.autoLock)
+	}
+	if !slices.Equal(opts.paths, []string{"secret/ssh/c"}) {
+		t.Errorf("paths = %v, want [secret/ssh/c]", opts.paths)
+	}
+}
+
+// TestParseAgentArgs_Errors tests invalid agent arguments
+func TestParseAgentArgs_Errors(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no paths configured", args: nil},
+		{name: "invalid ttl", args: []string{"--ttl", "soon", "secret/ssh/a"}},
+		{name: "negative ttl", args: []string{"--ttl=-1m", "secret/ssh/a"}},
+		{name: "missing socket value", args: []string{"secret/ssh/a", "--socket"}},
+		{name: "unknown flag", args: []string{"--unknown", "secret/ssh/a"}},
+		{name: "invalid lock-after", args: []string{"--lock-after", "0", "secret/ssh/a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseAgentArgs(tt.args, cfg); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flagValue returns the value of a "--name value" or "--name=value" flag at args[*i],
+// advancing i past a separate value. ok is false if args[*i] is not the named flag.
+func flagValue(args []string, i *int, name string) (value string, ok bool, err error) {
+	arg := args[*i]
+	if strings.HasPrefix(arg, name+"=") {
+		return strings.TrimPrefix(arg, name+"="), true, nil
+	}
+	if arg != name {
+		return "", false, nil
+	}
+	if *i+1 >= len(args) {
+		return "", true, fmt.Errorf("%s requires a value", name)
+	}
+	*i++
+	return args[*i], true, nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+// configUsage is the usage message of the config command
+const configUsage = `usage: sm-ssh-add config <command>
+  add-path <path>...     add paths loaded by load --from-config
+  remove-path <path>...  remove paths and their key options
+  set <key> <value>      change a setting, an empty value resets it
+  get <key>              print a setting
+  show                   print the config file
+  validate               check the config file`
+
+// Config shows, checks and edits the config file. Writes re-read the file under a lock, so
+// concurrent invocations don't undo each other's changes.
+func Config(args []string) error {
+	return configCommand(args, os.Stdout)
+}
+
+// configCommand implements Config, writing to out
+func configCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", configUsage)
+	}
+	command, args := args[0], args[1:]
+
+	// wantArgs checks the number of arguments of the subcommand, n < 0 meaning at least one
+	wantArgs := func(n int) error {
+		if (n < 0 && len(args) == 0) || (n >= 0 && len(args) != n) {
+			return fmt.Errorf("wrong number of arguments for config %s\n%s", command, configUsage)
+		}
+		return nil
+	}
+
+	switch command {
+	case "add-path":
+		if err := wantArgs(-1); err != nil {
+			return err
+		}
+		cfg, err := config.Read()
+		if err != nil {
+			return err
+		}
+		for _, path := range args {
+			if err := cfg.AddPath(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "remove-path":
+		if err := wantArgs(-1); err != nil {
+			return err
+		}
+		cfg, err := config.Read()
+		if err != nil {
+			return err
+		}
+		for _, path := range args {
+			if err := cfg.RemovePath(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "set":
+		if err := wantArgs(2); err != nil {
+			return err
+		}
+		return config.SaveSetting(args[0], args[1])
+	case "get":
+		if err := wantArgs(1); err != nil {
+			return err
+		}
+		cfg, err := config.Read()
+		if err != nil {
+			return err
+		}
+		value, err := cfg.Get(args[0])
+		if err != nil {
+			return fmt.Errorf("%w, use one of:\n  %s", err, strings.Join(config.SettingKeys(), "\n  "))
+		}
+		fmt.Fprintln(out, value)
+		return nil
+	case "show":
+		if err := wantArgs(0); err != nil {
+			return err
+		}
+		cfg, err := config.Read()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cfg)
+	case "validate":
+		if err := wantArgs(0); err != nil {
+			return err
+		}
+		configPath, err := config.Path()
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Read()
+		if err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s is valid\n", configPath)
+		return nil
+	default:
+		return fmt.Errorf("unknown config command: %s\n%s", command, configUsage)
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+func TestConfigCommand(t *testing.T) {
+	writeTestConfig(t, `{"default_provider": "vault", "vault_paths": ["secret/data/ssh/a"]}`)
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := configCommand(args, &out)
+		return out.String(), err
+	}
+
+	for _, args := range [][]string{
+		{"add-path", "secret/data/ssh/b", "secret/data/ssh/c"},
+		{"remove-path", "secret/data/ssh/a"},
+		{"set", "max_key_age", "60d"},
+		{"set", "key_options.secret/data/ssh/b.confirm", "true"},
+	} {
+		if _, err := run(args...); err != nil {
+			t.Fatalf("config %v failed: %v", args, err)
+		}
+	}
+
+	if out, err := run("get", "max_key_age"); err != nil || out != "60d\n" {
+		t.Errorf("config get = %q, %v, want 60d", out, err)
+	}
+
+	out, err := run("show")
+	if err != nil {
+		t.Fatalf("config show failed: %v", err)
+	}
+	var cfg config.Config
+	if err := json.Unmarshal([]byte(out), &cfg); err != nil {
+		t.Fatalf("config show printed invalid JSON: %v", err)
+	}
+	if !slices.Equal(cfg.VaultPaths, []string{"secret/data/ssh/b", "secret/data/ssh/c"}) || !cfg.KeyOptions["secret/data/ssh/b"].Confirm {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	if out, err := run("validate"); err != nil || !strings.HasSuffix(out, " is valid\n") {
+		t.Errorf("config validate = %q, %v", out, err)
+	}
+
+	// Invalid values are rejected and not written
+	if _, err := run("set", "rotation_grace", "a while"); err == nil {
+		t.Error("expected error for invalid rotation_grace, got nil")
+	}
+	if out, _ := run("get", "rotation_grace"); out != "\n" {
+		t.Errorf("rotation_grace = %q, want it unset", out)
+	}
+
+	if _, err := run("get", "vault_paths"); err == nil || !strings.Contains(err.Error(), "vault_address") {
+		t.Errorf("config get = %v, want an error listing the settings", err)
+	}
+	for _, args := range [][]string{{}, {"set", "max_key_age"}, {"show", "extra"}, {"remove-path", "secret/data/ssh/missing"}, {"edit"}} {
+		if _, err := run(args...); err == nil {
+			t.Errorf("config %v expected error, got nil", args)
+		}
+	}
+}
+
+func TestConfigValidateReportsInvalidSettings(t *testing.T) {
+	writeTestConfig(t, `{"default_provider": "vault", "max_key_age": "often"}`)
+	if err := configCommand([]string{"validate"}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "max_key_age") {
+		t.Errorf("config validate = %v, want an error about max_key_age", err)
+	}
+
+	// A broken setting can be fixed with set
+	if err := configCommand([]string{"set", "max_key_age", "90d"}, &bytes.Buffer{}); err != nil {
+		t.Errorf("config set failed: %v", err)
+	}
+	if err := configCommand([]string{"validate"}, &bytes.Buffer{}); err != nil {
+		t.Errorf("config validate = %v after fixing max_key_age", err)
+	}
+}
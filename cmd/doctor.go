@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/prompt"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// doctorUsage is the usage message of the doctor command
+const doctorUsage = "usage: sm-ssh-add doctor"
+
+// doctorReport prints the result of each doctor check with a fix for failures
+type doctorReport struct {
+	out    io.Writer
+	failed int
+	warned int
+}
+
+func (r *doctorReport) ok(check, detail string) {
+	fmt.Fprintf(r.out, "[ok]    %s: %s\n", check, detail)
+}
+
+func (r *doctorReport) warn(check, detail, fix string) {
+	r.warned++
+	fmt.Fprintf(r.out, "[warn]  %s: %s\n        fix: %s\n", check, detail, fix)
+}
+
+func (r *doctorReport) fail(check string, err error, fix string) {
+	r.failed++
+	fmt.Fprintf(r.out, "[FAIL]  %s: %v\n        fix: %s\n", check, err, fix)
+}
+
+// checkConfig reads and validates the config file. It returns nil if the file cannot be used.
+func (r *doctorReport) checkConfig() *config.Config {
+	path, err := config.Path()
+	if err != nil {
+		r.fail("config", err, "set HOME to your home directory")
+		return nil
+	}
+
+	cfg, err := config.Read()
+	switch {
+	case errors.Is(err, config.ErrConfigFileNotFound):
+		r.fail("config", fmt.Errorf("%s does not exist", path), "run sm-ssh-add init to create it")
+		return nil
+	case errors.Is(err, config.ErrEmptyProvider), errors.Is(err, config.ErrInvalidProvider):
+		r.fail("config", err, fmt.Sprintf(`set "default_provider": "vault" in %s`, path))
+		return nil
+	case err != nil:
+		r.fail("config", err, fmt.Sprintf("fix the JSON syntax of %s, e.g. check for trailing commas", path))
+		return nil
+	}
+	prompt.Pinentry = cfg.Pinentry
+	if cfg.DefaultProvider == "" && len(cfg.Profiles) > 0 {
+		r.fail("config", config.ErrNoProfile, fmt.Sprintf("run sm-ssh-add --profile <name> doctor, profiles: %s",
+			strings.Join(cfg.ProfileNames(), ", ")))
+		return nil
+	}
+
+	valid := true
+	if _, err := cfg.GetRotationGrace(); err != nil {
+		valid = false
+		r.fail("config", err, `use a duration such as "7d" or "36h"`)
+	}
+	if _, err := cfg.GetMaxKeyAge(); err != nil {
+		valid = false
+		r.fail("config", err, `use a duration such as "90d"`)
+	}
+	if !valid {
+		return cfg
+	}
+
+	if config.HasSystemConfig() {
+		path += " merged over " + config.SystemPath
+	}
+	if cfg.GetProfile() != "" {
+		path += ", profile " + cfg.GetProfile()
+	}
+	if len(cfg.GetPaths()) == 0 {
+		r.warn("config", fmt.Sprintf("%s has no paths", path),
+			"add paths with sm-ssh-add config add-path or generate a key with --save-path")
+		return cfg
+	}
+	r.ok("config", fmt.Sprintf("%s, %d paths", path, len(cfg.GetPaths())))
+	return cfg
+}
+
+// checkVault checks that Vault is reachable, the credentials are valid and every configured
+// path is a readable KV v2 secret
+func (r *doctorReport) checkVault(cfg *config.Config) {
+	// A typed nil *config.Config would not be a nil VaultConfig
+	var vaultConfig sm.VaultConfig
+	var vaultPaths []string
+	if cfg != nil {
+		vaultConfig = cfg
+		for _, path := range cfg.GetPaths() {
+			provider, vaultPath := config.ParsePath(path)
+			if provider == "" {
+				provider = cfg.DefaultProvider
+			}
+			if provider != config.ProviderVault {
+				r.warn(path, "not checked, doctor only checks Vault paths", "check the key with sm-ssh-add verify "+path)
+				continue
+			}
+			vaultPaths = append(vaultPaths, vaultPath)
+		}
+		// Without Vault paths there is no Vault to check, unless Vault is the only provider
+		if len(vaultPaths) == 0 && cfg.DefaultProvider != config.ProviderVault {
+			return
+		}
+	}
+
+	diagnostics, err := sm.NewVaultDiagnostics(sm.VaultAddress(vaultConfig))
+	if err != nil {
+		r.fail("vault", err, `export VAULT_ADDR=https://vault.example.com:8200 or set "vault_address" in the config`)
+		return
+	}
+
+	version, err := diagnostics.Health()
+	switch {
+	case errors.Is(err, sm.ErrVaultSealed):
+		r.fail("vault", err, "ask your Vault operator to initialize or unseal it (vault operator unseal)")
+		return
+	case err != nil:
+		r.fail("vault", err, fmt.Sprintf("check that %s is the right address, including scheme and port, "+
+			"and that it is reachable; for TLS errors set VAULT_CACERT", diagnostics.Address()))
+		return
+	}
+	r.ok("vault", fmt.Sprintf("%s is reachable, version %s", diagnostics.Address(), version))
+
+	fix := "run vault login and export VAULT_TOKEN"
+	if cfg != nil {
+		if cfg.GetVaultApproleRoleID() != "" {
+			fix = "generate a new secret ID (vault write -f auth/approle/role/<role>/secret-id) and check vault_approle_role_id"
+		}
+	}
+	ttl, err := diagnostics.Login(vaultConfig)
+	switch {
+	case err != nil:
+		r.fail("vault token", err, fix)
+		return
+	case ttl == 0:
+		r.ok("vault token", "valid, does not expire")
+	case ttl < time.Hour:
+		r.warn("vault token", fmt.Sprintf("valid, expires in %s", ttl.Round(time.Second)), "renew it with vault token renew, or "+fix)
+	default:
+		r.ok("vault token", fmt.Sprintf("valid, expires in %s", ttl.Round(time.Minute)))
+	}
+
+	for _, path := range vaultPaths {
+		r.checkVaultPath(diagnostics, path)
+	}
+}
+
+// vaultPathProblem checks that path is in a KV v2 mount and readable with the current token. For
+// a problem it returns the error and a fix, otherwise the mount.
+func vaultPathProblem(diagnostics *sm.VaultDiagnostics, path string) (*sm.VaultMount, string, error) {
+	mount, err := diagnostics.Mount(path)
+	if err != nil {
+		return nil, "check the mount exists (vault secrets list) and that your policy grants access to the path", err
+	}
+	switch {
+	case mount.Type != "kv" && mount.Type != "generic":
+		return nil, "store keys in a KV v2 mount: vault secrets enable -version=2 -path=<mount> kv",
+			fmt.Errorf("%s is a %s secrets engine, not key/value", mount.Path, mount.Type)
+	case mount.Version != 2:
+		return nil, fmt.Sprintf("upgrade the mount: vault kv enable-versioning %s", mount.Path),
+			fmt.Errorf("%s is a KV v%d mount, sm-ssh-add needs KV v2", mount.Path, mount.Version)
+	}
+	if dataPath, ok := sm.KVv2DataPath(mount.Path, path); !ok {
+		return nil, fmt.Sprintf("use %s instead", dataPath), fmt.Errorf("KV v2 paths need the data/ segment after the mount")
+	}
+
+	readable, err := diagnostics.CanRead(path)
+	switch {
+	case err != nil:
+		return nil, "check that your policy grants access to the path", err
+	case !readable:
+		return nil, fmt.Sprintf(`add to your policy: path "%s" { capabilities = ["read"] }`, path),
+			fmt.Errorf("token cannot read this path")
+	}
+	return mount, "", nil
+}
+
+// checkVaultPath checks that path is in a KV v2 mount and readable with the current token
+func (r *doctorReport) checkVaultPath(diagnostics *sm.VaultDiagnostics, path string) {
+	mount, fix, err := vaultPathProblem(diagnostics, path)
+	if err != nil {
+		r.fail(path, err, fix)
+		return
+	}
+	r.ok(path, fmt.Sprintf("readable in KV v2 mount %s", mount.Path))
+}
+
+// checkAgent checks that SSH_AUTH_SOCK points at a running ssh-agent
+func (r *doctorReport) checkAgent(cfg *config.Config) {
+	const fix = `start an agent with eval "$(ssh-agent)" or point SSH_AUTH_SOCK at a running one`
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		r.fail("ssh-agent", fmt.Errorf("SSH_AUTH_SOCK is not set"), fix)
+		return
+	}
+	if _, err := os.Stat(socket); err != nil {
+		r.fail("ssh-agent", fmt.Errorf("SSH_AUTH_SOCK is stale: %w", err), fix)
+		return
+	}
+
+	agent, err := ssh.NewAgent(cfg)
+	if err != nil {
+		r.fail("ssh-agent", err, fix)
+		return
+	}
+	defer agent.Close()
+
+	keys, err := agent.Keys()
+	if err != nil {
+		r.fail("ssh-agent", err, "restart the agent; if it is locked, run sm-ssh-add unlock")
+		return
+	}
+	r.ok("ssh-agent", fmt.Sprintf("%s, %d keys loaded", socket, len(keys)))
+}
+
+// Doctor checks the configuration, the Vault connection and ssh-agent, and prints a fix for every
+// problem. It reads the config itself so it also works when the config is broken.
+func Doctor(args []string) error {
+	return doctor(args, os.Stdout)
+}
+
+// doctor implements Doctor, writing the report to out
+func doctor(args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unknown argument: %s\n%s", args[0], doctorUsage)
+	}
+
+	r := &doctorReport{out: out}
+	cfg := r.checkConfig()
+	r.checkVault(cfg)
+	r.checkAgent(cfg)
+
+	fmt.Fprintf(out, "%d problems, %d warnings\n", r.failed, r.warned)
+	if r.failed > 0 {
+		return fmt.Errorf("%d problems found", r.failed)
+	}
+	return nil
+}
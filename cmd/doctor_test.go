@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveFakeVault serves the endpoints used by doctor. mounts maps mount paths to their KV version
+// and readable lists the paths the token may read.
+func serveFakeVault(t *testing.T, mounts map[string]string, readable []string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]interface{}
+		switch {
+		case r.URL.Path == "/v1/sys/health":
+			json.NewEncoder(w).Encode(map[string]interface{}{"initialized": true, "sealed": false, "version": "1.20.0"})
+			return
+		case r.URL.Path == "/v1/auth/token/lookup-self":
+			if r.Header.Get("X-Vault-Token") != "test-token" {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+				return
+			}
+			data = map[string]interface{}{"ttl": 0}
+		case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/"):
+			path := strings.TrimPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/")
+			mount, _, _ := strings.Cut(path, "/")
+			version, ok := mounts[mount+"/"]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+				return
+			}
+			data = map[string]interface{}{"path": mount + "/", "type": "kv", "options": map[string]interface{}{"version": version}}
+		case r.URL.Path == "/v1/sys/capabilities-self":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			capabilities := []string{"deny"}
+			for _, path := range readable {
+				if path == body["path"] {
+					capabilities = []string{"read"}
+				}
+			}
+			data = map[string]interface{}{"capabilities": capabilities, body["path"]: capabilities}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("BAO_ADDR", "")
+	t.Setenv("BAO_TOKEN", "")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+}
+
+// writeTestConfig writes the config file to a temporary home directory
+func writeTestConfig(t *testing.T, content string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".config"), 0700); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".config", "sm-ssh-add.json"), []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func TestDoctorReportsFixes(t *testing.T) {
+	serveTestAgent(t)
+	serveFakeVault(t, map[string]string{"secret/": "2", "kv/": "1"}, []string{"secret/data/ssh/ok"})
+	writeTestConfig(t, `{"default_provider": "vault", "vault_paths": [
+		"secret/data/ssh/ok", "secret/data/ssh/denied", "secret/ssh/nodata", "kv/ssh/v1", "missing/ssh/a"]}`)
+
+	var out bytes.Buffer
+	err := doctor(nil, &out)
+	if err == nil || err.Error() != "4 problems found" {
+		t.Errorf("doctor = %v, want 4 problems", err)
+	}
+
+	report := out.String()
+	for _, want := range []string{
+		"[ok]    config:",
+		"[ok]    vault: " + os.Getenv("VAULT_ADDR") + " is reachable, version 1.20.0",
+		"[ok]    vault token: valid, does not expire",
+		"[ok]    secret/data/ssh/ok: readable in KV v2 mount secret/",
+		`fix: add to your policy: path "secret/data/ssh/denied" { capabilities = ["read"] }`,
+		"fix: use secret/data/ssh/nodata instead",
+		"fix: upgrade the mount: vault kv enable-versioning kv/",
+		"[FAIL]  missing/ssh/a:",
+		"[ok]    ssh-agent:",
+		"4 problems, 0 warnings",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestDoctorSkipsVaultForAWSPaths(t *testing.T) {
+	serveTestAgent(t)
+	t.Setenv("VAULT_ADDR", "http://127.0.0.1:1")
+	writeTestConfig(t, `{"default_provider": "aws", "aws_region": "eu-west-1", "aws_paths": ["prod/ssh/a"]}`)
+
+	var out bytes.Buffer
+	if err := doctor(nil, &out); err != nil {
+		t.Errorf("doctor = %v, want no problems\n%s", err, out.String())
+	}
+	if report := out.String(); strings.Contains(report, "vault") || !strings.Contains(report, "prod/ssh/a: not checked") {
+		t.Errorf("report checked Vault or missed the AWS path:\n%s", report)
+	}
+}
+
+func TestDoctorWithBrokenEnvironment(t *testing.T) {
+	serveFakeVault(t, nil, nil)
+	t.Setenv("VAULT_TOKEN", "expired")
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "gone.sock"))
+	writeTestConfig(t, `{"default_provider": "vault", "vault_paths": ["secret/data/ssh/a"],}`)
+
+	var out bytes.Buffer
+	if err := doctor(nil, &out); err == nil {
+		t.Error("expected error, got nil")
+	}
+
+	report := out.String()
+	for _, want := range []string{
+		"[FAIL]  config: failed to parse config file (invalid JSON)",
+		"[FAIL]  vault token:",
+		"fix: run vault login and export VAULT_TOKEN",
+		"[FAIL]  ssh-agent: SSH_AUTH_SOCK is stale",
+		"3 problems, 0 warnings",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+
+	if err := doctor([]string{"--fix"}, &out); err == nil {
+		t.Error("expected error for unknown argument, got nil")
+	}
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// exportUsage is the usage message of the export command
+const exportUsage = "usage: sm-ssh-add export [--format openssh|pem|pkcs8|ppk] [--require-passphrase] (--out <file> | --to-stdout) <path>"
+
+// exportOptions holds the parsed arguments of the export command
+type exportOptions struct {
+	path              string
+	format            string
+	outFile           string
+	toStdout          bool
+	requirePassphrase bool
+}
+
+// parseExportArgs parses command line arguments of the export command
+func parseExportArgs(args []string) (*exportOptions, error) {
+	opts := &exportOptions{format: ssh.FormatOpenSSH}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) == 0 || arg[0] != '-' {
+			if opts.path != "" {
+				return nil, fmt.Errorf("too many arguments\n%s", exportUsage)
+			}
+			opts.path = arg
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--out"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, exportUsage)
+			}
+			opts.outFile = value
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--format"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, exportUsage)
+			}
+			switch value {
+			case ssh.FormatOpenSSH, ssh.FormatPEM, ssh.FormatPKCS8, ssh.FormatPPK:
+				opts.format = value
+			default:
+				return nil, fmt.Errorf("invalid --format %q: must be openssh, pem, pkcs8 or ppk", value)
+			}
+			continue
+		}
+
+		switch arg {
+		case "--to-stdout":
+			opts.toStdout = true
+		case "--require-passphrase":
+			opts.requirePassphrase = true
+		default:
+			return nil, fmt.Errorf("unknown flag: %s", arg)
+		}
+	}
+
+	if opts.path == "" {
+		return nil, fmt.Errorf("path is required\n%s", exportUsage)
+	}
+	if opts.outFile == "" && !opts.toStdout {
+		return nil, fmt.Errorf("either --out or --to-stdout is required\n%s", exportUsage)
+	}
+	if opts.outFile != "" && opts.toStdout {
+		return nil, fmt.Errorf("cannot use both --out and --to-stdout")
+	}
+	if opts.requirePassphrase && opts.format != ssh.FormatOpenSSH && opts.format != ssh.FormatPPK {
+		return nil, fmt.Errorf("--require-passphrase is only supported with the openssh and ppk formats")
+	}
+
+	return opts, nil
+}
+
+// writeKeyFile writes a private key to a file readable only by the owner
+func writeKeyFile(file string, data []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// Tighten permissions of an existing file, which OpenFile keeps
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Export writes a private key from the secret manager to a file or stdout, decrypted or
+// encrypted with a new passphrase, for tools that need a key file
+func Export(provider sm.Provider, cfg *config.Config, args []string) error {
+	return export(provider, cfg, args, os.Stdout)
+}
+
+// export implements Export, writing to out for --to-stdout
+func export(provider sm.Provider, cfg *config.Config, args []string, out io.Writer) error {
+	opts, err := parseExportArgs(args)
+	if err != nil {
+		return err
+	}
+
+	keyValue, err := provider.Get(opts.path)
+	if err != nil {
+		return fmt.Errorf("failed to read key from %s: %w", opts.path, err)
+	}
+	defer clear(keyValue.PrivateKey)
+
+	keyPair := &ssh.KeyPair{
+		PrivateKey: keyValue.PrivateKey,
+		PublicKey:  keyValue.PublicKey,
+		Comment:    keyValue.Comment,
+	}
+
+	if keyValue.RequirePassphrase {
+		passphrase, err := keyPassphrase(provider, cfg, opts.path, keyValue)
+		if err != nil {
+			return fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		p := string(passphrase)
+		keyPair.Passphrase = &p
+	}
+
+	var newPassphrase []byte
+	if opts.requirePassphrase {
+		newPassphrase, err = readPassphrase(cfg.PassphrasePolicy, false)
+		if err != nil {
+			return fmt.Errorf("failed to read passphrase: %w", err)
+		}
+	}
+
+	data, err := ssh.ExportKeyPair(keyPair, opts.format, newPassphrase)
+	if err != nil {
+		return err
+	}
+	defer clear(data)
+
+	if opts.toStdout {
+		_, err := out.Write(data)
+		return err
+	}
+
+	if err := writeKeyFile(opts.outFile, data); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Key from %s exported to %s\n", opts.path, opts.outFile)
+	return nil
+}
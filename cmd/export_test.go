@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+func TestParseExportArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		expectError bool
+		want        exportOptions
+	}{
+		{
+			name: "out file with default format",
+			args: []string{"--out", "id_ci", "secret/ssh/ci"},
+			want: exportOptions{path: "secret/ssh/ci", format: "openssh", outFile: "id_ci"},
+		},
+		{
+			name: "stdout with format",
+			args: []string{"secret/ssh/ci", "--to-stdout", "--format=pkcs8"},
+			want: exportOptions{path: "secret/ssh/ci", format: "pkcs8", toStdout: true},
+		},
+		{
+			name: "encrypted ppk",
+			args: []string{"--format", "ppk", "--require-passphrase", "--out", "key.ppk", "secret/ssh/ci"},
+			want: exportOptions{path: "secret/ssh/ci", format: "ppk", outFile: "key.ppk", requirePassphrase: true},
+		},
+		{name: "no destination", args: []string{"secret/ssh/ci"}, expectError: true},
+		{name: "both destinations", args: []string{"--out", "id_ci", "--to-stdout", "secret/ssh/ci"}, expectError: true},
+		{name: "missing path", args: []string{"--to-stdout"}, expectError: true},
+		{name: "too many arguments", args: []string{"--to-stdout", "secret/ssh/a", "secret/ssh/b"}, expectError: true},
+		{name: "unknown format", args: []string{"--to-stdout", "--format", "der", "secret/ssh/ci"}, expectError: true},
+		{name: "encrypted pem", args: []string{"--to-stdout", "--format", "pem", "--require-passphrase", "secret/ssh/ci"}, expectError: true},
+		{name: "unknown flag", args: []string{"--to-stdout", "--force", "secret/ssh/ci"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseExportArgs(tt.args)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *opts != tt.want {
+				t.Errorf("options = %+v, want %+v", *opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportToFile(t *testing.T) {
+	provider := newMemoryProvider()
+	keyPair := provider.addGeneratedKey(t, "secret/ssh/ci", "ci@example.com")
+
+	// An existing file with loose permissions is tightened
+	file := filepath.Join(t.TempDir(), "id_ci")
+	if err := os.WriteFile(file, []byte("old contents that are longer than nothing"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := export(provider, &config.Config{}, []string{"--out", file, "secret/ssh/ci"}, nil); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read exported key: %v", err)
+	}
+	got, err := ssh.PrivateKeyFingerprint(data)
+	if err != nil {
+		t.Fatalf("exported key is not an unencrypted private key: %v", err)
+	}
+	want, err := ssh.Fingerprint(keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+	if got != want {
+		t.Error("exported key doesn't match the stored key")
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("failed to stat exported key: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("permissions = %o, want 600", perm)
+		}
+	}
+}
+
+func TestExportToStdout(t *testing.T) {
+	provider := newMemoryProvider()
+	provider.addGeneratedKey(t, "secret/ssh/ci", "ci@example.com")
+
+	var out bytes.Buffer
+	if err := export(provider, &config.Config{}, []string{"--to-stdout", "--format", "ppk", "secret/ssh/ci"}, &out); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "PuTTY-User-Key-File-3: ssh-ed25519\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Comment: ci@example.com\n") {
+		t.Error("ppk output should carry the stored comment")
+	}
+}
+
+func TestExportMissingPath(t *testing.T) {
+	provider := newMemoryProvider()
+	if err := export(provider, &config.Config{}, []string{"--to-stdout", "secret/ssh/missing"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for missing path, got nil")
+	}
+}
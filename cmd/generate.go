@@ -1,22 +1,23 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 	"github.com/codeignus/sm-ssh-add/internal/sm"
 	"github.com/codeignus/sm-ssh-add/internal/ssh"
 )
 
+// generateUsage is the usage message of the generate command
+const generateUsage = "usage: sm-ssh-add generate [--require-passphrase] [--save-path] [--regenerate] [--passphrase-path <path>] [--type ed25519|rsa|ecdsa] [--bits <n>] <path> [comment]"
+
 // Generate creates a new SSH key pair and displays the public key
 func Generate(provider sm.Provider, cfg *config.Config, args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: sm-ssh-add generate [--require-passphrase] [--save-path] <path> [comment]")
-	}
-
-	if len(args) > 5 {
-		return fmt.Errorf("too many arguments\nusage: sm-ssh-add generate [--require-passphrase] [--save-path] [--regenerate] <path> [comment]")
+		return fmt.Errorf("%s", generateUsage)
 	}
 
 	// Parse arguments
@@ -25,9 +26,38 @@ func Generate(provider sm.Provider, cfg *config.Config, args []string) error {
 	requirePassphrase := false
 	savePath := false
 	regenerateKeypair := false
+	keyType := ssh.KeyTypeEd25519
+	bits := 0
+	passphrasePath := ""
 
-	for _, arg := range args {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
 		if len(arg) > 0 && arg[0] == '-' {
+			if value, ok, err := flagValue(args, &i, "--type"); ok {
+				if err != nil {
+					return fmt.Errorf("%v\n%s", err, generateUsage)
+				}
+				keyType = value
+				continue
+			}
+			if value, ok, err := flagValue(args, &i, "--passphrase-path"); ok {
+				if err != nil {
+					return fmt.Errorf("%v\n%s", err, generateUsage)
+				}
+				passphrasePath = value
+				continue
+			}
+			if value, ok, err := flagValue(args, &i, "--bits"); ok {
+				if err != nil {
+					return fmt.Errorf("%v\n%s", err, generateUsage)
+				}
+				bits, err = strconv.Atoi(value)
+				if err != nil || bits <= 0 {
+					return fmt.Errorf("invalid --bits %q: must be a positive number", value)
+				}
+				continue
+			}
+
 			switch arg {
 			case "--require-passphrase":
 				requirePassphrase = true
@@ -43,12 +73,22 @@ func Generate(provider sm.Provider, cfg *config.Config, args []string) error {
 				path = arg
 			} else if comment == "" {
 				comment = arg
+			} else {
+				return fmt.Errorf("too many arguments\n%s", generateUsage)
 			}
 		}
 	}
 
 	if path == "" {
-		return fmt.Errorf("path is required\nusage: sm-ssh-add generate [--require-passphrase] <path> [comment]")
+		return fmt.Errorf("path is required\n%s", generateUsage)
+	}
+
+	if err := ssh.ValidateKeyType(keyType, bits); err != nil {
+		return err
+	}
+
+	if requirePassphrase && passphrasePath != "" {
+		return fmt.Errorf("cannot use both --require-passphrase and --passphrase-path")
 	}
 
 	var passphrase []byte
@@ -66,14 +106,23 @@ func Generate(provider sm.Provider, cfg *config.Config, args []string) error {
 	}
 
 	if requirePassphrase {
-		passphrase, err = readPassphrase()
+		passphrase, err = readPassphrase(cfg.PassphrasePolicy, false)
 		if err != nil {
 			return fmt.Errorf("failed to read passphrase: %w", err)
 		}
 	}
 
+	// Encrypt with a passphrase kept in another secret, so the key can be loaded without a prompt
+	if passphrasePath != "" {
+		passphrase, err = readSecretPassphrase(provider, passphrasePath)
+		if err != nil {
+			return err
+		}
+		requirePassphrase = true
+	}
+
 	// Generate the key pair
-	keyPair, err := ssh.GenerateKeyPair(comment, passphrase)
+	keyPair, err := ssh.GenerateKeyPairOfType(keyType, bits, comment, passphrase)
 	if err != nil {
 		return fmt.Errorf("failed to generate key pair: %w", err)
 	}
@@ -84,11 +133,12 @@ func Generate(provider sm.Provider, cfg *config.Config, args []string) error {
 		PublicKey:         keyPair.PublicKey,
 		RequirePassphrase: requirePassphrase,
 		Comment:           comment,
+		KeyType:           keyPair.KeyType,
+		PassphrasePath:    passphrasePath,
 	}
 
-	err = provider.Store(path, kv)
-	if err != nil {
-		return fmt.Errorf("failed to store key in vault: %w", err)
+	if err := storeKey(provider, path, kv); err != nil {
+		return err
 	}
 
 	// Save path to config if requested
@@ -107,25 +157,34 @@ func Generate(provider sm.Provider, cfg *config.Config, args []string) error {
 	return nil
 }
 
-// readPassphrase reads a passphrase from stdin twice to confirm
-func readPassphrase() ([]byte, error) {
-	fmt.Fprint(os.Stderr, "Enter passphrase (empty for no passphrase): ")
-	var passphrase1 string
-	_, err := fmt.Scanln(&passphrase1)
+// readPassphrase asks for a new passphrase twice to confirm and checks it against the policy.
+// If allowEmpty is set, an empty passphrase is accepted and means no passphrase.
+func readPassphrase(policy config.PassphrasePolicy, allowEmpty bool) ([]byte, error) {
+	prompt := "Enter passphrase: "
+	if allowEmpty {
+		prompt = "Enter passphrase (empty for no passphrase): "
+	}
+	passphrase1, err := readSecret(prompt)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Fprint(os.Stderr, "Enter same passphrase again: ")
-	var passphrase2 string
-	_, err = fmt.Scanln(&passphrase2)
+	if len(passphrase1) == 0 {
+		if !allowEmpty {
+			return nil, fmt.Errorf("passphrase cannot be empty when a passphrase is required")
+		}
+	} else if err := checkPassphrase(policy, passphrase1); err != nil {
+		return nil, err
+	}
+
+	passphrase2, err := readSecret("Enter same passphrase again: ")
 	if err != nil {
 		return nil, err
 	}
 
-	if passphrase1 != passphrase2 {
+	if !bytes.Equal(passphrase1, passphrase2) {
 		return nil, fmt.Errorf("passphrases do not match")
 	}
 
-	return []byte(passphrase1), nil
+	return passphrase1, nil
 }
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
 )
 
 // mockProvider is a mock implementation of sm.Provider for testing
@@ -269,3 +271,101 @@ func TestGenerateWithUnknownFlag(t *testing.T) {
 		})
 	}
 }
+
+// TestGenerateWithKeyType tests that --type and --bits select the algorithm and record it
+func TestGenerateWithKeyType(t *testing.T) {
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantType string
+	}{
+		{name: "default", args: []string{"secret/ssh/test"}, wantType: "ssh-ed25519"},
+		{name: "rsa", args: []string{"--type", "rsa", "--bits", "2048", "secret/ssh/test"}, wantType: "ssh-rsa"},
+		{name: "ecdsa with equals", args: []string{"--type=ecdsa", "--bits=384", "secret/ssh/test"}, wantType: "ecdsa-sha2-nistp384"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMemoryProvider()
+			if err := Generate(provider, cfg, tt.args); err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			kv, err := provider.Get("secret/ssh/test")
+			if err != nil {
+				t.Fatalf("key not stored: %v", err)
+			}
+			if kv.KeyType != tt.wantType {
+				t.Errorf("KeyType = %q, want %q", kv.KeyType, tt.wantType)
+			}
+			if !strings.HasPrefix(string(kv.PublicKey), tt.wantType+" ") {
+				t.Errorf("public key doesn't start with %s: %s", tt.wantType, kv.PublicKey)
+			}
+		})
+	}
+}
+
+// TestGenerateWithInvalidKeyType tests errors for bad --type and --bits values
+func TestGenerateWithInvalidKeyType(t *testing.T) {
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unsupported type", args: []string{"--type", "dsa", "secret/ssh/test"}},
+		{name: "missing type value", args: []string{"secret/ssh/test", "--type"}},
+		{name: "non-numeric bits", args: []string{"--type", "rsa", "--bits", "abc", "secret/ssh/test"}},
+		{name: "rsa too small", args: []string{"--type", "rsa", "--bits", "1024", "secret/ssh/test"}},
+		{name: "bits for ed25519", args: []string{"--bits", "256", "secret/ssh/test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMemoryProvider()
+			if err := Generate(provider, cfg, tt.args); err == nil {
+				t.Error("expected error, got nil")
+			}
+			if exists, _ := provider.CheckExists("secret/ssh/test"); exists {
+				t.Error("no key should be stored on error")
+			}
+		})
+	}
+}
+
+// TestGenerateWithPassphrasePath tests encrypting a new key with a passphrase kept in another secret
+func TestGenerateWithPassphrasePath(t *testing.T) {
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+	}
+	provider := newMemoryProvider()
+	provider.passphrases["secret/ssh/passphrases/test"] = []byte("from-secret")
+
+	if err := Generate(provider, cfg, []string{"--require-passphrase", "--passphrase-path", "secret/ssh/passphrases/test", "secret/ssh/test"}); err == nil {
+		t.Error("expected error for both --require-passphrase and --passphrase-path, got nil")
+	}
+	if err := Generate(provider, cfg, []string{"--passphrase-path", "secret/ssh/passphrases/missing", "secret/ssh/test"}); err == nil {
+		t.Error("expected error for missing passphrase secret, got nil")
+	}
+
+	if err := Generate(provider, cfg, []string{"--passphrase-path=secret/ssh/passphrases/test", "secret/ssh/test"}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	kv, err := provider.Get("secret/ssh/test")
+	if err != nil {
+		t.Fatalf("key not stored: %v", err)
+	}
+	if !kv.RequirePassphrase || kv.PassphrasePath != "secret/ssh/passphrases/test" {
+		t.Errorf("RequirePassphrase = %v, PassphrasePath = %q", kv.RequirePassphrase, kv.PassphrasePath)
+	}
+	passphrase := "from-secret"
+	if _, err := ssh.ExportKeyPair(&ssh.KeyPair{PrivateKey: kv.PrivateKey, Passphrase: &passphrase}, ssh.FormatOpenSSH, nil); err != nil {
+		t.Errorf("key should be encrypted with the passphrase from the secret: %v", err)
+	}
+}
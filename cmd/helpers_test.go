@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// memoryProvider is an in-memory sm.Provider holding real keys
+type memoryProvider struct {
+	keys        map[string]*sm.KeyValue
+	passphrases map[string][]byte
+	created     map[string]time.Time
+	published   map[string]*sm.PublicKeys
+}
+
+func newMemoryProvider() *memoryProvider {
+	return &memoryProvider{
+		keys:        map[string]*sm.KeyValue{},
+		passphrases: map[string][]byte{},
+		created:     map[string]time.Time{},
+		published:   map[string]*sm.PublicKeys{},
+	}
+}
+
+func (m *memoryProvider) Get(path string) (*sm.KeyValue, error) {
+	kv, ok := m.keys[path]
+	if !ok {
+		return nil, sm.ErrPathNotFound
+	}
+	// Return a copy, callers may clear the private key
+	copied := *kv
+	copied.PrivateKey = slices.Clone(kv.PrivateKey)
+	copied.PublicKey = slices.Clone(kv.PublicKey)
+	if kv.Previous != nil {
+		previous := *kv.Previous
+		previous.PrivateKey = slices.Clone(kv.Previous.PrivateKey)
+		copied.Previous = &previous
+	}
+	return &copied, nil
+}
+
+func (m *memoryProvider) Store(path string, kv *sm.KeyValue) error {
+	copied := *kv
+	m.keys[path] = &copied
+	return nil
+}
+
+func (m *memoryProvider) CheckExists(path string) (bool, error) {
+	_, ok := m.keys[path]
+	return ok, nil
+}
+
+func (m *memoryProvider) GetPassphrase(path string) ([]byte, error) {
+	passphrase, ok := m.passphrases[path]
+	if !ok {
+		return nil, sm.ErrPathNotFound
+	}
+	return slices.Clone(passphrase), nil
+}
+
+func (m *memoryProvider) StorePassphrase(path string, passphrase []byte) error {
+	m.passphrases[path] = slices.Clone(passphrase)
+	return nil
+}
+
+func (m *memoryProvider) KeyCreated(path string) (time.Time, error) {
+	created, ok := m.created[path]
+	if !ok {
+		return time.Time{}, sm.ErrPathNotFound
+	}
+	return created, nil
+}
+
+func (m *memoryProvider) PublishPublicKey(path string, keys *sm.PublicKeys) error {
+	copied := *keys
+	m.published[path] = &copied
+	return nil
+}
+
+func (m *memoryProvider) GetPublicKey(path string) (*sm.PublicKeys, error) {
+	keys, ok := m.published[path]
+	if !ok {
+		return nil, sm.ErrPublicKeyNotPublished
+	}
+	copied := *keys
+	return &copied, nil
+}
+
+// addGeneratedKey generates an unencrypted key and stores it at path
+func (m *memoryProvider) addGeneratedKey(t *testing.T, path, comment string) *ssh.KeyPair {
+	t.Helper()
+	keyPair, err := ssh.GenerateKeyPair(comment, nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	m.keys[path] = &sm.KeyValue{
+		PrivateKey: keyPair.PrivateKey,
+		PublicKey:  keyPair.PublicKey,
+		Comment:    comment,
+	}
+	return keyPair
+}
+
+// serveTestAgent serves an in-memory ssh-agent on a socket set as SSH_AUTH_SOCK
+func serveTestAgent(t *testing.T) agent.Agent {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	keyring := agent.NewKeyring()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", socket)
+	return keyring
+}
+
+// captureStderr returns what fn writes to os.Stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-output
+}
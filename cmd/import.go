@@ -0,0 +1,502 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// importUsage is the usage message of the import command
+const importUsage = `usage: sm-ssh-add import [--comment <comment>] [--require-passphrase] [--overwrite] [--save-path] [--shred] <file> <path>
+       sm-ssh-add import --scan <dir> --prefix <path prefix> [--require-passphrase] [--shred]`
+
+// maxKeyFileSize bounds the files read while scanning a directory for private keys
+const maxKeyFileSize = 1 << 20
+
+// importOptions holds the parsed arguments of the import command
+type importOptions struct {
+	file              string
+	path              string
+	comment           string
+	hasComment        bool
+	requirePassphrase bool
+	overwrite         bool
+	savePath          bool
+	shred             bool
+	scanDir           string
+	prefix            string
+}
+
+// parseImportArgs parses command line arguments of the import command
+func parseImportArgs(args []string) (*importOptions, error) {
+	opts := &importOptions{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) == 0 || arg[0] != '-' {
+			switch {
+			case opts.file == "":
+				opts.file = arg
+			case opts.path == "":
+				opts.path = arg
+			default:
+				return nil, fmt.Errorf("too many arguments\n%s", importUsage)
+			}
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--comment"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, importUsage)
+			}
+			opts.comment = value
+			opts.hasComment = true
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--scan"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, importUsage)
+			}
+			opts.scanDir = value
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--prefix"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, importUsage)
+			}
+			opts.prefix = value
+			continue
+		}
+
+		switch arg {
+		case "--require-passphrase":
+			opts.requirePassphrase = true
+		case "--overwrite":
+			opts.overwrite = true
+		case "--save-path":
+			opts.savePath = true
+		case "--shred":
+			opts.shred = true
+		default:
+			return nil, fmt.Errorf("unknown flag: %s", arg)
+		}
+	}
+
+	if opts.scanDir != "" {
+		if opts.file != "" {
+			return nil, fmt.Errorf("cannot use both --scan and a key file\n%s", importUsage)
+		}
+		if opts.prefix == "" {
+			return nil, fmt.Errorf("--scan requires --prefix\n%s", importUsage)
+		}
+		if opts.hasComment || opts.overwrite {
+			return nil, fmt.Errorf("--comment and --overwrite cannot be used with --scan")
+		}
+		return opts, nil
+	}
+
+	if opts.prefix != "" {
+		return nil, fmt.Errorf("--prefix requires --scan\n%s", importUsage)
+	}
+	if opts.file == "" || opts.path == "" {
+		return nil, fmt.Errorf("file and path are required\n%s", importUsage)
+	}
+
+	return opts, nil
+}
+
+// readPublicKeyFile returns the contents of the .pub file next to a private key, or nil if there is none
+func readPublicKeyFile(file string) ([]byte, error) {
+	publicKey, err := os.ReadFile(file + ".pub")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
+	}
+	return publicKey, nil
+}
+
+// shredFile overwrites a file with random data before removing it. Filesystems that copy on
+// write or SSDs that remap blocks may still keep the old contents.
+func shredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := io.CopyN(f, rand.Reader, info.Size()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// keyFileComment returns the comment for a key read from file: the comment of its .pub file if
+// there is one, otherwise the comment stored in the private key. Encrypted OpenSSH keys store it
+// encrypted, so they get the file name instead.
+func keyFileComment(file string, privateKey, publicKey []byte) (string, error) {
+	if publicKey != nil {
+		comment, err := ssh.PublicKeyComment(publicKey)
+		if err != nil {
+			return "", fmt.Errorf("invalid public key file %s.pub: %w", file, err)
+		}
+		return comment, nil
+	}
+
+	comment, err := ssh.PrivateKeyComment(privateKey)
+	if errors.Is(err, ssh.ErrPassphraseRequired) {
+		return filepath.Base(file), nil
+	}
+	return comment, err
+}
+
+// convertKeyFile converts a private key read from file for storage in the secret manager,
+// prompting for its passphrase if it is encrypted. The key keeps its passphrase unless
+// requirePassphrase asks for a new one, which must satisfy the policy. If publicKey is not nil,
+// it must match the private key.
+func convertKeyFile(file string, privateKey, publicKey []byte, comment string, requirePassphrase bool, policy config.PassphrasePolicy) (*sm.KeyValue, error) {
+	var passphrase []byte
+	keyPair, err := ssh.ImportKeyPair(privateKey, nil, comment, nil)
+	if errors.Is(err, ssh.ErrPassphraseRequired) {
+		passphrase, err = promptKeyPassphrase(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		keyPair, err = ssh.ImportKeyPair(privateKey, passphrase, comment, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse to store a key whose .pub file belongs to another key
+	if publicKey != nil {
+		want, err := ssh.Fingerprint(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key file %s.pub: %w", file, err)
+		}
+		got, err := ssh.Fingerprint(keyPair.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if want != got {
+			return nil, fmt.Errorf("public key file %s.pub does not match the private key", file)
+		}
+	}
+
+	newPassphrase := passphrase
+	if requirePassphrase {
+		newPassphrase, err = readPassphrase(policy, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+	}
+	if len(newPassphrase) > 0 {
+		keyPair, err = ssh.ImportKeyPair(privateKey, passphrase, comment, newPassphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &sm.KeyValue{
+		PrivateKey:        keyPair.PrivateKey,
+		PublicKey:         keyPair.PublicKey,
+		RequirePassphrase: len(newPassphrase) > 0,
+		Comment:           comment,
+		KeyType:           keyPair.KeyType,
+	}, nil
+}
+
+// Import stores existing private key files in the secret manager, either a single file or
+// every private key found in a directory with --scan.
+func Import(provider sm.Provider, cfg *config.Config, args []string) error {
+	opts, err := parseImportArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if opts.scanDir != "" {
+		return importScan(provider, cfg, opts, os.Stdout)
+	}
+
+	privateKey, err := os.ReadFile(opts.file)
+	if err != nil {
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+	defer clear(privateKey)
+
+	publicKey, err := readPublicKeyFile(opts.file)
+	if err != nil {
+		return err
+	}
+
+	comment := opts.comment
+	if !opts.hasComment {
+		if comment, err = keyFileComment(opts.file, privateKey, publicKey); err != nil {
+			return err
+		}
+	}
+
+	if !opts.overwrite {
+		exists, err := provider.CheckExists(opts.path)
+		if err != nil {
+			return fmt.Errorf("failed to check existing key: %w", err)
+		}
+		if exists {
+			return fmt.Errorf("key already exists at %s (use --overwrite to replace it)", opts.path)
+		}
+	}
+
+	kv, err := convertKeyFile(opts.file, privateKey, publicKey, comment, opts.requirePassphrase, cfg.PassphrasePolicy)
+	if err != nil {
+		return err
+	}
+	if err := storeKey(provider, opts.path, kv); err != nil {
+		return err
+	}
+
+	if opts.savePath {
+		if err := cfg.AddPath(opts.path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Path %q saved to config\n", opts.path)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "%s", kv.PublicKey)
+	fmt.Fprintf(os.Stdout, "Key imported from %s to: %s\n", opts.file, opts.path)
+
+	// Only remove the local copy once the key is safely stored
+	if opts.shred {
+		if err := shredFile(opts.file); err != nil {
+			return fmt.Errorf("key was imported but shredding %s failed: %w", opts.file, err)
+		}
+		fmt.Fprintf(os.Stderr, "Shredded %s\n", opts.file)
+	}
+
+	return nil
+}
+
+// findPrivateKeyFiles returns the files in dir that contain a PEM encoded private key
+func findPrivateKeyFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".pub") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() > maxKeyFileSize {
+			continue
+		}
+
+		file := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if ssh.IsPrivateKey(data) {
+			files = append(files, file)
+		}
+		clear(data)
+	}
+	return files, nil
+}
+
+// storedFingerprints maps the fingerprints of the keys at the configured paths to their path
+func storedFingerprints(provider sm.Provider, paths []string) map[string]string {
+	stored := make(map[string]string, len(paths))
+	for _, path := range paths {
+		keyValue, err := provider.Get(path)
+		if err != nil {
+			if !errors.Is(err, sm.ErrPathNotFound) {
+				fmt.Fprintf(os.Stderr, "Warning: failed to read %s: %v\n", path, err)
+			}
+			continue
+		}
+		clear(keyValue.PrivateKey)
+
+		if fingerprint, err := ssh.Fingerprint(keyValue.PublicKey); err == nil {
+			stored[fingerprint] = path
+		}
+	}
+	return stored
+}
+
+// scanResult is the outcome of importing one key file during a directory scan
+type scanResult struct {
+	file   string
+	path   string
+	status string // imported, skipped or failed
+	reason string
+}
+
+// importScanFile imports one key file found by a directory scan. stored maps fingerprints of
+// keys already in the secret manager to their path and is updated with the imported key.
+func importScanFile(provider sm.Provider, file, path string, stored map[string]string, requirePassphrase bool, policy config.PassphrasePolicy) scanResult {
+	result := scanResult{file: file, path: path, status: "failed"}
+
+	privateKey, err := os.ReadFile(file)
+	if err != nil {
+		result.reason = err.Error()
+		return result
+	}
+	defer clear(privateKey)
+
+	publicKey, err := readPublicKeyFile(file)
+	if err != nil {
+		result.reason = err.Error()
+		return result
+	}
+
+	// Skip known keys before prompting for a passphrase when the fingerprint is readable
+	fingerprint := ""
+	if publicKey != nil {
+		fingerprint, err = ssh.Fingerprint(publicKey)
+	} else {
+		fingerprint, err = ssh.PrivateKeyFingerprint(privateKey)
+	}
+	if err != nil && !errors.Is(err, ssh.ErrPassphraseRequired) {
+		result.reason = err.Error()
+		return result
+	}
+	if existing, ok := stored[fingerprint]; ok {
+		result.status, result.reason = "skipped", "already stored at "+existing
+		return result
+	}
+
+	exists, err := provider.CheckExists(path)
+	if err != nil {
+		result.reason = fmt.Sprintf("failed to check existing key: %v", err)
+		return result
+	}
+	if exists {
+		result.status, result.reason = "skipped", "path already holds a different key"
+		if existing, err := provider.Get(path); err == nil {
+			clear(existing.PrivateKey)
+			if existingFingerprint, err := ssh.Fingerprint(existing.PublicKey); err == nil && existingFingerprint == fingerprint {
+				result.reason = "already stored at " + path
+			}
+		}
+		return result
+	}
+
+	comment, err := keyFileComment(file, privateKey, publicKey)
+	if err != nil {
+		result.reason = err.Error()
+		return result
+	}
+
+	kv, err := convertKeyFile(file, privateKey, publicKey, comment, requirePassphrase, policy)
+	if err != nil {
+		result.reason = err.Error()
+		return result
+	}
+
+	// Keys whose fingerprint could only be read after decryption
+	fingerprint, err = ssh.Fingerprint(kv.PublicKey)
+	if err != nil {
+		result.reason = err.Error()
+		return result
+	}
+	if existing, ok := stored[fingerprint]; ok {
+		result.status, result.reason = "skipped", "already stored at "+existing
+		return result
+	}
+
+	if err := storeKey(provider, path, kv); err != nil {
+		result.reason = err.Error()
+		return result
+	}
+	stored[fingerprint] = path
+
+	result.status = "imported"
+	return result
+}
+
+// importScan imports every private key in a directory under paths derived from the prefix and
+// the file names, adds them to the config and writes a migration report to out
+func importScan(provider sm.Provider, cfg *config.Config, opts *importOptions, out io.Writer) error {
+	files, err := findPrivateKeyFiles(opts.scanDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no private keys found in %s", opts.scanDir)
+	}
+
+	stored := storedFingerprints(provider, cfg.GetPaths())
+
+	var results []scanResult
+	for _, file := range files {
+		path := opts.prefix + filepath.Base(file)
+		result := importScanFile(provider, file, path, stored, opts.requirePassphrase, cfg.PassphrasePolicy)
+
+		if result.status == "imported" {
+			if err := cfg.AddPath(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			if opts.shred {
+				if err := shredFile(file); err != nil {
+					result.reason = fmt.Sprintf("shredding failed: %v", err)
+				} else {
+					result.reason = "shredded"
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	imported, skipped, failed := 0, 0, 0
+	fmt.Fprintf(out, "Migration report for %s:\n", opts.scanDir)
+	for _, result := range results {
+		switch result.status {
+		case "imported":
+			imported++
+			line := fmt.Sprintf("  %-8s  %s -> %s", result.status, result.file, result.path)
+			if result.reason != "" {
+				line += " (" + result.reason + ")"
+			}
+			fmt.Fprintln(out, line)
+		case "skipped":
+			skipped++
+			fmt.Fprintf(out, "  %-8s  %s: %s\n", result.status, result.file, result.reason)
+		default:
+			failed++
+			fmt.Fprintf(out, "  %-8s  %s: %s\n", result.status, result.file, result.reason)
+		}
+	}
+	fmt.Fprintf(out, "%d keys found: %d imported, %d skipped, %d failed\n", len(results), imported, skipped, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d keys failed to import", failed)
+	}
+	return nil
+}
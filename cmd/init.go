@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+)
+
+// initUsage is the usage message of the init command
+const initUsage = "usage: sm-ssh-add init [--force]"
+
+// wizard asks the questions of the init command
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints question and returns the trimmed answer, or def if the answer is empty
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+
+	line, err := w.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("input ended before the configuration was complete")
+		}
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// askProvider asks for the secret manager provider
+func (w *wizard) askProvider() (string, error) {
+	for {
+		provider, err := w.ask("Secret manager (vault)", config.ProviderVault)
+		if err != nil {
+			return "", err
+		}
+		if provider == config.ProviderVault {
+			return provider, nil
+		}
+		if provider == config.ProviderAWS {
+			fmt.Fprintln(w.out, "  init only sets up vault, configure aws with: sm-ssh-add config set default_provider aws")
+			continue
+		}
+		fmt.Fprintf(w.out, "  %s is not supported, use vault for HashiCorp Vault and OpenBao\n", provider)
+	}
+}
+
+// askVaultAddress asks for the Vault address until Vault is reachable there
+func (w *wizard) askVaultAddress() (string, *sm.VaultDiagnostics, error) {
+	for {
+		addr, err := w.ask("Vault address", sm.VaultAddress(nil))
+		if err != nil {
+			return "", nil, err
+		}
+		diagnostics, err := sm.NewVaultDiagnostics(addr)
+		if err != nil {
+			fmt.Fprintf(w.out, "  %v\n", err)
+			continue
+		}
+		version, err := diagnostics.Health()
+		if err != nil {
+			fmt.Fprintf(w.out, "  cannot use %s: %v\n", addr, err)
+			continue
+		}
+		fmt.Fprintf(w.out, "  connected to Vault %s\n", version)
+		return addr, diagnostics, nil
+	}
+}
+
+// askAuth asks for the authentication method until the login succeeds, and returns the AppRole
+// role ID, empty for token authentication. Tokens are only used for checking, never saved.
+func (w *wizard) askAuth(diagnostics *sm.VaultDiagnostics) (string, error) {
+	for {
+		method, err := w.ask("Authentication method (token or approle)", "token")
+		if err != nil {
+			return "", err
+		}
+
+		var roleID string
+		var ttl time.Duration
+		prompted := false
+		switch method {
+		case "token":
+			if os.Getenv("BAO_TOKEN") != "" || os.Getenv("VAULT_TOKEN") != "" {
+				ttl, err = diagnostics.Login(nil)
+				break
+			}
+			var token []byte
+			token, err = readSecret("Vault token (only used to check access, not saved): ")
+			if err == nil {
+				prompted = true
+				ttl, err = diagnostics.LoginToken(string(token))
+			}
+		case "approle":
+			roleID, err = w.ask("AppRole role ID", "")
+			if err != nil {
+				return "", err
+			}
+			if roleID == "" {
+				fmt.Fprintln(w.out, "  the role ID is required for AppRole authentication")
+				continue
+			}
+			ttl, err = diagnostics.Login(&config.Config{VaultApproleRoleID: roleID})
+		default:
+			fmt.Fprintf(w.out, "  unknown authentication method %s\n", method)
+			continue
+		}
+
+		switch {
+		case err != nil:
+			fmt.Fprintf(w.out, "  login failed: %v\n", err)
+			continue
+		case ttl == 0:
+			fmt.Fprintln(w.out, "  logged in, token does not expire")
+		default:
+			fmt.Fprintf(w.out, "  logged in, token expires in %s\n", ttl.Round(time.Minute))
+		}
+		if prompted {
+			fmt.Fprintln(w.out, "  export VAULT_TOKEN or BAO_TOKEN before running sm-ssh-add")
+		}
+		return roleID, nil
+	}
+}
+
+// askPaths asks for the secret paths of keys until an empty answer, keeping the ones the token
+// can read in a KV v2 mount
+func (w *wizard) askPaths(diagnostics *sm.VaultDiagnostics) ([]string, error) {
+	fmt.Fprintln(w.out, "Secret paths of your SSH keys, one per line, empty line to finish (e.g. secret/data/ssh/github)")
+	var paths []string
+	for {
+		path, err := w.ask("Path", "")
+		if err != nil || path == "" {
+			return paths, err
+		}
+		if slices.Contains(paths, path) {
+			continue
+		}
+		if _, fix, err := vaultPathProblem(diagnostics, path); err != nil {
+			fmt.Fprintf(w.out, "  %v\n  fix: %s\n", err, fix)
+			continue
+		}
+		paths = append(paths, path)
+	}
+}
+
+// Init asks for the provider, address, authentication method and key paths, checks them against
+// the secret manager and writes the config file
+func Init(args []string) error {
+	return initConfig(args, os.Stdin, os.Stdout)
+}
+
+// initConfig implements Init, reading answers from in
+func initConfig(args []string, in io.Reader, out io.Writer) error {
+	force := false
+	for _, arg := range args {
+		switch arg {
+		case "--force":
+			force = true
+		default:
+			return fmt.Errorf("unknown argument: %s\n%s", arg, initUsage)
+		}
+	}
+
+	configPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configPath); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to replace it", configPath)
+	}
+
+	w := &wizard{in: bufio.NewReader(in), out: out}
+	cfg := &config.Config{}
+	if cfg.DefaultProvider, err = w.askProvider(); err != nil {
+		return err
+	}
+	addr, diagnostics, err := w.askVaultAddress()
+	if err != nil {
+		return err
+	}
+	cfg.VaultAddress = addr
+	if cfg.VaultApproleRoleID, err = w.askAuth(diagnostics); err != nil {
+		return err
+	}
+	if cfg.VaultPaths, err = w.askPaths(diagnostics); err != nil {
+		return err
+	}
+
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %s\n", configPath)
+	if len(cfg.VaultPaths) == 0 {
+		fmt.Fprintln(out, "Next: sm-ssh-add generate --save-path <path> [comment]")
+	} else {
+		fmt.Fprintln(out, "Next: sm-ssh-add load --from-config")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+func TestInitWritesValidatedConfig(t *testing.T) {
+	serveFakeVault(t, map[string]string{"secret/": "2", "kv/": "1"}, []string{"secret/data/ssh/a", "secret/data/ssh/b"})
+	addr := os.Getenv("VAULT_ADDR")
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	withAnswers(t, "wrong-token", "test-token")
+
+	answers := strings.Join([]string{
+		"aws",                // set up with config set
+		"gcp",                // unsupported provider
+		"",                   // default provider
+		"http://127.0.0.1:1", // unreachable address
+		addr,
+		"ldap",                   // unknown method
+		"",                       // token, rejected
+		"token",                  // token, accepted
+		"secret/ssh/a",           // missing data/ segment
+		"kv/ssh/a",               // KV v1
+		"secret/data/ssh/denied", // not readable
+		"secret/data/ssh/a",
+		"secret/data/ssh/a", // duplicate
+		"secret/data/ssh/b",
+		"", // done
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	if err := initConfig(nil, strings.NewReader(answers), &out); err != nil {
+		t.Fatalf("initConfig failed: %v\n%s", err, out.String())
+	}
+
+	for _, want := range []string{
+		"configure aws with: sm-ssh-add config set default_provider aws",
+		"gcp is not supported",
+		"cannot use http://127.0.0.1:1",
+		"unknown authentication method ldap",
+		"login failed",
+		"export VAULT_TOKEN",
+		"fix: use secret/data/ssh/a instead",
+		"fix: upgrade the mount: vault kv enable-versioning kv/",
+		`fix: add to your policy: path "secret/data/ssh/denied"`,
+		"Next: sm-ssh-add load --from-config",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	configPath := filepath.Join(home, ".config", config.ConfigFileName)
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatalf("config not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("config permissions = %v, want 0600", info.Mode().Perm())
+	}
+
+	data, _ := os.ReadFile(configPath)
+	var cfg config.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if cfg.DefaultProvider != config.ProviderVault || cfg.VaultAddress != addr || cfg.VaultApproleRoleID != "" ||
+		!slices.Equal(cfg.VaultPaths, []string{"secret/data/ssh/a", "secret/data/ssh/b"}) {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	// An existing config is only replaced with --force
+	if err := initConfig(nil, strings.NewReader(answers), &out); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("initConfig = %v, want error about the existing config", err)
+	}
+}
+
+func TestInitStopsAtEndOfInput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := initConfig(nil, strings.NewReader("vault\n"), &bytes.Buffer{}); err == nil {
+		t.Error("expected error at end of input, got nil")
+	}
+	if err := initConfig([]string{"--yes"}, strings.NewReader(""), &bytes.Buffer{}); err == nil {
+		t.Error("expected error for unknown argument, got nil")
+	}
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// listUsage is the usage message of the list command
+const listUsage = "usage: sm-ssh-add list [--json]"
+
+// listedKey is a configured key in the output of the list command
+type listedKey struct {
+	Path              string     `json:"path"`
+	Previous          bool       `json:"previous,omitempty"` // previous key of a rotation, loadable until Expires
+	Expires           *time.Time `json:"expires,omitempty"`
+	Type              string     `json:"type,omitempty"`
+	Fingerprint       string     `json:"fingerprint,omitempty"`
+	Comment           string     `json:"comment,omitempty"`
+	RequirePassphrase bool       `json:"require_passphrase"`
+	Loaded            *bool      `json:"loaded,omitempty"` // nil if the agent could not be reached
+	Error             string     `json:"error,omitempty"`
+}
+
+// listedAgentKey is a key in the agent that does not belong to a configured path
+type listedAgentKey struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	Comment     string `json:"comment,omitempty"`
+	Path        string `json:"path,omitempty"` // set for keys loaded by sm-ssh-add from a path that is not configured
+}
+
+// listOutput is the JSON output of the list command
+type listOutput struct {
+	Keys      []listedKey      `json:"keys"`
+	AgentKeys []listedAgentKey `json:"agent_keys"`
+}
+
+// describeKey returns the key type, including the size for RSA and ECDSA keys, and the fingerprint
+// of an authorized_keys format public key
+func describeKey(publicKey []byte) (string, string, error) {
+	fingerprint, err := ssh.Fingerprint(publicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	keyType, bits, err := ssh.PublicKeyType(publicKey)
+	if err != nil {
+		// Keys generated elsewhere, such as security keys, are shown by their SSH type
+		return strings.Fields(string(publicKey))[0], fingerprint, nil
+	}
+	if bits > 0 {
+		keyType = fmt.Sprintf("%s-%d", keyType, bits)
+	}
+	return keyType, fingerprint, nil
+}
+
+// listKey describes a stored key and whether it is loaded in the agent
+func listKey(path string, keyValue *sm.KeyValue, agent *ssh.Agent) listedKey {
+	key := listedKey{
+		Path:              path,
+		Comment:           keyValue.Comment,
+		RequirePassphrase: keyValue.RequirePassphrase,
+	}
+
+	var err error
+	key.Type, key.Fingerprint, err = describeKey(keyValue.PublicKey)
+	if err != nil {
+		key.Error = err.Error()
+		return key
+	}
+
+	if agent != nil {
+		loaded, err := agent.KeyExists(key.Fingerprint)
+		if err != nil {
+			key.Error = err.Error()
+			return key
+		}
+		key.Loaded = &loaded
+	}
+	return key
+}
+
+// listKeys describes the keys stored at the configured paths and the other keys in the agent.
+// agent may be nil if it could not be reached.
+func listKeys(provider sm.Provider, paths []string, agent *ssh.Agent, now time.Time) (*listOutput, error) {
+	output := &listOutput{Keys: []listedKey{}, AgentKeys: []listedAgentKey{}}
+	known := map[string]bool{}
+
+	for _, path := range paths {
+		keyValue, err := provider.Get(path)
+		if err != nil {
+			output.Keys = append(output.Keys, listedKey{Path: path, Error: err.Error()})
+			continue
+		}
+		clear(keyValue.PrivateKey)
+
+		key := listKey(path, keyValue, agent)
+		output.Keys = append(output.Keys, key)
+		known[key.Fingerprint] = true
+
+		if keyValue.PreviousActive(now) {
+			clear(keyValue.Previous.PrivateKey)
+			previous := listKey(path, keyValue.Previous, agent)
+			previous.Previous = true
+			previous.Expires = &keyValue.PreviousExpires
+			output.Keys = append(output.Keys, previous)
+			known[previous.Fingerprint] = true
+		}
+	}
+
+	if agent == nil {
+		return output, nil
+	}
+
+	agentKeys, err := agent.Keys()
+	if err != nil {
+		return nil, err
+	}
+	for _, agentKey := range agentKeys {
+		keyType, fingerprint, err := describeKey(agentKey.PublicKey)
+		if err != nil || known[fingerprint] {
+			continue
+		}
+		path, _ := ssh.ManagedPath(agentKey.Comment)
+		output.AgentKeys = append(output.AgentKeys, listedAgentKey{
+			Type:        keyType,
+			Fingerprint: fingerprint,
+			Comment:     agentKey.Comment,
+			Path:        path,
+		})
+	}
+	return output, nil
+}
+
+// yesNo formats a flag for the table output
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// writeListTable writes the output of the list command as tables
+func writeListTable(out io.Writer, output *listOutput) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tTYPE\tFINGERPRINT\tPASSPHRASE\tLOADED\tCOMMENT")
+	for _, key := range output.Keys {
+		path := key.Path
+		if key.Previous {
+			path += fmt.Sprintf(" (previous, until %s)", key.Expires.Local().Format(time.DateOnly))
+		}
+		if key.Error != "" {
+			fmt.Fprintf(w, "%s\terror: %s\t\t\t\t\n", path, key.Error)
+			continue
+		}
+		loaded := "unknown"
+		if key.Loaded != nil {
+			loaded = yesNo(*key.Loaded)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", path, key.Type, key.Fingerprint, yesNo(key.RequirePassphrase), loaded, key.Comment)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(output.AgentKeys) == 0 {
+		return nil
+	}
+	fmt.Fprintln(out, "\nOther keys in ssh-agent:")
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tFINGERPRINT\tSOURCE\tCOMMENT")
+	for _, key := range output.AgentKeys {
+		source := "not managed by sm-ssh-add"
+		if key.Path != "" {
+			source = key.Path + " (not configured)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.Type, key.Fingerprint, source, key.Comment)
+	}
+	return w.Flush()
+}
+
+// List shows the keys of the configured paths, whether they are loaded in ssh-agent, and the
+// other keys in the agent
+func List(provider sm.Provider, cfg *config.Config, args []string) error {
+	return list(provider, cfg, args, os.Stdout)
+}
+
+// list implements List, writing to out
+func list(provider sm.Provider, cfg *config.Config, args []string, out io.Writer) error {
+	asJSON := false
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			asJSON = true
+		default:
+			return fmt.Errorf("unknown argument: %s\n%s", arg, listUsage)
+		}
+	}
+
+	// The stored keys can still be listed without an agent
+	agent, err := ssh.NewAgent(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot check loaded keys: %v\n", err)
+	} else {
+		defer func() {
+			if cerr := agent.Close(); cerr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close ssh-agent: %v\n", cerr)
+			}
+		}()
+	}
+
+	output, err := listKeys(provider, cfg.GetPaths(), agent, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(output); err != nil {
+			return err
+		}
+	} else if err := writeListTable(out, output); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, key := range output.Keys {
+		if key.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d keys could not be read", failed)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// addToAgent adds an unencrypted OpenSSH private key to the agent
+func addToAgent(t *testing.T, keyring agent.Agent, privateKey []byte, comment string) {
+	t.Helper()
+	key, err := ssh.ParseRawPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: comment}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+}
+
+func TestListShowsLoadedAndOtherKeys(t *testing.T) {
+	keyring := serveTestAgent(t)
+	provider := newMemoryProvider()
+	loaded := provider.addGeneratedKey(t, "secret/ssh/loaded", "loaded@example.com")
+	provider.addGeneratedKey(t, "secret/ssh/unloaded", "unloaded@example.com")
+	other := provider.addGeneratedKey(t, "secret/ssh/other", "")
+	unconfigured := provider.addGeneratedKey(t, "secret/ssh/unconfigured", "")
+
+	addToAgent(t, keyring, loaded.PrivateKey, "loaded@example.com [sm-ssh-add:secret/ssh/loaded]")
+	addToAgent(t, keyring, other.PrivateKey, "someone@laptop")
+	addToAgent(t, keyring, unconfigured.PrivateKey, "[sm-ssh-add:secret/ssh/unconfigured]")
+
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+		VaultPaths:      []string{"secret/ssh/loaded", "secret/ssh/unloaded", "secret/ssh/missing"},
+	}
+
+	var out bytes.Buffer
+	if err := list(provider, cfg, []string{"--json"}, &out); err == nil || !strings.Contains(err.Error(), "1 keys could not be read") {
+		t.Errorf("list = %v, want error for the missing path", err)
+	}
+
+	var output listOutput
+	if err := json.Unmarshal(out.Bytes(), &output); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(output.Keys) != 3 {
+		t.Fatalf("expected 3 configured keys, got %+v", output.Keys)
+	}
+	if k := output.Keys[0]; k.Loaded == nil || !*k.Loaded || k.Type != "ed25519" || k.Comment != "loaded@example.com" || !strings.HasPrefix(k.Fingerprint, "SHA256:") {
+		t.Errorf("loaded key = %+v", k)
+	}
+	if k := output.Keys[1]; k.Loaded == nil || *k.Loaded {
+		t.Errorf("unloaded key = %+v", k)
+	}
+	if k := output.Keys[2]; k.Error == "" {
+		t.Errorf("missing key should report an error, got %+v", k)
+	}
+
+	if len(output.AgentKeys) != 2 {
+		t.Fatalf("expected 2 other agent keys, got %+v", output.AgentKeys)
+	}
+	if output.AgentKeys[0].Comment != "someone@laptop" || output.AgentKeys[0].Path != "" {
+		t.Errorf("unmanaged agent key = %+v", output.AgentKeys[0])
+	}
+	if output.AgentKeys[1].Path != "secret/ssh/unconfigured" {
+		t.Errorf("managed agent key from an unconfigured path = %+v", output.AgentKeys[1])
+	}
+
+	// The table shows the same information
+	out.Reset()
+	cfg.VaultPaths = cfg.VaultPaths[:2]
+	if err := list(provider, cfg, nil, &out); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	table := out.String()
+	for _, want := range []string{"PATH", "secret/ssh/loaded", "yes", "Other keys in ssh-agent:", "not managed by sm-ssh-add", "secret/ssh/unconfigured (not configured)"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("table should contain %q:\n%s", want, table)
+		}
+	}
+}
+
+func TestListWithoutAgent(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	provider := newMemoryProvider()
+	provider.addGeneratedKey(t, "secret/ssh/a", "a@example.com")
+	provider.addGeneratedKey(t, "secret/ssh/old", "")
+	provider.keys["secret/ssh/a"].Previous = provider.keys["secret/ssh/old"]
+	provider.keys["secret/ssh/a"].PreviousExpires = time.Now().Add(time.Hour)
+
+	output, err := listKeys(provider, []string{"secret/ssh/a"}, nil, time.Now())
+	if err != nil {
+		t.Fatalf("listKeys failed: %v", err)
+	}
+	if len(output.Keys) != 2 || output.Keys[0].Loaded != nil {
+		t.Fatalf("expected current and previous key with unknown state, got %+v", output.Keys)
+	}
+	if !output.Keys[1].Previous || output.Keys[1].Expires == nil {
+		t.Errorf("second key should be the previous key, got %+v", output.Keys[1])
+	}
+
+	var out bytes.Buffer
+	if err := list(provider, &config.Config{DefaultProvider: config.ProviderVault, VaultPaths: []string{"secret/ssh/a"}}, nil, &out); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "unknown") || !strings.Contains(out.String(), "(previous, until ") {
+		t.Errorf("table should show the unknown agent state and the previous key:\n%s", out.String())
+	}
+
+	if err := list(provider, &config.Config{}, []string{"--all"}, &out); err == nil {
+		t.Error("expected error for unknown argument, got nil")
+	}
+}
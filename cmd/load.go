@@ -1,103 +1,291 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 	"github.com/codeignus/sm-ssh-add/internal/sm"
 	"github.com/codeignus/sm-ssh-add/internal/ssh"
 )
 
+// loadUsage is the usage message of the load command
+const loadUsage = "usage: sm-ssh-add load [--confirm] [--restrict host1,host2] [--from-config | --all-profiles] <path>..."
+
+// loadOptions holds the parsed arguments of the load command
+type loadOptions struct {
+	paths       []string
+	confirm     bool
+	restrict    []string
+	allProfiles bool // Load the configured paths of every profile instead of paths
+}
+
+// keyConstraints are the ssh-agent constraints applied to a loaded key
+type keyConstraints struct {
+	confirm      bool
+	destinations []ssh.DestinationConstraint
+}
+
+// splitDestinations splits a comma separated list of destinations, ignoring empty entries
+func splitDestinations(value string) []string {
+	var destinations []string
+	for _, d := range strings.Split(value, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			destinations = append(destinations, d)
+		}
+	}
+	return destinations
+}
+
 // parseLoadArgs parses command line arguments and returns the paths to load
-func parseLoadArgs(args []string, cfg *config.Config) ([]string, error) {
+func parseLoadArgs(args []string, cfg *config.Config) (*loadOptions, error) {
 	if len(args) == 0 {
-		return nil, fmt.Errorf("usage: sm-ssh-add load [--from-config] <path>")
+		return nil, fmt.Errorf("%s", loadUsage)
+	}
+
+	opts := &loadOptions{}
+	fromConfig := false
+	var directPaths []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) > 0 && arg[0] == '-' {
+			if value, ok, err := flagValue(args, &i, "--restrict"); ok {
+				if err != nil {
+					return nil, fmt.Errorf("%v\n%s", err, loadUsage)
+				}
+				opts.restrict = append(opts.restrict, splitDestinations(value)...)
+				continue
+			}
+
+			switch arg {
+			case "--from-config":
+				fromConfig = true
+			case "--all-profiles":
+				opts.allProfiles = true
+			case "--confirm":
+				opts.confirm = true
+			default:
+				return nil, fmt.Errorf("unknown flag: %s", arg)
+			}
+		} else {
+			directPaths = append(directPaths, arg)
+		}
+	}
+
+	if opts.allProfiles {
+		if fromConfig || len(directPaths) > 0 {
+			return nil, fmt.Errorf("cannot use --all-profiles with --from-config or direct paths")
+		}
+		if len(cfg.Profiles) == 0 {
+			return nil, fmt.Errorf("no profiles configured")
+		}
+		return opts, nil
 	}
 
-	// Check for --from-config flag
-	if args[0] == "--from-config" {
-		if len(args) > 1 {
+	if fromConfig {
+		if len(directPaths) > 0 {
 			return nil, fmt.Errorf("cannot use both --from-config and direct path")
 		}
 		paths := cfg.GetPaths()
 		if len(paths) == 0 {
 			return nil, fmt.Errorf("no paths configured")
 		}
-		return paths, nil
+		opts.paths = paths
+		return opts, nil
 	}
 
-	// Check for unknown flags
-	if args[0][0] == '-' {
-		return nil, fmt.Errorf("unknown flag: %s", args[0])
+	if len(directPaths) == 0 {
+		return nil, fmt.Errorf("path is required\n%s", loadUsage)
 	}
 
-	// Direct path argument
-	return []string{args[0]}, nil
+	opts.paths = directPaths
+	return opts, nil
 }
 
-// loadAndAddKey loads a key from the given path and adds it to the agent
-func loadAndAddKey(path string, provider sm.Provider, agent *ssh.Agent) error {
-	keyValue, err := provider.Get(path)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load key from %s: %v\n", path, err)
-		return err
+// addKeyValue verifies a key read from path, decrypts it if needed and adds it to the agent
+func addKeyValue(path string, keyValue *sm.KeyValue, provider sm.Provider, cfg *config.Config, agent *ssh.Agent, constraints keyConstraints, lifetime time.Duration) error {
+	// Keys whose public key is only available after decryption are checked by AddKey
+	err := ssh.VerifyKeyPair(keyValue.PrivateKey, keyValue.PublicKey, keyValue.RequirePassphrase, nil)
+	if err != nil && !errors.Is(err, ssh.ErrPassphraseRequired) {
+		return fmt.Errorf("%w (run: sm-ssh-add verify %s)", err, path)
 	}
 
 	keyPair := &ssh.KeyPair{
-		PrivateKey: keyValue.PrivateKey,
-		PublicKey:  keyValue.PublicKey,
-		Comment:    keyValue.Comment,
+		PrivateKey:       keyValue.PrivateKey,
+		PublicKey:        keyValue.PublicKey,
+		Comment:          ssh.ManagedComment(keyValue.Comment, path),
+		ConfirmBeforeUse: constraints.confirm,
+		Destinations:     constraints.destinations,
+		Lifetime:         lifetime,
 	}
 
-	// If key requires passphrase, prompt user for it
+	// If key requires passphrase, read it from its passphrase path or prompt user for it
 	if keyValue.RequirePassphrase {
-		var passphrase string
-		fmt.Fprintf(os.Stdout, "Enter passphrase for key %s: ", path)
-		_, err := fmt.Scanln(&passphrase)
+		p, err := keyPassphrase(provider, cfg, path, keyValue)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to read passphrase: %v\n", err)
 			return err
 		}
+		passphrase := string(p)
 		keyPair.Passphrase = &passphrase
 	}
 
-	err = agent.AddKey(keyPair)
+	return agent.AddKey(keyPair)
+}
+
+// loadAndAddKey loads a key from the given path and adds it to the agent with the given constraints.
+// The previous key of a rotation is added too until its grace period expires.
+func loadAndAddKey(path string, provider sm.Provider, cfg *config.Config, agent *ssh.Agent, constraints keyConstraints) error {
+	keyValue, err := provider.Get(path)
 	if err != nil {
-		if err == sm.ErrKeyExistsInAgent {
-			fmt.Fprintf(os.Stdout, "Key from %s already loaded in agent\n", path)
-			return nil
-		}
+		fmt.Fprintf(os.Stderr, "Failed to load key from %s: %v\n", path, err)
+		return err
+	}
+
+	err = addKeyValue(path, keyValue, provider, cfg, agent, constraints, 0)
+	switch {
+	case err == sm.ErrKeyExistsInAgent:
+		fmt.Fprintf(os.Stdout, "Key from %s already loaded in agent\n", path)
+	case err != nil:
 		fmt.Fprintf(os.Stderr, "Failed to add key from %s: %v\n", path, err)
 		return err
+	default:
+		fmt.Fprintf(os.Stdout, "Loaded key from %s into ssh-agent\n", path)
 	}
 
-	fmt.Fprintf(os.Stdout, "Loaded key from %s into ssh-agent\n", path)
+	now := time.Now()
+	if !keyValue.PreviousActive(now) {
+		return nil
+	}
+	// The agent drops the previous key itself when the grace period ends
+	err = addKeyValue(path, keyValue.Previous, provider, cfg, agent, constraints, keyValue.PreviousExpires.Sub(now))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to add previous key from %s: %v\n", path, err)
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Loaded previous key from %s into ssh-agent until %s\n", path, keyValue.PreviousExpires.Local().Format(time.DateTime))
 	return nil
 }
 
-// Load retrieves SSH keys from the secret manager and adds them to ssh-agent
-func Load(provider sm.Provider, cfg *config.Config, args []string) error {
-	paths, err := parseLoadArgs(args, cfg)
-	if err != nil {
-		return err
+// resolveKeyConstraints combines the command line constraints with the ones configured for the path
+func resolveKeyConstraints(path string, opts *loadOptions, cfg *config.Config) (keyConstraints, error) {
+	keyOpts := cfg.GetKeyOptions(path)
+	constraints := keyConstraints{
+		confirm: opts.confirm || keyOpts.Confirm,
+	}
+
+	restrict := append(slices.Clone(opts.restrict), keyOpts.Restrict...)
+	if len(restrict) > 0 {
+		destinations, err := ssh.ParseDestinations(restrict, ssh.DefaultKnownHostsFiles())
+		if err != nil {
+			return keyConstraints{}, fmt.Errorf("invalid destination restriction for %s: %w", path, err)
+		}
+		constraints.destinations = destinations
 	}
 
+	return constraints, nil
+}
+
+// loadPaths adds the keys at paths to the agent
+func loadPaths(paths []string, provider sm.Provider, cfg *config.Config, agent *ssh.Agent, opts *loadOptions, maxAge time.Duration) error {
+	for _, path := range paths {
+		constraints, err := resolveKeyConstraints(path, opts, cfg)
+		if err != nil {
+			return err
+		}
+		if err := loadAndAddKey(path, provider, cfg, agent, constraints); err != nil {
+			return err
+		}
+		warnKeyAge(provider, path, maxAge, time.Now())
+	}
+	return nil
+}
+
+// connectAgent connects to ssh-agent, returning a function that closes the connection
+func connectAgent(cfg *config.Config) (*ssh.Agent, func(), error) {
 	agent, err := ssh.NewAgent(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
 	}
-	defer func() {
+	return agent, func() {
 		if cerr := agent.Close(); cerr != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to close ssh-agent: %v\n", cerr)
 		}
-	}()
+	}, nil
+}
 
-	for _, path := range paths {
-		if err := loadAndAddKey(path, provider, agent); err != nil {
+// Load retrieves SSH keys from the secret manager and adds them to ssh-agent
+func Load(provider sm.Provider, cfg *config.Config, args []string) error {
+	opts, err := parseLoadArgs(args, cfg)
+	if err != nil {
+		return err
+	}
+	if opts.allProfiles {
+		return LoadAllProfiles(cfg, args)
+	}
+
+	maxAge, err := cfg.GetMaxKeyAge()
+	if err != nil {
+		return err
+	}
+
+	agent, closeAgent, err := connectAgent(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	return loadPaths(opts.paths, provider, cfg, agent, opts, maxAge)
+}
+
+// LoadAllProfiles loads the configured paths of every profile, each from the secret manager of
+// its profile, for load --all-profiles
+func LoadAllProfiles(cfg *config.Config, args []string) error {
+	opts, err := parseLoadArgs(args, cfg)
+	if err != nil {
+		return err
+	}
+	if !opts.allProfiles {
+		return fmt.Errorf("--all-profiles is required\n%s", loadUsage)
+	}
+
+	providers, err := sm.InitProviders(cfg)
+	if err != nil {
+		return err
+	}
+	return loadProfiles(providers, cfg, opts)
+}
+
+// loadProfiles implements LoadAllProfiles with a provider per profile
+func loadProfiles(providers map[string]sm.Provider, cfg *config.Config, opts *loadOptions) error {
+	maxAge, err := cfg.GetMaxKeyAge()
+	if err != nil {
+		return err
+	}
+
+	agent, closeAgent, err := connectAgent(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	for _, name := range cfg.ProfileNames() {
+		profile, err := cfg.WithProfile(name)
+		if err != nil {
 			return err
 		}
+		if len(profile.GetPaths()) == 0 {
+			fmt.Fprintf(os.Stdout, "Profile %s has no paths configured\n", name)
+			continue
+		}
+		if err := loadPaths(profile.GetPaths(), providers[name], profile, agent, opts, maxAge); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
 	}
-
 	return nil
 }
@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 	"github.com/codeignus/sm-ssh-add/internal/sm"
@@ -93,3 +96,153 @@ func TestLoadUnknownFlag(t *testing.T) {
 		t.Error("expected error for unknown flag, got nil")
 	}
 }
+
+// TestParseLoadArgs_Confirm tests the --confirm flag with direct and configured paths
+func TestParseLoadArgs_Confirm(t *testing.T) {
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+		VaultPaths:      []string{"secret/ssh/a", "secret/ssh/b"},
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantPaths   int
+		wantConfirm bool
+	}{
+		{name: "direct path", args: []string{"secret/ssh/a"}, wantPaths: 1},
+		{name: "confirm before path", args: []string{"--confirm", "secret/ssh/a"}, wantPaths: 1, wantConfirm: true},
+		{name: "confirm after path", args: []string{"secret/ssh/a", "--confirm"}, wantPaths: 1, wantConfirm: true},
+		{name: "confirm from config", args: []string{"--confirm", "--from-config"}, wantPaths: 2, wantConfirm: true},
+		{name: "multiple paths", args: []string{"secret/ssh/a", "secret/ssh/b"}, wantPaths: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseLoadArgs(tt.args, cfg)
+			if err != nil {
+				t.Fatalf("parseLoadArgs() error = %v", err)
+			}
+			if len(opts.paths) != tt.wantPaths {
+				t.Errorf("paths = %v, want %d paths", opts.paths, tt.wantPaths)
+			}
+			if opts.confirm != tt.wantConfirm {
+				t.Errorf("confirm = %v, want %v", opts.confirm, tt.wantConfirm)
+			}
+		})
+	}
+}
+
+// TestParseLoadArgs_OnlyFlags tests error when flags are given without a path
+func TestParseLoadArgs_OnlyFlags(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+
+	_, err := parseLoadArgs([]string{"--confirm"}, cfg)
+	if err == nil {
+		t.Error("expected error when no path provided, got nil")
+	}
+}
+
+// TestParseLoadArgs_Restrict tests the --restrict flag forms
+func TestParseLoadArgs_Restrict(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "separate value", args: []string{"--restrict", "host1,host2", "secret/ssh/a"}, want: []string{"host1", "host2"}},
+		{name: "inline value", args: []string{"secret/ssh/a", "--restrict=git@github.com"}, want: []string{"git@github.com"}},
+		{name: "repeated flag", args: []string{"--restrict", "host1", "--restrict", " host2 ,", "secret/ssh/a"}, want: []string{"host1", "host2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseLoadArgs(tt.args, cfg)
+			if err != nil {
+				t.Fatalf("parseLoadArgs() error = %v", err)
+			}
+			if !slices.Equal(opts.restrict, tt.want) {
+				t.Errorf("restrict = %v, want %v", opts.restrict, tt.want)
+			}
+			if len(opts.paths) != 1 || opts.paths[0] != "secret/ssh/a" {
+				t.Errorf("paths = %v, want [secret/ssh/a]", opts.paths)
+			}
+		})
+	}
+
+	if _, err := parseLoadArgs([]string{"secret/ssh/a", "--restrict"}, cfg); err == nil {
+		t.Error("expected error for --restrict without value, got nil")
+	}
+}
+
+func TestParseLoadArgs_AllProfiles(t *testing.T) {
+	cfg := &config.Config{Profiles: map[string]*config.Profile{"work": {Provider: config.ProviderVault}}}
+
+	opts, err := parseLoadArgs([]string{"--all-profiles", "--confirm"}, cfg)
+	if err != nil {
+		t.Fatalf("parseLoadArgs failed: %v", err)
+	}
+	if !opts.allProfiles || !opts.confirm || len(opts.paths) != 0 {
+		t.Errorf("opts = %+v, want all profiles with confirm", opts)
+	}
+
+	for _, args := range [][]string{{"--all-profiles", "--from-config"}, {"--all-profiles", "secret/ssh/a"}} {
+		if _, err := parseLoadArgs(args, cfg); err == nil {
+			t.Errorf("parseLoadArgs(%v): expected error, got nil", args)
+		}
+	}
+	if _, err := parseLoadArgs([]string{"--all-profiles"}, &config.Config{}); err == nil {
+		t.Error("expected error without profiles, got nil")
+	}
+}
+
+func TestLoadProfiles_loads_every_profile(t *testing.T) {
+	keyring := serveTestAgent(t)
+	personal, work := newMemoryProvider(), newMemoryProvider()
+	personal.addGeneratedKey(t, "kv/data/ssh/github", "")
+	work.addGeneratedKey(t, "secret/data/ssh/prod", "")
+
+	cfg := &config.Config{Profiles: map[string]*config.Profile{
+		"personal": {Provider: config.ProviderVault, VaultPaths: []string{"kv/data/ssh/github"}},
+		"work":     {Provider: config.ProviderVault, VaultPaths: []string{"secret/data/ssh/prod"}},
+		"empty":    {Provider: config.ProviderVault},
+	}}
+	providers := map[string]sm.Provider{"personal": personal, "work": work, "empty": newMemoryProvider()}
+
+	if err := loadProfiles(providers, cfg, &loadOptions{allProfiles: true}); err != nil {
+		t.Fatalf("loadProfiles failed: %v", err)
+	}
+	keys, err := keyring.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("agent has %d keys, want one per profile with paths", len(keys))
+	}
+
+	// Keys are read from the provider of their own profile
+	providers["personal"] = work
+	if err := loadProfiles(providers, cfg, &loadOptions{allProfiles: true}); err == nil || !strings.Contains(err.Error(), "profile personal") {
+		t.Errorf("loadProfiles = %v, want an error for the personal profile", err)
+	}
+}
+
+func TestLoadWarnsAboutOldKeysByDefault(t *testing.T) {
+	serveTestAgent(t)
+	provider := newMemoryProvider()
+	provider.addGeneratedKey(t, "secret/ssh/old", "")
+	provider.created["secret/ssh/old"] = time.Now().Add(-config.DefaultMaxKeyAge - 24*time.Hour)
+
+	// Without max_key_age, load uses the same default as stale
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+	stderr := captureStderr(t, func() {
+		if err := Load(provider, cfg, []string{"secret/ssh/old"}); err != nil {
+			t.Errorf("Load failed: %v", err)
+		}
+	})
+	if !strings.Contains(stderr, "key at secret/ssh/old is 91 days old and overdue for rotation") {
+		t.Errorf("stderr = %q, want a warning about the old key", stderr)
+	}
+}
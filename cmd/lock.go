@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/screenlock"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// readLockPassphrase asks for the agent lock passphrase, twice if confirm is set
+func readLockPassphrase(confirm bool) ([]byte, error) {
+	passphrase1, err := readSecret("Enter lock passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		passphrase2, err := readSecret("Enter same passphrase again: ")
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(passphrase1, passphrase2) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return passphrase1, nil
+}
+
+// withAgent connects to ssh-agent, runs fn and closes the connection
+func withAgent(cfg *config.Config, fn func(agent *ssh.Agent) error) error {
+	agent, err := ssh.NewAgent(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	defer func() {
+		if cerr := agent.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close ssh-agent: %v\n", cerr)
+		}
+	}()
+
+	return fn(agent)
+}
+
+// Lock locks ssh-agent with a passphrase, making its keys unusable without removing them
+func Lock(cfg *config.Config, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments\nusage: sm-ssh-add lock")
+	}
+
+	passphrase, err := readLockPassphrase(true)
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	err = withAgent(cfg, func(agent *ssh.Agent) error {
+		return agent.Lock(passphrase)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, "Agent locked")
+	return nil
+}
+
+// Unlock unlocks ssh-agent with the passphrase it was locked with
+func Unlock(cfg *config.Config, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments\nusage: sm-ssh-add unlock")
+	}
+
+	passphrase, err := readLockPassphrase(false)
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	err = withAgent(cfg, func(agent *ssh.Agent) error {
+		return agent.Unlock(passphrase)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, "Agent unlocked")
+	return nil
+}
+
+// autoLockOptions holds the flags of the agent and proxy commands that lock them automatically
+type autoLockOptions struct {
+	lockAfter    time.Duration // lock after this long without a signature request, 0 to disable
+	onScreenLock bool          // lock when the screen is locked
+}
+
+// autoLockUsage describes the auto-lock flags in usage messages
+const autoLockUsage = "[--lock-after <duration>] [--lock-on-screen-lock]"
+
+// parseFlag parses the auto-lock flag at args[*i], if it is one
+func (o *autoLockOptions) parseFlag(args []string, i *int) (ok bool, err error) {
+	if args[*i] == "--lock-on-screen-lock" {
+		o.onScreenLock = true
+		return true, nil
+	}
+
+	value, ok, err := flagValue(args, i, "--lock-after")
+	if !ok || err != nil {
+		return ok, err
+	}
+	lockAfter, err := time.ParseDuration(value)
+	if err != nil || lockAfter <= 0 {
+		return true, fmt.Errorf("invalid --lock-after %q: must be a duration such as 15m", value)
+	}
+	o.lockAfter = lockAfter
+	return true, nil
+}
+
+// startAutoLock asks for the passphrase that unlocks the agent after it was locked automatically
+// and locks it in the background until ctx is cancelled. It does nothing without auto-lock flags.
+func startAutoLock(ctx context.Context, a ssh.Lockable, opts autoLockOptions) error {
+	if opts.lockAfter == 0 && !opts.onScreenLock {
+		return nil
+	}
+
+	var screenLocked <-chan struct{}
+	if opts.onScreenLock {
+		var err error
+		if screenLocked, err = screenlock.Watch(ctx); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "The agent locks itself automatically; unlock it with sm-ssh-add unlock and this passphrase")
+	passphrase, err := readLockPassphrase(true)
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	go ssh.AutoLock(ctx, a, passphrase, opts.lockAfter, screenLocked, func(reason string) {
+		fmt.Fprintf(os.Stderr, "Agent locked: %s\n", reason)
+	})
+	return nil
+}
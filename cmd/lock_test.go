@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+// TestLockTooManyArguments tests that lock and unlock take no arguments
+func TestLockTooManyArguments(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+
+	if err := Lock(cfg, []string{"extra"}); err == nil {
+		t.Error("expected error for lock with arguments, got nil")
+	}
+	if err := Unlock(cfg, []string{"extra"}); err == nil {
+		t.Error("expected error for unlock with arguments, got nil")
+	}
+}
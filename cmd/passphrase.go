@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/prompt"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+)
+
+// readSecret asks the user for a passphrase without echoing it
+var readSecret = prompt.Password
+
+// passphrasePath returns the secret holding the passphrase of the key at path, preferring the
+// key options in the config over the path stored with the key
+func passphrasePath(cfg *config.Config, path string, keyValue *sm.KeyValue) string {
+	if p := cfg.GetKeyOptions(path).PassphrasePath; p != "" {
+		return p
+	}
+	return keyValue.PassphrasePath
+}
+
+// readSecretPassphrase reads a passphrase stored in a separate secret
+func readSecretPassphrase(provider sm.Provider, passphrasePath string) ([]byte, error) {
+	reader, ok := provider.(sm.PassphraseReader)
+	if !ok {
+		return nil, fmt.Errorf("secret manager cannot read passphrases from %s", passphrasePath)
+	}
+	passphrase, err := reader.GetPassphrase(passphrasePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase from %s: %w", passphrasePath, err)
+	}
+	return passphrase, nil
+}
+
+// keyPassphrase returns the passphrase of the key stored at path, or nil if the key is not
+// encrypted. The passphrase is read from its passphrase path if one is set, otherwise the user
+// is prompted.
+func keyPassphrase(provider sm.Provider, cfg *config.Config, path string, keyValue *sm.KeyValue) ([]byte, error) {
+	if !keyValue.RequirePassphrase {
+		return nil, nil
+	}
+	if p := passphrasePath(cfg, path, keyValue); p != "" {
+		return readSecretPassphrase(provider, p)
+	}
+	return promptKeyPassphrase(path)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+)
+
+// TestMain keeps tests from prompting on the terminal of whoever runs them
+func TestMain(m *testing.M) {
+	readSecret = func(prompt string) ([]byte, error) {
+		return nil, errors.New("unexpected prompt: " + prompt)
+	}
+	// Tests choose the config location through HOME, and don't see the machine's system config
+	os.Unsetenv("SM_SSH_ADD_CONFIG")
+	os.Unsetenv("SM_SSH_ADD_PROFILE")
+	os.Unsetenv("XDG_CONFIG_HOME")
+	config.SystemPath = filepath.Join(os.TempDir(), "sm-ssh-add-test-missing", "config.json")
+	os.Exit(m.Run())
+}
+
+// withAnswers makes passphrase prompts return answers in order for the duration of the test
+func withAnswers(t *testing.T, answers ...string) {
+	t.Helper()
+	read := readSecret
+	readSecret = func(prompt string) ([]byte, error) {
+		if len(answers) == 0 {
+			return nil, errors.New("unexpected prompt: " + prompt)
+		}
+		answer := answers[0]
+		answers = answers[1:]
+		return []byte(answer), nil
+	}
+	t.Cleanup(func() { readSecret = read })
+}
+
+func TestKeyPassphraseFromSecret(t *testing.T) {
+	provider := newMemoryProvider()
+	provider.passphrases["secret/ssh/passphrases/a"] = []byte("stored")
+	provider.passphrases["secret/ssh/passphrases/override"] = []byte("override")
+
+	encrypted := &sm.KeyValue{RequirePassphrase: true, PassphrasePath: "secret/ssh/passphrases/a"}
+	cfg := &config.Config{}
+
+	passphrase, err := keyPassphrase(provider, cfg, "secret/ssh/a", encrypted)
+	if err != nil {
+		t.Fatalf("keyPassphrase failed: %v", err)
+	}
+	if string(passphrase) != "stored" {
+		t.Errorf("passphrase = %q, want %q", passphrase, "stored")
+	}
+
+	// The config overrides the path stored with the key
+	cfg.KeyOptions = map[string]config.KeyOptions{
+		"secret/ssh/a": {PassphrasePath: "secret/ssh/passphrases/override"},
+	}
+	passphrase, err = keyPassphrase(provider, cfg, "secret/ssh/a", encrypted)
+	if err != nil {
+		t.Fatalf("keyPassphrase failed: %v", err)
+	}
+	if string(passphrase) != "override" {
+		t.Errorf("passphrase = %q, want %q", passphrase, "override")
+	}
+
+	// Unencrypted keys have no passphrase, even with a passphrase path
+	passphrase, err = keyPassphrase(provider, cfg, "secret/ssh/a", &sm.KeyValue{PassphrasePath: "secret/ssh/passphrases/a"})
+	if err != nil || passphrase != nil {
+		t.Errorf("keyPassphrase of unencrypted key = %q, %v, want nil, nil", passphrase, err)
+	}
+}
+
+func TestKeyPassphraseErrors(t *testing.T) {
+	encrypted := &sm.KeyValue{RequirePassphrase: true, PassphrasePath: "secret/ssh/passphrases/missing"}
+
+	if _, err := keyPassphrase(newMemoryProvider(), &config.Config{}, "secret/ssh/a", encrypted); !errors.Is(err, sm.ErrPathNotFound) {
+		t.Errorf("expected ErrPathNotFound for missing passphrase secret, got %v", err)
+	}
+	if _, err := keyPassphrase(&mockProvider{}, &config.Config{}, "secret/ssh/a", encrypted); err == nil {
+		t.Error("expected error for provider without passphrase support, got nil")
+	}
+}
+
+func TestKeyPassphrasePrompt(t *testing.T) {
+	withAnswers(t, "pass phrase with spaces")
+
+	passphrase, err := keyPassphrase(newMemoryProvider(), &config.Config{}, "secret/ssh/a", &sm.KeyValue{RequirePassphrase: true})
+	if err != nil {
+		t.Fatalf("keyPassphrase failed: %v", err)
+	}
+	if string(passphrase) != "pass phrase with spaces" {
+		t.Errorf("passphrase = %q, want %q", passphrase, "pass phrase with spaces")
+	}
+}
+
+func TestReadPassphraseConfirmation(t *testing.T) {
+	withAnswers(t, "secret", "secret", "secret", "other", "", "", "")
+	policy := config.PassphrasePolicy{}
+
+	if passphrase, err := readPassphrase(policy, false); err != nil || string(passphrase) != "secret" {
+		t.Errorf("readPassphrase = %q, %v, want %q", passphrase, err, "secret")
+	}
+	if _, err := readPassphrase(policy, false); err == nil {
+		t.Error("expected error for mismatched passphrases, got nil")
+	}
+	if passphrase, err := readPassphrase(policy, true); err != nil || len(passphrase) != 0 {
+		t.Errorf("readPassphrase = %q, %v, want empty passphrase", passphrase, err)
+	}
+	if _, err := readPassphrase(policy, false); err == nil {
+		t.Error("expected error for empty required passphrase, got nil")
+	}
+}
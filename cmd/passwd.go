@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// passwdUsage is the usage message of the passwd command
+const passwdUsage = "usage: sm-ssh-add passwd <path>"
+
+// Passwd changes or removes the passphrase of a stored key without changing the key itself.
+// The re-encrypted key is stored as a new version of the secret. A key that reads its passphrase
+// from a passphrase path gets the new passphrase written there first, so the two stay in sync.
+func Passwd(provider sm.Provider, cfg *config.Config, args []string) error {
+	if len(args) != 1 || len(args[0]) == 0 || args[0][0] == '-' {
+		return fmt.Errorf("%s", passwdUsage)
+	}
+	path := args[0]
+
+	keyValue, err := provider.Get(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key from %s: %w", path, err)
+	}
+	defer clear(keyValue.PrivateKey)
+
+	keyPair := &ssh.KeyPair{
+		PrivateKey: keyValue.PrivateKey,
+		PublicKey:  keyValue.PublicKey,
+		Comment:    keyValue.Comment,
+	}
+
+	var oldPassphrase []byte
+	if keyValue.RequirePassphrase {
+		oldPassphrase, err = keyPassphrase(provider, cfg, path, keyValue)
+		if err != nil {
+			return fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		p := string(oldPassphrase)
+		keyPair.Passphrase = &p
+	}
+
+	newPassphrase, err := readPassphrase(cfg.PassphrasePolicy, true)
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	privateKey, err := ssh.ChangePassphrase(keyPair, newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	kv := *keyValue
+	kv.PrivateKey = privateKey
+	kv.RequirePassphrase = len(newPassphrase) > 0
+
+	// The passphrase secret is written before the key, so a secret manager that cannot store it
+	// leaves the key unchanged
+	secretPath := passphrasePath(cfg, path, keyValue)
+	if secretPath != "" && kv.RequirePassphrase {
+		if err := storeSecretPassphrase(provider, secretPath, newPassphrase); err != nil {
+			return err
+		}
+	}
+
+	if err := storeKey(provider, path, &kv); err != nil {
+		// Restore the old passphrase, which still decrypts the stored key
+		if secretPath != "" && kv.RequirePassphrase && oldPassphrase != nil {
+			if rerr := storeSecretPassphrase(provider, secretPath, oldPassphrase); rerr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v; the key at %s is still encrypted with its old passphrase\n", rerr, path)
+			}
+		}
+		return err
+	}
+
+	if kv.RequirePassphrase {
+		fmt.Fprintf(os.Stdout, "Passphrase of key at %s changed\n", path)
+	} else {
+		fmt.Fprintf(os.Stdout, "Passphrase of key at %s removed\n", path)
+	}
+	if secretPath != "" && kv.RequirePassphrase {
+		fmt.Fprintf(os.Stdout, "Passphrase stored in %s\n", secretPath)
+	}
+	return nil
+}
+
+// storeSecretPassphrase writes a key passphrase to the separate secret it is read from
+func storeSecretPassphrase(provider sm.Provider, passphrasePath string, passphrase []byte) error {
+	writer, ok := provider.(sm.PassphraseWriter)
+	if !ok {
+		return fmt.Errorf("secret manager cannot store the passphrase in %s", passphrasePath)
+	}
+	if err := writer.StorePassphrase(passphrasePath, passphrase); err != nil {
+		return fmt.Errorf("failed to store passphrase in %s: %w", passphrasePath, err)
+	}
+	return nil
+}
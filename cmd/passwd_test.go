@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+func TestPasswdUsage(t *testing.T) {
+	provider := newMemoryProvider()
+	for _, args := range [][]string{{}, {"--all"}, {"secret/ssh/a", "secret/ssh/b"}} {
+		if err := Passwd(provider, &config.Config{}, args); err == nil {
+			t.Errorf("Passwd(%q) expected error, got nil", args)
+		}
+	}
+}
+
+func TestPasswdChangeAndRemove(t *testing.T) {
+	provider := newMemoryProvider()
+	keyPair := provider.addGeneratedKey(t, "secret/ssh/a", "a@example.com")
+
+	// Add a passphrase to an unencrypted key
+	withAnswers(t, "first-passphrase", "first-passphrase")
+	if err := Passwd(provider, &config.Config{}, []string{"secret/ssh/a"}); err != nil {
+		t.Fatalf("Passwd failed: %v", err)
+	}
+	kv, _ := provider.Get("secret/ssh/a")
+	if !kv.RequirePassphrase {
+		t.Error("RequirePassphrase should be set")
+	}
+	if string(kv.PublicKey) != string(keyPair.PublicKey) || kv.Comment != "a@example.com" {
+		t.Error("public key and comment should be kept")
+	}
+	passphrase := "first-passphrase"
+	if _, err := ssh.ExportKeyPair(&ssh.KeyPair{PrivateKey: kv.PrivateKey, Passphrase: &passphrase}, ssh.FormatOpenSSH, nil); err != nil {
+		t.Errorf("key should decrypt with the new passphrase: %v", err)
+	}
+
+	// A wrong old passphrase leaves the key untouched
+	withAnswers(t, "wrong", "second", "second")
+	if err := Passwd(provider, &config.Config{}, []string{"secret/ssh/a"}); err == nil {
+		t.Fatal("expected error for wrong passphrase, got nil")
+	}
+	if unchanged, _ := provider.Get("secret/ssh/a"); string(unchanged.PrivateKey) != string(kv.PrivateKey) {
+		t.Error("key should not change after a failed passwd")
+	}
+
+	// Mismatched confirmation leaves the key untouched
+	withAnswers(t, "first-passphrase", "second", "third")
+	if err := Passwd(provider, &config.Config{}, []string{"secret/ssh/a"}); err == nil {
+		t.Fatal("expected error for mismatched passphrases, got nil")
+	}
+
+	// An empty new passphrase removes it
+	withAnswers(t, "first-passphrase", "", "")
+	if err := Passwd(provider, &config.Config{}, []string{"secret/ssh/a"}); err != nil {
+		t.Fatalf("Passwd failed: %v", err)
+	}
+	kv, _ = provider.Get("secret/ssh/a")
+	if kv.RequirePassphrase {
+		t.Error("RequirePassphrase should be cleared")
+	}
+	if _, err := ssh.ExportKeyPair(&ssh.KeyPair{PrivateKey: kv.PrivateKey}, ssh.FormatOpenSSH, nil); err != nil {
+		t.Errorf("key should be stored unencrypted: %v", err)
+	}
+}
+
+func TestPasswdMissingPath(t *testing.T) {
+	provider := newMemoryProvider()
+	if err := Passwd(provider, &config.Config{}, []string{"secret/ssh/missing"}); err == nil {
+		t.Error("expected error for missing path, got nil")
+	}
+	if _, err := provider.Get("secret/ssh/missing"); err != sm.ErrPathNotFound {
+		t.Errorf("nothing should be stored, got %v", err)
+	}
+}
+
+// passphraseReadOnlyProvider reads passphrase secrets but cannot write them
+type passphraseReadOnlyProvider struct {
+	sm.Provider
+	sm.PassphraseReader
+}
+
+func TestPasswdUpdatesPassphraseSecret(t *testing.T) {
+	provider := newMemoryProvider()
+	old := "old-passphrase"
+	keyPair, err := ssh.GenerateKeyPair("a@example.com", []byte(old))
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	provider.keys["secret/ssh/a"] = &sm.KeyValue{
+		PrivateKey:        keyPair.PrivateKey,
+		PublicKey:         keyPair.PublicKey,
+		RequirePassphrase: true,
+		PassphrasePath:    "secret/ssh/a-passphrase",
+	}
+	provider.passphrases["secret/ssh/a-passphrase"] = []byte(old)
+
+	// Without a way to write the passphrase secret the key is left alone
+	readOnly := passphraseReadOnlyProvider{provider, provider}
+	withAnswers(t, "new-passphrase", "new-passphrase")
+	if err := Passwd(readOnly, &config.Config{}, []string{"secret/ssh/a"}); err == nil {
+		t.Fatal("expected error when the passphrase secret cannot be written, got nil")
+	}
+	if kv, _ := provider.Get("secret/ssh/a"); string(kv.PrivateKey) != string(keyPair.PrivateKey) {
+		t.Error("key should not change when the passphrase secret cannot be written")
+	}
+
+	// The old passphrase is read from the secret and the new one written to it
+	withAnswers(t, "new-passphrase", "new-passphrase")
+	if err := Passwd(provider, &config.Config{}, []string{"secret/ssh/a"}); err != nil {
+		t.Fatalf("Passwd failed: %v", err)
+	}
+	if got := string(provider.passphrases["secret/ssh/a-passphrase"]); got != "new-passphrase" {
+		t.Errorf("passphrase secret = %q, want new-passphrase", got)
+	}
+	kv, _ := provider.Get("secret/ssh/a")
+	passphrase := "new-passphrase"
+	if _, err := ssh.ExportKeyPair(&ssh.KeyPair{PrivateKey: kv.PrivateKey, Passphrase: &passphrase}, ssh.FormatOpenSSH, nil); err != nil {
+		t.Errorf("key should decrypt with the passphrase in the secret: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+// estimateEntropy gives a rough entropy estimate in bits from the length of the passphrase and
+// the character classes it uses. It overestimates dictionary words and patterns.
+func estimateEntropy(passphrase string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range passphrase {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(utf8.RuneCountInString(passphrase)) * math.Log2(float64(pool))
+}
+
+// inBreachList reports whether the passphrase is listed in the file, either in plain text or as a
+// SHA-1 hash. Lines in the "HASH:count" format of downloaded breach corpora are accepted.
+func inBreachList(file string, passphrase string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, fmt.Errorf("failed to open breach list: %w", err)
+	}
+	defer f.Close()
+
+	digest := sha1.Sum([]byte(passphrase))
+	hash := hex.EncodeToString(digest[:])
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == passphrase {
+			return true, nil
+		}
+		if h, _, _ := strings.Cut(line, ":"); len(h) == len(hash) && strings.EqualFold(h, hash) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breach list: %w", err)
+	}
+	return false, nil
+}
+
+// checkPassphrase checks a new, non-empty passphrase against the policy
+func checkPassphrase(policy config.PassphrasePolicy, passphrase []byte) error {
+	if n := utf8.RuneCount(passphrase); n < policy.MinLength {
+		return fmt.Errorf("passphrase is too short: %d characters, policy requires at least %d", n, policy.MinLength)
+	}
+
+	if policy.MinEntropy > 0 {
+		if bits := estimateEntropy(string(passphrase)); bits < policy.MinEntropy {
+			return fmt.Errorf("passphrase is too weak: estimated %.0f bits of entropy, policy requires at least %.0f (use a longer passphrase or more kinds of characters)", bits, policy.MinEntropy)
+		}
+	}
+
+	if policy.BreachList != "" {
+		breached, err := inBreachList(policy.BreachList, string(passphrase))
+		if err != nil {
+			return err
+		}
+		if breached {
+			return fmt.Errorf("passphrase appears in the breach list %s, choose another one", policy.BreachList)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+func TestEstimateEntropy(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		min, max   float64
+	}{
+		{"", 0, 0},
+		{"aaaaaaaa", 37, 38},      // 8 * log2(26)
+		{"aA1!aA1!", 52, 53},      // 8 * log2(95)
+		{"correct horse", 76, 77}, // 13 * log2(59)
+	}
+	for _, tt := range tests {
+		if got := estimateEntropy(tt.passphrase); got < tt.min || got > tt.max {
+			t.Errorf("estimateEntropy(%q) = %.1f, want between %.0f and %.0f", tt.passphrase, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestCheckPassphrase(t *testing.T) {
+	breachList := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breachList, []byte("123456\r\npassword1\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := config.PassphrasePolicy{MinLength: 8, MinEntropy: 40, BreachList: breachList}
+	tests := []struct {
+		passphrase string
+		wantErr    string
+	}{
+		{"short", "too short"},
+		{"aaaaaaaa", "too weak"},
+		{"password1", "breach list"},
+		{"a-Good-passphrase", ""},
+	}
+	for _, tt := range tests {
+		err := checkPassphrase(policy, []byte(tt.passphrase))
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkPassphrase(%q) = %v, want nil", tt.passphrase, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("checkPassphrase(%q) = %v, want error containing %q", tt.passphrase, err, tt.wantErr)
+		}
+	}
+
+	if err := checkPassphrase(config.PassphrasePolicy{}, []byte("x")); err != nil {
+		t.Errorf("empty policy should accept any passphrase, got %v", err)
+	}
+	if err := checkPassphrase(config.PassphrasePolicy{BreachList: filepath.Join(t.TempDir(), "missing")}, []byte("x")); err == nil {
+		t.Error("expected error for missing breach list, got nil")
+	}
+}
+
+func TestInBreachListHash(t *testing.T) {
+	breachList := filepath.Join(t.TempDir(), "breached.txt")
+	// SHA-1 of "hunter2", uppercase as in downloaded corpora
+	if err := os.WriteFile(breachList, []byte("F3BBBD66A63D4BF1747940578EC3D0103530E21D:17\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if breached, err := inBreachList(breachList, "hunter2"); err != nil || !breached {
+		t.Errorf("inBreachList(hunter2) = %v, %v, want true", breached, err)
+	}
+	if breached, err := inBreachList(breachList, "hunter3"); err != nil || breached {
+		t.Errorf("inBreachList(hunter3) = %v, %v, want false", breached, err)
+	}
+}
+
+func TestPasswdRejectsWeakPassphrase(t *testing.T) {
+	provider := newMemoryProvider()
+	provider.addGeneratedKey(t, "secret/ssh/a", "a@example.com")
+	cfg := &config.Config{PassphrasePolicy: config.PassphrasePolicy{MinLength: 12}}
+
+	withAnswers(t, "short", "short")
+	if err := Passwd(provider, cfg, []string{"secret/ssh/a"}); err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Errorf("Passwd with weak passphrase = %v, want too short error", err)
+	}
+	if kv, _ := provider.Get("secret/ssh/a"); kv.RequirePassphrase {
+		t.Error("key should be unchanged after a rejected passphrase")
+	}
+}
+
+func TestGenerateRejectsEmptyRequiredPassphrase(t *testing.T) {
+	withAnswers(t, "")
+	err := Generate(&mockProvider{}, &config.Config{}, []string{"--require-passphrase", "secret/ssh/a"})
+	if err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Errorf("Generate with empty passphrase = %v, want cannot be empty error", err)
+	}
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// proxyUsage is the usage message of the proxy command
+const proxyUsage = "usage: sm-ssh-add proxy [--socket <path>] [--log <file>] " + autoLockUsage + " [<path>...]"
+
+// proxyOptions holds the parsed arguments of the proxy command
+type proxyOptions struct {
+	paths      []string
+	socketPath string
+	autoLock   autoLockOptions
+	logFile    string
+}
+
+// parseProxyArgs parses command line arguments of the proxy command.
+// Without paths, the proxy exposes all configured paths.
+func parseProxyArgs(args []string, cfg *config.Config) (*proxyOptions, error) {
+	opts := &proxyOptions{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) == 0 || arg[0] != '-' {
+			opts.paths = append(opts.paths, arg)
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--socket"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, proxyUsage)
+			}
+			opts.socketPath = value
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--log"); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, proxyUsage)
+			}
+			opts.logFile = value
+			continue
+		}
+
+		if ok, err := opts.autoLock.parseFlag(args, &i); ok {
+			if err != nil {
+				return nil, fmt.Errorf("%v\n%s", err, proxyUsage)
+			}
+			continue
+		}
+
+		return nil, fmt.Errorf("unknown flag: %s", arg)
+	}
+
+	if len(opts.paths) == 0 {
+		opts.paths = cfg.GetPaths()
+		if len(opts.paths) == 0 {
+			return nil, fmt.Errorf("no paths configured")
+		}
+	}
+
+	return opts, nil
+}
+
+// allowedFingerprints maps the fingerprints of the keys stored at paths to their path. Only the
+// published public keys are read, never the private keys.
+func allowedFingerprints(provider sm.Provider, paths []string) (map[string]string, error) {
+	reader, ok := provider.(sm.PublicKeyReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: reading published public keys", sm.ErrNotSupported)
+	}
+
+	allowed := make(map[string]string, len(paths))
+	for _, path := range paths {
+		keys, err := reader.GetPublicKey(path)
+		if errors.Is(err, sm.ErrPublicKeyNotPublished) {
+			return nil, fmt.Errorf("public key of %s is not published (run: sm-ssh-add pubkey --publish %s)", path, path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key from %s: %w", path, err)
+		}
+
+		fingerprint, err := ssh.Fingerprint(keys.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key at %s: %w", path, err)
+		}
+		allowed[fingerprint] = path
+
+		// The previous key of a rotation is loaded until its grace period expires
+		if keys.PreviousActive(time.Now()) {
+			fingerprint, err := ssh.Fingerprint(keys.Previous)
+			if err != nil {
+				return nil, fmt.Errorf("invalid previous public key at %s: %w", path, err)
+			}
+			allowed[fingerprint] = path
+		}
+	}
+	return allowed, nil
+}
+
+// Proxy runs an ssh-agent proxy in front of the agent at SSH_AUTH_SOCK. It only exposes keys
+// stored at the configured paths and logs every signature request.
+func Proxy(provider sm.Provider, cfg *config.Config, args []string) error {
+	opts, err := parseProxyArgs(args, cfg)
+	if err != nil {
+		return err
+	}
+
+	if opts.socketPath == "" {
+		socketPath, cleanup, err := ssh.DefaultSocketPath("sm-ssh-add-proxy")
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		opts.socketPath = socketPath
+	}
+	if opts.socketPath == os.Getenv("SSH_AUTH_SOCK") {
+		return fmt.Errorf("proxy socket %s is the upstream SSH_AUTH_SOCK", opts.socketPath)
+	}
+
+	allowed, err := allowedFingerprints(provider, opts.paths)
+	if err != nil {
+		return err
+	}
+
+	var auditLog io.Writer = os.Stderr
+	if opts.logFile != "" {
+		f, err := os.OpenFile(opts.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		defer f.Close()
+		auditLog = f
+	}
+
+	dial := func() (*ssh.Agent, error) {
+		return ssh.NewAgent(cfg)
+	}
+	// Check the upstream agent up front; clients get their own connections to it
+	upstream, err := dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	if err := upstream.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to close ssh-agent: %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	proxy := ssh.NewProxy(dial, allowed, auditLog)
+	if err := startAutoLock(ctx, proxy, opts.autoLock); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", opts.socketPath)
+	fmt.Fprintf(os.Stderr, "Proxying %d keys on %s\n", len(allowed), opts.socketPath)
+
+	return ssh.ListenAndServeConns(ctx, opts.socketPath, proxy.ServeConn)
+}
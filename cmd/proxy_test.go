@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// TestParseProxyArgs tests defaults and flags of the proxy command
+func TestParseProxyArgs(t *testing.T) {
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+		VaultPaths:      []string{"secret/ssh/a"},
+	}
+
+	opts, err := parseProxyArgs([]string{"--log", "/tmp/audit.log"}, cfg)
+	if err != nil {
+		t.Fatalf("parseProxyArgs() error = %v", err)
+	}
+	if !slices.Equal(opts.paths, cfg.VaultPaths) {
+		t.Errorf("paths = %v, want configured paths", opts.paths)
+	}
+	if opts.logFile != "/tmp/audit.log" {
+		t.Errorf("logFile = %q, want /tmp/audit.log", opts.logFile)
+	}
+
+	opts, err = parseProxyArgs([]string{"--lock-after=5m"}, cfg)
+	if err != nil {
+		t.Fatalf("parseProxyArgs() error = %v", err)
+	}
+	if opts.autoLock.lockAfter != 5*time.Minute {
+		t.Errorf("lockAfter = %s, want 5m", opts.autoLock.lockAfter)
+	}
+
+	if _, err := parseProxyArgs([]string{"--log"}, cfg); err == nil {
+		t.Error("expected error for --log without value, got nil")
+	}
+	if _, err := parseProxyArgs(nil, &config.Config{DefaultProvider: config.ProviderVault}); err == nil {
+		t.Error("expected error without configured paths, got nil")
+	}
+}
+
+// TestAllowedFingerprints tests mapping published public keys to their paths
+func TestAllowedFingerprints(t *testing.T) {
+	provider := newMemoryProvider()
+	keyPair := provider.addGeneratedKey(t, "secret/ssh/a", "a@test")
+	if err := publishStoredKey(provider, "secret/ssh/a"); err != nil {
+		t.Fatalf("publishStoredKey failed: %v", err)
+	}
+
+	// Private keys are never read
+	allowed, err := allowedFingerprints(publicOnlyProvider{provider}, []string{"secret/ssh/a"})
+	if err != nil {
+		t.Fatalf("allowedFingerprints() error = %v", err)
+	}
+	fingerprint, err := ssh.Fingerprint(keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+	if allowed[fingerprint] != "secret/ssh/a" {
+		t.Errorf("allowed = %v, want %s mapped to secret/ssh/a", allowed, fingerprint)
+	}
+
+	// The previous key of a rotation is allowed during its grace period
+	previous := provider.addGeneratedKey(t, "secret/ssh/old", "a@test")
+	provider.keys["secret/ssh/a"].Previous = provider.keys["secret/ssh/old"]
+	provider.keys["secret/ssh/a"].PreviousExpires = time.Now().Add(time.Hour)
+	if err := publishStoredKey(provider, "secret/ssh/a"); err != nil {
+		t.Fatalf("publishStoredKey failed: %v", err)
+	}
+	allowed, err = allowedFingerprints(publicOnlyProvider{provider}, []string{"secret/ssh/a"})
+	if err != nil {
+		t.Fatalf("allowedFingerprints() error = %v", err)
+	}
+	previousFingerprint, _ := ssh.Fingerprint(previous.PublicKey)
+	if allowed[previousFingerprint] != "secret/ssh/a" || allowed[fingerprint] != "secret/ssh/a" {
+		t.Errorf("allowed = %v, want current and previous key mapped to secret/ssh/a", allowed)
+	}
+
+	// Keys stored before publishing need to be published first
+	_, err = allowedFingerprints(provider, []string{"secret/ssh/old"})
+	if err == nil || !strings.Contains(err.Error(), "pubkey --publish secret/ssh/old") {
+		t.Errorf("allowedFingerprints() error = %v, want a hint to publish the key", err)
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// pubkeyUsage is the usage message of the pubkey command
+const pubkeyUsage = "usage: sm-ssh-add pubkey [--fingerprint[=sha256|md5] | --publish] <path>..."
+
+// storeKey stores a key and publishes its public keys where the provider supports it, so they can
+// be read without access to the private keys. Failing to publish is only a warning, since pubkey
+// --publish can publish them later.
+func storeKey(provider sm.Provider, path string, kv *sm.KeyValue) error {
+	if err := provider.Store(path, kv); err != nil {
+		return fmt.Errorf("failed to store key in vault: %w", err)
+	}
+
+	publisher, ok := provider.(sm.PublicKeyPublisher)
+	if !ok {
+		return nil
+	}
+	if err := publishPublicKeys(publisher, path, kv); err != nil && !errors.Is(err, sm.ErrNotSupported) {
+		fmt.Fprintf(os.Stderr, "Warning: failed to publish public key of %s: %v\n", path, err)
+	}
+	return nil
+}
+
+// publishPublicKeys publishes the public key of kv, and that of its previous key during a rotation
+func publishPublicKeys(publisher sm.PublicKeyPublisher, path string, kv *sm.KeyValue) error {
+	line, err := ssh.AuthorizedKey(kv.PublicKey, kv.Comment)
+	if err != nil {
+		return err
+	}
+	keys := &sm.PublicKeys{PublicKey: line}
+	if kv.Previous != nil {
+		keys.Previous, err = ssh.AuthorizedKey(kv.Previous.PublicKey, kv.Previous.Comment)
+		if err != nil {
+			return fmt.Errorf("invalid previous public key: %w", err)
+		}
+		keys.PreviousExpires = kv.PreviousExpires
+	}
+	return publisher.PublishPublicKey(path, keys)
+}
+
+// readPublicKey returns the authorized_keys line of the key at path. The published public key is
+// preferred, so the private key is only read for keys that were stored before keys were published.
+func readPublicKey(provider sm.Provider, path string) ([]byte, error) {
+	if reader, ok := provider.(sm.PublicKeyReader); ok {
+		if keys, err := reader.GetPublicKey(path); err == nil {
+			return keys.PublicKey, nil
+		}
+	}
+
+	keyValue, err := provider.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	clear(keyValue.PrivateKey)
+	return ssh.AuthorizedKey(keyValue.PublicKey, keyValue.Comment)
+}
+
+// publishStoredKey publishes the public keys of a key stored before keys were published
+func publishStoredKey(provider sm.Provider, path string) error {
+	publisher, ok := provider.(sm.PublicKeyPublisher)
+	if !ok {
+		return fmt.Errorf("%w: publishing public keys", sm.ErrNotSupported)
+	}
+	keyValue, err := provider.Get(path)
+	if err != nil {
+		return err
+	}
+	clear(keyValue.PrivateKey)
+	if keyValue.Previous != nil {
+		clear(keyValue.Previous.PrivateKey)
+	}
+	return publishPublicKeys(publisher, path, keyValue)
+}
+
+// Pubkey prints the public keys stored at the given paths, or their fingerprints
+func Pubkey(provider sm.Provider, cfg *config.Config, args []string) error {
+	return pubkey(provider, args, os.Stdout)
+}
+
+// pubkey implements Pubkey, writing to out
+func pubkey(provider sm.Provider, args []string, out io.Writer) error {
+	hash := ""
+	publish := false
+	var paths []string
+	for _, arg := range args {
+		switch {
+		case arg == "--publish":
+			publish = true
+		case arg == "--fingerprint":
+			hash = "sha256"
+		case strings.HasPrefix(arg, "--fingerprint="):
+			hash = strings.TrimPrefix(arg, "--fingerprint=")
+			if hash != "sha256" && hash != "md5" {
+				return fmt.Errorf("invalid --fingerprint %q: must be sha256 or md5", hash)
+			}
+		case len(arg) > 0 && arg[0] == '-':
+			return fmt.Errorf("unknown flag: %s", arg)
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("path is required\n%s", pubkeyUsage)
+	}
+	if publish && hash != "" {
+		return fmt.Errorf("--publish cannot be combined with --fingerprint\n%s", pubkeyUsage)
+	}
+
+	failed := 0
+	for _, path := range paths {
+		if publish {
+			if err := publishStoredKey(provider, path); err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "Failed to publish public key of %s: %v\n", path, err)
+				continue
+			}
+			fmt.Fprintf(out, "Published public key of %s\n", path)
+			continue
+		}
+
+		publicKey, err := readPublicKey(provider, path)
+		if err == nil && hash != "" {
+			var fingerprint string
+			if hash == "md5" {
+				fingerprint, err = ssh.FingerprintMD5(publicKey)
+			} else {
+				fingerprint, err = ssh.Fingerprint(publicKey)
+			}
+			publicKey = []byte(fmt.Sprintf("%s %s\n", fingerprint, path))
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Failed to read public key from %s: %v\n", path, err)
+			continue
+		}
+		if _, err := out.Write(publicKey); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 && publish {
+		return fmt.Errorf("%d public keys could not be published", failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d public keys could not be read", failed)
+	}
+	return nil
+}
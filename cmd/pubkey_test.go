@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// publicOnlyProvider can read published public keys but not the secrets holding private keys
+type publicOnlyProvider struct {
+	*memoryProvider
+}
+
+func (p publicOnlyProvider) Get(path string) (*sm.KeyValue, error) {
+	return nil, errors.New("permission denied")
+}
+
+func TestGeneratePublishesPublicKey(t *testing.T) {
+	provider := newMemoryProvider()
+	if err := Generate(provider, &config.Config{}, []string{"secret/ssh/a", "a@example.com"}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	kv, _ := provider.Get("secret/ssh/a")
+	want, _ := ssh.AuthorizedKey(kv.PublicKey, "a@example.com")
+	if published := provider.published["secret/ssh/a"]; published == nil || !bytes.Equal(published.PublicKey, want) {
+		t.Errorf("published = %+v, want %q", published, want)
+	}
+}
+
+func TestPubkeyReadsPublishedKey(t *testing.T) {
+	provider := newMemoryProvider()
+	keyPair := provider.addGeneratedKey(t, "secret/ssh/a", "a@example.com")
+	line, _ := ssh.AuthorizedKey(keyPair.PublicKey, "a@example.com")
+	provider.published["secret/ssh/a"] = &sm.PublicKeys{PublicKey: line}
+
+	// The private key is never read when the public key is published
+	var out bytes.Buffer
+	if err := pubkey(publicOnlyProvider{provider}, []string{"secret/ssh/a"}, &out); err != nil {
+		t.Fatalf("pubkey failed: %v", err)
+	}
+	if out.String() != string(line) {
+		t.Errorf("pubkey = %q, want %q", out.String(), line)
+	}
+
+	out.Reset()
+	if err := pubkey(publicOnlyProvider{provider}, []string{"--fingerprint=md5", "secret/ssh/a"}, &out); err != nil {
+		t.Fatalf("pubkey --fingerprint=md5 failed: %v", err)
+	}
+	md5, _ := ssh.FingerprintMD5(keyPair.PublicKey)
+	if out.String() != md5+" secret/ssh/a\n" {
+		t.Errorf("pubkey --fingerprint=md5 = %q, want %q", out.String(), md5+" secret/ssh/a\n")
+	}
+}
+
+func TestPubkeyFallsBackToSecret(t *testing.T) {
+	provider := newMemoryProvider()
+	a := provider.addGeneratedKey(t, "secret/ssh/a", "a@example.com")
+	b := provider.addGeneratedKey(t, "secret/ssh/b", "")
+
+	var out bytes.Buffer
+	if err := pubkey(provider, []string{"--fingerprint", "secret/ssh/a", "secret/ssh/b"}, &out); err != nil {
+		t.Fatalf("pubkey failed: %v", err)
+	}
+	fa, _ := ssh.Fingerprint(a.PublicKey)
+	fb, _ := ssh.Fingerprint(b.PublicKey)
+	if want := fa + " secret/ssh/a\n" + fb + " secret/ssh/b\n"; out.String() != want {
+		t.Errorf("pubkey --fingerprint = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := pubkey(provider, []string{"secret/ssh/a"}, &out); err != nil {
+		t.Fatalf("pubkey failed: %v", err)
+	}
+	if !strings.HasSuffix(out.String(), " a@example.com\n") {
+		t.Errorf("pubkey should include the comment, got %q", out.String())
+	}
+
+	// Missing keys are reported after printing the others
+	out.Reset()
+	err := pubkey(provider, []string{"secret/ssh/missing", "secret/ssh/b"}, &out)
+	if err == nil || !strings.Contains(out.String(), strings.TrimSpace(string(b.PublicKey))) {
+		t.Errorf("pubkey = %v, %q, want an error and the key of secret/ssh/b", err, out.String())
+	}
+}
+
+func TestPubkeyPublishesStoredKeys(t *testing.T) {
+	provider := newMemoryProvider()
+	a := provider.addGeneratedKey(t, "secret/ssh/a", "a@example.com")
+	old := provider.addGeneratedKey(t, "secret/ssh/old", "old@example.com")
+	provider.keys["secret/ssh/a"].Previous = provider.keys["secret/ssh/old"]
+	provider.keys["secret/ssh/a"].PreviousExpires = time.Now().Add(time.Hour)
+
+	var out bytes.Buffer
+	if err := pubkey(provider, []string{"--publish", "secret/ssh/a"}, &out); err != nil {
+		t.Fatalf("pubkey --publish failed: %v", err)
+	}
+
+	published := provider.published["secret/ssh/a"]
+	want, _ := ssh.AuthorizedKey(a.PublicKey, "a@example.com")
+	wantPrevious, _ := ssh.AuthorizedKey(old.PublicKey, "old@example.com")
+	if published == nil || !bytes.Equal(published.PublicKey, want) || !bytes.Equal(published.Previous, wantPrevious) {
+		t.Errorf("published = %+v, want %q with previous %q", published, want, wantPrevious)
+	}
+
+	if err := pubkey(provider, []string{"--publish", "secret/ssh/missing"}, &out); err == nil {
+		t.Error("pubkey --publish of a missing key expected error, got nil")
+	}
+}
+
+func TestPubkeyUsage(t *testing.T) {
+	for _, args := range [][]string{{}, {"--fingerprint"}, {"--fingerprint=sha1", "secret/ssh/a"}, {"--all"}, {"--publish", "--fingerprint", "secret/ssh/a"}} {
+		if err := pubkey(newMemoryProvider(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("pubkey(%q) expected error, got nil", args)
+		}
+	}
+}
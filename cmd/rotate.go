@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// rotateUsage is the usage message of the rotate command
+const rotateUsage = "usage: sm-ssh-add rotate [--grace <duration>] <path>"
+
+// parseRotateArgs parses command line arguments of the rotate command and returns the path and grace period
+func parseRotateArgs(args []string, cfg *config.Config) (string, time.Duration, error) {
+	path := ""
+	grace, err := cfg.GetRotationGrace()
+	if err != nil {
+		return "", 0, err
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) == 0 || arg[0] != '-' {
+			if path != "" {
+				return "", 0, fmt.Errorf("too many arguments\n%s", rotateUsage)
+			}
+			path = arg
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--grace"); ok {
+			if err != nil {
+				return "", 0, fmt.Errorf("%v\n%s", err, rotateUsage)
+			}
+			grace, err = config.ParseDuration(value)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid --grace %q: must be a duration such as 7d or 12h", value)
+			}
+			continue
+		}
+
+		return "", 0, fmt.Errorf("unknown flag: %s", arg)
+	}
+
+	if path == "" {
+		return "", 0, fmt.Errorf("path is required\n%s", rotateUsage)
+	}
+	return path, grace, nil
+}
+
+// Rotate replaces the key at path with a new key of the same type. The replaced key is kept as the
+// previous key and stays loadable for the grace period, so servers can be moved to the new public key.
+func Rotate(provider sm.Provider, cfg *config.Config, args []string) error {
+	return rotate(provider, cfg, args, os.Stdout, time.Now())
+}
+
+// rotate implements Rotate, writing the public keys to out
+func rotate(provider sm.Provider, cfg *config.Config, args []string, out io.Writer, now time.Time) error {
+	path, grace, err := parseRotateArgs(args, cfg)
+	if err != nil {
+		return err
+	}
+
+	current, err := provider.Get(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key from %s: %w", path, err)
+	}
+	defer clear(current.PrivateKey)
+
+	keyType, bits, err := ssh.PublicKeyType(current.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid key at %s: %w", path, err)
+	}
+
+	// The new key is protected the same way as the current one
+	var passphrase []byte
+	if current.RequirePassphrase {
+		if p := passphrasePath(cfg, path, current); p != "" {
+			passphrase, err = readSecretPassphrase(provider, p)
+			if err != nil {
+				return err
+			}
+		} else {
+			passphrase, err = readPassphrase(cfg.PassphrasePolicy, false)
+			if err != nil {
+				return fmt.Errorf("failed to read passphrase: %w", err)
+			}
+		}
+	}
+
+	keyPair, err := ssh.GenerateKeyPairOfType(keyType, bits, current.Comment, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to generate key pair: %w", err)
+	}
+
+	if current.PreviousActive(now) {
+		fmt.Fprintf(os.Stderr, "Warning: the previous key of %s, valid until %s, is replaced\n", path, current.PreviousExpires.Local().Format(time.DateTime))
+	}
+
+	kv := &sm.KeyValue{
+		PrivateKey:        keyPair.PrivateKey,
+		PublicKey:         keyPair.PublicKey,
+		RequirePassphrase: current.RequirePassphrase,
+		Comment:           current.Comment,
+		KeyType:           keyPair.KeyType,
+		PassphrasePath:    current.PassphrasePath,
+	}
+	if grace > 0 {
+		previous := *current
+		previous.PrivateKey = slices.Clone(current.PrivateKey)
+		previous.Previous = nil
+		previous.PreviousExpires = time.Time{}
+		kv.Previous = &previous
+		kv.PreviousExpires = now.Add(grace)
+	}
+
+	if err := storeKey(provider, path, kv); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Key at %s rotated\n", path)
+	fmt.Fprintf(out, "New public key, add it to authorized_keys:\n%s", keyPair.PublicKey)
+	if kv.Previous != nil {
+		fmt.Fprintf(out, "Previous public key, loadable until %s, remove it from authorized_keys by then:\n%s",
+			kv.PreviousExpires.Local().Format(time.DateTime), current.PublicKey)
+	} else {
+		fmt.Fprintf(out, "Previous public key, no longer loadable, remove it from authorized_keys:\n%s", current.PublicKey)
+	}
+	return nil
+}
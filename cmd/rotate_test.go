@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+func TestParseRotateArgs(t *testing.T) {
+	path, grace, err := parseRotateArgs([]string{"secret/ssh/a"}, &config.Config{})
+	if err != nil || path != "secret/ssh/a" || grace != config.DefaultRotationGrace {
+		t.Errorf("parseRotateArgs = %q, %v, %v, want default grace", path, grace, err)
+	}
+	_, grace, err = parseRotateArgs([]string{"--grace", "2d", "secret/ssh/a"}, &config.Config{RotationGrace: "30d"})
+	if err != nil || grace != 48*time.Hour {
+		t.Errorf("parseRotateArgs --grace = %v, %v, want 48h", grace, err)
+	}
+	if _, grace, _ := parseRotateArgs([]string{"secret/ssh/a"}, &config.Config{RotationGrace: "30d"}); grace != 30*24*time.Hour {
+		t.Errorf("parseRotateArgs with rotation_grace = %v, want 720h", grace)
+	}
+
+	for _, args := range [][]string{{}, {"--grace"}, {"--grace", "soon", "secret/ssh/a"}, {"secret/ssh/a", "secret/ssh/b"}, {"--force", "secret/ssh/a"}} {
+		if _, _, err := parseRotateArgs(args, &config.Config{}); err == nil {
+			t.Errorf("parseRotateArgs(%q) expected error, got nil", args)
+		}
+	}
+}
+
+func TestRotateKeepsPreviousKey(t *testing.T) {
+	provider := newMemoryProvider()
+	old := provider.addGeneratedKey(t, "secret/ssh/a", "a@example.com")
+	now := time.Now()
+
+	var out bytes.Buffer
+	if err := rotate(provider, &config.Config{}, []string{"--grace", "1d", "secret/ssh/a"}, &out, now); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	kv, _ := provider.Get("secret/ssh/a")
+	if bytes.Equal(kv.PublicKey, old.PublicKey) {
+		t.Fatal("key should have been replaced")
+	}
+	if kv.Comment != "a@example.com" || kv.KeyType != "ssh-ed25519" {
+		t.Errorf("new key should keep comment and type, got %q, %q", kv.Comment, kv.KeyType)
+	}
+	if kv.Previous == nil || !bytes.Equal(kv.Previous.PublicKey, old.PublicKey) || !bytes.Equal(kv.Previous.PrivateKey, old.PrivateKey) {
+		t.Fatal("previous key should be the replaced key")
+	}
+	if !kv.PreviousExpires.Equal(now.Add(24 * time.Hour)) {
+		t.Errorf("PreviousExpires = %v, want %v", kv.PreviousExpires, now.Add(24*time.Hour))
+	}
+	if !kv.PreviousActive(now.Add(time.Hour)) || kv.PreviousActive(now.Add(25*time.Hour)) {
+		t.Error("previous key should only be active during the grace period")
+	}
+
+	// Both public keys are printed for authorized_keys
+	if !strings.Contains(out.String(), string(kv.PublicKey)) || !strings.Contains(out.String(), string(old.PublicKey)) {
+		t.Errorf("output should contain both public keys:\n%s", out.String())
+	}
+
+	// Rotating again replaces the previous key with the one just rotated out
+	current := kv.PublicKey
+	if err := rotate(provider, &config.Config{}, []string{"--grace", "0d", "secret/ssh/a"}, &out, now); err != nil {
+		t.Fatalf("second rotate failed: %v", err)
+	}
+	kv, _ = provider.Get("secret/ssh/a")
+	if bytes.Equal(kv.PublicKey, current) || kv.Previous != nil {
+		t.Error("rotation without grace period should not keep the previous key")
+	}
+}
+
+func TestRotateEncryptedKey(t *testing.T) {
+	provider := newMemoryProvider()
+	provider.passphrases["secret/ssh-passphrases/a"] = []byte("stored-passphrase")
+	keyPair, err := ssh.GenerateKeyPairOfType(ssh.KeyTypeECDSA, 384, "", []byte("stored-passphrase"))
+	if err != nil {
+		t.Fatalf("GenerateKeyPairOfType failed: %v", err)
+	}
+	provider.keys["secret/ssh/a"] = &sm.KeyValue{
+		PrivateKey:        keyPair.PrivateKey,
+		PublicKey:         keyPair.PublicKey,
+		RequirePassphrase: true,
+		PassphrasePath:    "secret/ssh-passphrases/a",
+	}
+
+	var out bytes.Buffer
+	if err := rotate(provider, &config.Config{}, []string{"secret/ssh/a"}, &out, time.Now()); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	kv, _ := provider.Get("secret/ssh/a")
+	if !kv.RequirePassphrase || kv.PassphrasePath != "secret/ssh-passphrases/a" {
+		t.Error("new key should keep its passphrase path")
+	}
+	if keyType, bits, _ := ssh.PublicKeyType(kv.PublicKey); keyType != ssh.KeyTypeECDSA || bits != 384 {
+		t.Errorf("new key type = %s %d, want ecdsa 384", keyType, bits)
+	}
+	passphrase := "stored-passphrase"
+	if _, err := ssh.ExportKeyPair(&ssh.KeyPair{PrivateKey: kv.PrivateKey, Passphrase: &passphrase}, ssh.FormatOpenSSH, nil); err != nil {
+		t.Errorf("new key should decrypt with the stored passphrase: %v", err)
+	}
+}
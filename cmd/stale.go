@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+)
+
+// staleUsage is the usage message of the stale command
+const staleUsage = "usage: sm-ssh-add stale [--max-age <duration>] [<path>...]"
+
+// keyAge returns the age of the key stored at path, or an error if the provider does not track it
+func keyAge(provider sm.Provider, path string, now time.Time) (time.Time, time.Duration, error) {
+	reader, ok := provider.(sm.KeyAgeReader)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("secret manager does not record when keys were created")
+	}
+	created, err := reader.KeyCreated(path)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return created, now.Sub(created), nil
+}
+
+// formatDays formats a duration as a whole number of days
+func formatDays(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// warnKeyAge prints a warning if the key at path is older than maxAge. A maxAge of 0 disables the check.
+func warnKeyAge(provider sm.Provider, path string, maxAge time.Duration, now time.Time) {
+	if maxAge == 0 {
+		return
+	}
+	_, age, err := keyAge(provider, path, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to check age of key at %s: %v\n", path, err)
+		return
+	}
+	if age > maxAge {
+		fmt.Fprintf(os.Stderr, "Warning: key at %s is %s old and overdue for rotation (max_key_age %s), run: sm-ssh-add rotate %s\n",
+			path, formatDays(age), formatDays(maxAge), path)
+	}
+}
+
+// parseStaleArgs parses command line arguments of the stale command and returns the paths and maximum age
+func parseStaleArgs(args []string, cfg *config.Config) ([]string, time.Duration, error) {
+	maxAge, err := cfg.GetMaxKeyAge()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) == 0 || arg[0] != '-' {
+			paths = append(paths, arg)
+			continue
+		}
+
+		if value, ok, err := flagValue(args, &i, "--max-age"); ok {
+			if err != nil {
+				return nil, 0, fmt.Errorf("%v\n%s", err, staleUsage)
+			}
+			maxAge, err = config.ParseDuration(value)
+			if err != nil || maxAge == 0 {
+				return nil, 0, fmt.Errorf("invalid --max-age %q: must be a duration such as 90d", value)
+			}
+			continue
+		}
+
+		return nil, 0, fmt.Errorf("unknown flag: %s", arg)
+	}
+
+	if len(paths) == 0 {
+		paths = cfg.GetPaths()
+		if len(paths) == 0 {
+			return nil, 0, fmt.Errorf("no paths configured\n%s", staleUsage)
+		}
+	}
+	return paths, maxAge, nil
+}
+
+// Stale reports the age of stored keys and which of them are overdue for rotation.
+// It fails if any key is overdue, so it can be run from cron or CI.
+func Stale(provider sm.Provider, cfg *config.Config, args []string) error {
+	return stale(provider, cfg, args, os.Stdout, time.Now())
+}
+
+// stale implements Stale, writing the report to out
+func stale(provider sm.Provider, cfg *config.Config, args []string, out io.Writer, now time.Time) error {
+	paths, maxAge, err := parseStaleArgs(args, cfg)
+	if err != nil {
+		return err
+	}
+
+	overdue, failed := 0, 0
+	fmt.Fprintf(out, "Key ages (rotation due after %s):\n", formatDays(maxAge))
+	for _, path := range paths {
+		created, age, err := keyAge(provider, path, now)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(out, "  %-8s  %s: %v\n", "failed", path, err)
+		case age > maxAge:
+			overdue++
+			fmt.Fprintf(out, "  %-8s  %s: created %s, %s old\n", "overdue", path, created.Local().Format(time.DateOnly), formatDays(age))
+		default:
+			fmt.Fprintf(out, "  %-8s  %s: created %s, %s old\n", "ok", path, created.Local().Format(time.DateOnly), formatDays(age))
+		}
+	}
+	fmt.Fprintf(out, "%d keys checked: %d overdue, %d failed\n", len(paths), overdue, failed)
+
+	if overdue > 0 {
+		return fmt.Errorf("%d keys are overdue for rotation", overdue)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d keys could not be checked", failed)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+func TestParseStaleArgs(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault, VaultPaths: []string{"secret/ssh/a", "secret/ssh/b"}}
+
+	paths, maxAge, err := parseStaleArgs(nil, cfg)
+	if err != nil || len(paths) != 2 || maxAge != config.DefaultMaxKeyAge {
+		t.Errorf("parseStaleArgs = %v, %v, %v, want configured paths and default age", paths, maxAge, err)
+	}
+
+	cfg.MaxKeyAge = "30d"
+	if _, maxAge, _ := parseStaleArgs(nil, cfg); maxAge != 30*24*time.Hour {
+		t.Errorf("maxAge = %v, want max_key_age from config", maxAge)
+	}
+	paths, maxAge, err = parseStaleArgs([]string{"--max-age", "7d", "secret/ssh/c"}, cfg)
+	if err != nil || len(paths) != 1 || paths[0] != "secret/ssh/c" || maxAge != 7*24*time.Hour {
+		t.Errorf("parseStaleArgs = %v, %v, %v, want secret/ssh/c and 7d", paths, maxAge, err)
+	}
+
+	for _, args := range [][]string{{"--max-age"}, {"--max-age", "0d"}, {"--max-age", "old"}, {"--all"}} {
+		if _, _, err := parseStaleArgs(args, cfg); err == nil {
+			t.Errorf("parseStaleArgs(%q) expected error, got nil", args)
+		}
+	}
+	if _, _, err := parseStaleArgs(nil, &config.Config{DefaultProvider: config.ProviderVault}); err == nil {
+		t.Error("expected error without configured paths, got nil")
+	}
+}
+
+func TestStaleReport(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	provider := newMemoryProvider()
+	provider.addGeneratedKey(t, "secret/ssh/new", "")
+	provider.addGeneratedKey(t, "secret/ssh/old", "")
+	provider.created["secret/ssh/new"] = now.AddDate(0, 0, -10)
+	provider.created["secret/ssh/old"] = now.AddDate(0, 0, -120)
+
+	var out bytes.Buffer
+	err := stale(provider, &config.Config{}, []string{"secret/ssh/new", "secret/ssh/old"}, &out, now)
+	if err == nil || !strings.Contains(err.Error(), "1 keys are overdue") {
+		t.Errorf("stale = %v, want overdue error", err)
+	}
+	report := out.String()
+	if !strings.Contains(report, "ok        secret/ssh/new: created") || !strings.Contains(report, "10 days old") {
+		t.Errorf("report should list the new key as ok:\n%s", report)
+	}
+	if !strings.Contains(report, "overdue   secret/ssh/old: created") || !strings.Contains(report, "120 days old") {
+		t.Errorf("report should list the old key as overdue:\n%s", report)
+	}
+
+	out.Reset()
+	if err := stale(provider, &config.Config{}, []string{"--max-age", "180d", "secret/ssh/old"}, &out, now); err != nil {
+		t.Errorf("stale with longer max age = %v, want nil", err)
+	}
+
+	// Keys whose age cannot be read are reported as failed
+	out.Reset()
+	err = stale(&mockProvider{}, &config.Config{}, []string{"secret/ssh/a"}, &out, now)
+	if err == nil || !strings.Contains(out.String(), "failed    secret/ssh/a: secret manager does not record") {
+		t.Errorf("stale without age support = %v, report:\n%s", err, out.String())
+	}
+}
@@ -145,15 +145,19 @@ test_generate_load_without_passphrase() {
 test_generate_load_with_passphrase() {
     print_header "Test 2: Generate & Load (With Passphrase)"
 
+    # Passphrases are never read from stdin, answer the prompts with an askpass program
+    local askpass="$TEST_DIR/askpass.sh"
+    printf '#!/bin/sh\necho "%s"\n' "$TEST_PASSPHRASE" > "$askpass"
+    chmod +x "$askpass"
+
     # Generate key with passphrase
     echo "Generating key with passphrase at: $TEST_KEY_PATH_PASSPHRASE"
-    # Provide passphrase twice for confirmation during generate
-    echo -e "$TEST_PASSPHRASE\n$TEST_PASSPHRASE" | "$BINARY" generate --require-passphrase "$TEST_KEY_PATH_PASSPHRASE" "test-pass@example.com" || print_error "Generate with passphrase failed"
+    SSH_ASKPASS="$askpass" SSH_ASKPASS_REQUIRE=force "$BINARY" generate --require-passphrase "$TEST_KEY_PATH_PASSPHRASE" "test-pass@example.com" || print_error "Generate with passphrase failed"
     print_success "Key with passphrase generated"
 
     # Load key with passphrase
     echo "Loading passphrase-protected key"
-    echo "$TEST_PASSPHRASE" | "$BINARY" load "$TEST_KEY_PATH_PASSPHRASE" || print_error "Load with passphrase failed"
+    SSH_ASKPASS="$askpass" SSH_ASKPASS_REQUIRE=force "$BINARY" load "$TEST_KEY_PATH_PASSPHRASE" || print_error "Load with passphrase failed"
     print_success "Passphrase-protected key loaded into ssh-agent"
 
     # Verify key is in agent
@@ -209,6 +213,30 @@ test_duplicate_detection() {
     fi
 }
 
+# Test 5: Rotation keeps the previous key loadable
+test_rotate() {
+    print_header "Test 5: Rotate with Grace Period"
+
+    # Rotate the first key
+    echo "Rotating key at: $TEST_KEY_PATH_1"
+    "$BINARY" rotate --grace 1d "$TEST_KEY_PATH_1" || print_error "Rotate command failed"
+    print_success "Key rotated"
+
+    # Load should add both the new and the previous key
+    ssh-add -D > /dev/null 2>&1 || true
+    "$BINARY" load "$TEST_KEY_PATH_1" || print_error "Load after rotate failed"
+    count=$(ssh-add -l | grep -c "test1@example.com")
+    [ "$count" -eq 2 ] || print_error "Expected new and previous key in ssh-agent, found $count"
+    print_success "New and previous key verified in ssh-agent"
+
+    # Unload removes both
+    "$BINARY" unload "$TEST_KEY_PATH_1" || print_error "Unload after rotate failed"
+    if ssh-add -l | grep -q "test1@example.com"; then
+        print_error "Rotated keys still in ssh-agent after unload"
+    fi
+    print_success "New and previous key removed from ssh-agent"
+}
+
 # Run all tests
 main() {
     echo ""
@@ -226,6 +254,7 @@ main() {
     test_generate_load_with_passphrase
     test_load_from_config
     test_duplicate_detection
+    test_rotate
 
     # Final summary
     print_header "All Tests Passed!"
@@ -233,6 +262,7 @@ main() {
     echo -e "${GREEN}✓ Generate & load (with passphrase)${NC}"
     echo -e "${GREEN}✓ Load multiple keys from config${NC}"
     echo -e "${GREEN}✓ Duplicate key detection${NC}"
+    echo -e "${GREEN}✓ Rotate with grace period${NC}"
     echo ""
     echo -e "${GREEN}========================================"
     echo "  SUCCESS: All E2E tests passed!"
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// unloadUsage is the usage message of the unload command
+const unloadUsage = "usage: sm-ssh-add unload [--from-config | --all-managed | <path>...]"
+
+// unloadOptions holds the parsed arguments of the unload command
+type unloadOptions struct {
+	paths      []string
+	allManaged bool
+}
+
+// parseUnloadArgs parses command line arguments and returns what to unload
+func parseUnloadArgs(args []string, cfg *config.Config) (*unloadOptions, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s", unloadUsage)
+	}
+
+	opts := &unloadOptions{}
+	fromConfig := false
+	var directPaths []string
+
+	for _, arg := range args {
+		if len(arg) > 0 && arg[0] == '-' {
+			switch arg {
+			case "--from-config":
+				fromConfig = true
+			case "--all-managed":
+				opts.allManaged = true
+			default:
+				return nil, fmt.Errorf("unknown flag: %s", arg)
+			}
+		} else {
+			directPaths = append(directPaths, arg)
+		}
+	}
+
+	if fromConfig && opts.allManaged {
+		return nil, fmt.Errorf("cannot use both --from-config and --all-managed")
+	}
+	if (fromConfig || opts.allManaged) && len(directPaths) > 0 {
+		return nil, fmt.Errorf("cannot use both a flag and direct path\n%s", unloadUsage)
+	}
+
+	switch {
+	case opts.allManaged:
+		return opts, nil
+	case fromConfig:
+		paths := cfg.GetPaths()
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no paths configured")
+		}
+		opts.paths = paths
+	default:
+		opts.paths = directPaths
+	}
+
+	return opts, nil
+}
+
+// unloadKey removes the key stored at the given path from the agent
+func unloadKey(path string, provider sm.Provider, agent *ssh.Agent) error {
+	keyValue, err := provider.Get(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load key from %s: %v\n", path, err)
+		return err
+	}
+
+	err = agent.RemoveKey(keyValue.PublicKey)
+	switch {
+	case err == sm.ErrKeyNotInAgent:
+		fmt.Fprintf(os.Stdout, "Key from %s not loaded in agent\n", path)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Failed to remove key from %s: %v\n", path, err)
+		return err
+	default:
+		fmt.Fprintf(os.Stdout, "Removed key from %s from ssh-agent\n", path)
+	}
+
+	// The previous key of a rotation may still be loaded, whether or not it has expired
+	if keyValue.Previous != nil {
+		err := agent.RemoveKey(keyValue.Previous.PublicKey)
+		if err != nil && err != sm.ErrKeyNotInAgent {
+			fmt.Fprintf(os.Stderr, "Failed to remove previous key from %s: %v\n", path, err)
+			return err
+		}
+		if err == nil {
+			fmt.Fprintf(os.Stdout, "Removed previous key from %s from ssh-agent\n", path)
+		}
+	}
+	return nil
+}
+
+// Unload removes SSH keys stored in the secret manager from ssh-agent
+func Unload(provider sm.Provider, cfg *config.Config, args []string) error {
+	opts, err := parseUnloadArgs(args, cfg)
+	if err != nil {
+		return err
+	}
+
+	agent, err := ssh.NewAgent(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	defer func() {
+		if cerr := agent.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close ssh-agent: %v\n", cerr)
+		}
+	}()
+
+	if opts.allManaged {
+		removed, err := agent.RemoveManagedKeys()
+		for _, path := range removed {
+			fmt.Fprintf(os.Stdout, "Removed key from %s from ssh-agent\n", path)
+		}
+		if err != nil {
+			return err
+		}
+		if len(removed) == 0 {
+			fmt.Fprintln(os.Stdout, "No keys managed by sm-ssh-add loaded in agent")
+		}
+		return nil
+	}
+
+	for _, path := range opts.paths {
+		if err := unloadKey(path, provider, agent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+// TestParseUnloadArgs tests the accepted argument combinations
+func TestParseUnloadArgs(t *testing.T) {
+	cfg := &config.Config{
+		DefaultProvider: config.ProviderVault,
+		VaultPaths:      []string{"secret/ssh/a", "secret/ssh/b"},
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		wantPaths      []string
+		wantAllManaged bool
+	}{
+		{name: "direct paths", args: []string{"secret/ssh/a", "secret/ssh/c"}, wantPaths: []string{"secret/ssh/a", "secret/ssh/c"}},
+		{name: "from config", args: []string{"--from-config"}, wantPaths: []string{"secret/ssh/a", "secret/ssh/b"}},
+		{name: "all managed", args: []string{"--all-managed"}, wantAllManaged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseUnloadArgs(tt.args, cfg)
+			if err != nil {
+				t.Fatalf("parseUnloadArgs() error = %v", err)
+			}
+			if !slices.Equal(opts.paths, tt.wantPaths) {
+				t.Errorf("paths = %v, want %v", opts.paths, tt.wantPaths)
+			}
+			if opts.allManaged != tt.wantAllManaged {
+				t.Errorf("allManaged = %v, want %v", opts.allManaged, tt.wantAllManaged)
+			}
+		})
+	}
+}
+
+// TestUnloadInvalidArguments tests argument errors reported before connecting to the agent
+func TestUnloadInvalidArguments(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no arguments", args: []string{}},
+		{name: "unknown flag", args: []string{"--unknown"}},
+		{name: "from config and all managed", args: []string{"--from-config", "--all-managed"}},
+		{name: "all managed and path", args: []string{"--all-managed", "secret/ssh/a"}},
+		{name: "from config and path", args: []string{"secret/ssh/a", "--from-config"}},
+		{name: "from config without paths", args: []string{"--from-config"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unload(&mockProviderForLoad{}, cfg, tt.args)
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+// verifyUsage is the usage message of the verify command
+const verifyUsage = "usage: sm-ssh-add verify [<path>...]"
+
+// verifyKeyValue checks that the stored public key and require_passphrase flag match the private
+// key. The passphrase is only read for keys whose public key cannot be derived without it.
+func verifyKeyValue(provider sm.Provider, cfg *config.Config, path string, keyValue *sm.KeyValue) error {
+	err := ssh.VerifyKeyPair(keyValue.PrivateKey, keyValue.PublicKey, keyValue.RequirePassphrase, nil)
+	if !errors.Is(err, ssh.ErrPassphraseRequired) {
+		return err
+	}
+
+	passphrase, err := keyPassphrase(provider, cfg, path, keyValue)
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	defer clear(passphrase)
+	return ssh.VerifyKeyPair(keyValue.PrivateKey, keyValue.PublicKey, keyValue.RequirePassphrase, passphrase)
+}
+
+// Verify checks that the keys stored at the given or configured paths are consistent: the stored
+// public key belongs to the private key and require_passphrase matches whether it is encrypted.
+func Verify(provider sm.Provider, cfg *config.Config, args []string) error {
+	return verify(provider, cfg, args, os.Stdout, time.Now())
+}
+
+// verify implements Verify, writing the report to out
+func verify(provider sm.Provider, cfg *config.Config, args []string, out io.Writer, now time.Time) error {
+	var paths []string
+	for _, arg := range args {
+		if len(arg) > 0 && arg[0] == '-' {
+			return fmt.Errorf("unknown flag: %s\n%s", arg, verifyUsage)
+		}
+		paths = append(paths, arg)
+	}
+	if len(paths) == 0 {
+		paths = cfg.GetPaths()
+		if len(paths) == 0 {
+			return fmt.Errorf("no paths configured\n%s", verifyUsage)
+		}
+	}
+
+	checked, failed := 0, 0
+	report := func(name string, err error) {
+		checked++
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "  %-6s  %s: %v\n", "failed", name, err)
+			return
+		}
+		fmt.Fprintf(out, "  %-6s  %s\n", "ok", name)
+	}
+
+	for _, path := range paths {
+		keyValue, err := provider.Get(path)
+		if err != nil {
+			report(path, err)
+			continue
+		}
+		report(path, verifyKeyValue(provider, cfg, path, keyValue))
+		clear(keyValue.PrivateKey)
+
+		if keyValue.PreviousActive(now) {
+			report(path+" (previous)", verifyKeyValue(provider, cfg, path, keyValue.Previous))
+			clear(keyValue.Previous.PrivateKey)
+		}
+	}
+
+	fmt.Fprintf(out, "%d keys checked: %d failed\n", checked, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d keys failed verification", failed)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/ssh"
+)
+
+func TestVerifyReportsInconsistentKeys(t *testing.T) {
+	provider := newMemoryProvider()
+	provider.addGeneratedKey(t, "secret/ssh/ok", "")
+	provider.addGeneratedKey(t, "secret/ssh/edited", "")
+	provider.keys["secret/ssh/edited"].PublicKey = provider.keys["secret/ssh/ok"].PublicKey
+	provider.addGeneratedKey(t, "secret/ssh/flag", "")
+	provider.keys["secret/ssh/flag"].RequirePassphrase = true
+	provider.addGeneratedKey(t, "secret/ssh/garbled", "")
+	provider.keys["secret/ssh/garbled"].PrivateKey = []byte("not a key")
+
+	// An edited previous key is reported while it can still be loaded
+	provider.keys["secret/ssh/ok"].Previous = provider.keys["secret/ssh/edited"]
+	provider.keys["secret/ssh/ok"].PreviousExpires = time.Now().Add(time.Hour)
+
+	var out bytes.Buffer
+	cfg := &config.Config{DefaultProvider: config.ProviderVault, VaultPaths: []string{"secret/ssh/ok", "secret/ssh/flag"}}
+	err := verify(provider, cfg, []string{"secret/ssh/ok", "secret/ssh/flag", "secret/ssh/garbled", "secret/ssh/missing"}, &out, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "4 keys failed verification") {
+		t.Errorf("verify = %v, want 4 failed keys", err)
+	}
+
+	report := out.String()
+	for _, want := range []string{
+		"ok      secret/ssh/ok\n",
+		"failed  secret/ssh/ok (previous): " + ssh.ErrPublicKeyMismatch.Error(),
+		"failed  secret/ssh/flag: " + ssh.ErrUnexpectedPassphrase.Error(),
+		"failed  secret/ssh/garbled: failed to parse private key",
+		"failed  secret/ssh/missing:",
+		"5 keys checked: 4 failed",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+
+	// Without paths the configured ones are verified
+	out.Reset()
+	if err := verify(provider, cfg, nil, &out, time.Now().Add(2*time.Hour)); err == nil || !strings.Contains(out.String(), "2 keys checked: 1 failed") {
+		t.Errorf("verify = %v, %q, want the configured paths checked", err, out.String())
+	}
+
+	if err := verify(provider, cfg, []string{"--fix"}, &out, time.Now()); err == nil {
+		t.Error("expected error for unknown flag, got nil")
+	}
+}
+
+func TestLoadRejectsMismatchedPublicKey(t *testing.T) {
+	serveTestAgent(t)
+	provider := newMemoryProvider()
+	provider.addGeneratedKey(t, "secret/ssh/a", "")
+	other := provider.addGeneratedKey(t, "secret/ssh/b", "")
+	provider.keys["secret/ssh/a"].PublicKey = other.PublicKey
+
+	err := Load(provider, &config.Config{}, []string{"secret/ssh/a"})
+	if err == nil || !strings.Contains(err.Error(), "sm-ssh-add verify secret/ssh/a") {
+		t.Errorf("Load = %v, want a verification error", err)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ConfigFileName is the name of the config file
@@ -15,15 +18,74 @@ const ConfigFileName = "sm-ssh-add.json"
 // Provider constants
 const (
 	ProviderVault = "vault"
-	// ProviderAWS = "aws" // Future implementation
+	ProviderAWS   = "aws"
 )
 
-// Config holds the application configuration. It reads from ~/.config/sm-ssh-add.json
-// and contains the default provider and secret manager paths to load keys from.
+// DefaultRotationGrace is how long the previous key stays loadable after a rotation
+const DefaultRotationGrace = 7 * 24 * time.Hour
+
+// DefaultMaxKeyAge is the key age reported as overdue by load and stale when max_key_age is not set
+const DefaultMaxKeyAge = 90 * 24 * time.Hour
+
+// KeyOptions holds per-path settings applied when a key is loaded into ssh-agent
+type KeyOptions struct {
+	Confirm  bool     `json:"confirm,omitempty"`  // Ask for confirmation (via ssh-askpass) before each signature
+	Restrict []string `json:"restrict,omitempty"` // Only allow use of the key for these "[user@]host" destinations
+	// Secret holding the key's passphrase, overriding the passphrase_path stored with the key
+	PassphrasePath string `json:"passphrase_path,omitempty"`
+}
+
+// Config holds the application configuration. It reads from ~/.config/sm-ssh-add.json, merged
+// over /etc/sm-ssh-add/config.json, and contains the default provider and secret manager paths
+// to load keys from. The Vault address and namespace are used when BAO_ADDR/VAULT_ADDR and
+// BAO_NAMESPACE/VAULT_NAMESPACE are not set, and VaultTokenEnv names the environment variable
+// holding the token in place of BAO_TOKEN or VAULT_TOKEN. The AWS region is used when AWS_REGION
+// and AWS_DEFAULT_REGION are not set.
 type Config struct {
-	DefaultProvider    string   `json:"default_provider"`
+	DefaultProvider    string   `json:"default_provider,omitempty"` // May be left to the system config
+	VaultAddress       string   `json:"vault_address,omitempty"`
+	VaultNamespace     string   `json:"vault_namespace,omitempty"`
+	VaultPaths         []string `json:"vault_paths,omitempty"`
+	Paths              []string `json:"paths,omitempty"`                 // Paths naming their provider, e.g. vault://a
+	VaultApproleRoleID string   `json:"vault_approle_role_id,omitempty"` // Use AppRole auth instead of a token
+	VaultTokenEnv      string   `json:"vault_token_env,omitempty"`
+	AWSRegion          string   `json:"aws_region,omitempty"`
+	AWSPaths           []string `json:"aws_paths,omitempty"`
+
+	Profiles         map[string]*Profile   `json:"profiles,omitempty"`         // Named secret manager settings
+	KeyOptions       map[string]KeyOptions `json:"key_options,omitempty"`      // Keyed by secret manager path
+	Pinentry         string                `json:"pinentry,omitempty"`         // For prompts without a terminal
+	PassphrasePolicy PassphrasePolicy      `json:"passphrase_policy,omitzero"` // Requirements for new passphrases
+	RotationGrace    string                `json:"rotation_grace,omitempty"`   // How long rotate keeps the old key
+	MaxKeyAge        string                `json:"max_key_age,omitempty"`      // Age due for rotation, e.g. "90d"
+
+	profile string // Name of the profile applied by WithProfile, empty for the top-level settings
+}
+
+// Profile holds the secret manager settings of a named profile. A selected profile replaces the
+// top-level settings of the same name; the provider defaults to default_provider.
+type Profile struct {
+	Provider           string   `json:"provider,omitempty"`
+	VaultAddress       string   `json:"vault_address,omitempty"`   // Used instead of BAO_ADDR and VAULT_ADDR
+	VaultNamespace     string   `json:"vault_namespace,omitempty"` // Used instead of BAO_NAMESPACE and VAULT_NAMESPACE
 	VaultPaths         []string `json:"vault_paths,omitempty"`
-	VaultApproleRoleID string   `json:"vault_approle_role_id,omitempty"` // If set, use Vault Approle auth instead of token
+	Paths              []string `json:"paths,omitempty"`
+	VaultApproleRoleID string   `json:"vault_approle_role_id,omitempty"`
+	VaultTokenEnv      string   `json:"vault_token_env,omitempty"`
+	AWSRegion          string   `json:"aws_region,omitempty"` // Used instead of AWS_REGION
+	AWSPaths           []string `json:"aws_paths,omitempty"`
+}
+
+// PassphrasePolicy holds the requirements for new key passphrases. Zero values disable a check.
+type PassphrasePolicy struct {
+	MinLength  int     `json:"min_length,omitempty"`  // Minimum number of characters
+	MinEntropy float64 `json:"min_entropy,omitempty"` // Minimum estimated entropy in bits
+	BreachList string  `json:"breach_list,omitempty"` // File of compromised passphrases, one per line, in plain text or as SHA-1 hashes
+}
+
+// GetVaultAddress returns the configured Vault address
+func (c *Config) GetVaultAddress() string {
+	return c.VaultAddress
 }
 
 // GetVaultApproleRoleID returns the configured Vault Approle Role ID.
@@ -31,8 +93,127 @@ func (c *Config) GetVaultApproleRoleID() string {
 	return c.VaultApproleRoleID
 }
 
-// getConfigFilePath returns the path to the config file
+// GetVaultNamespace returns the configured Vault namespace
+func (c *Config) GetVaultNamespace() string {
+	return c.VaultNamespace
+}
+
+// GetVaultTokenEnv returns the environment variable configured to hold the Vault token
+func (c *Config) GetVaultTokenEnv() string {
+	return c.VaultTokenEnv
+}
+
+// GetAWSRegion returns the configured AWS region
+func (c *Config) GetAWSRegion() string {
+	return c.AWSRegion
+}
+
+// GetProfile returns the name of the selected profile, or an empty string if none is selected
+func (c *Config) GetProfile() string {
+	return c.profile
+}
+
+// ProfileNames returns the names of the configured profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// WithProfile returns a copy of the config with the settings of the named profile in place of
+// the top-level secret manager settings. Settings that are not per profile are shared.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	p, ok := c.Profiles[name]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("%w %q, configured profiles: %s", ErrUnknownProfile, name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	cfg := *c
+	cfg.profile = name
+	if p.Provider != "" {
+		cfg.DefaultProvider = p.Provider
+	}
+	cfg.VaultAddress = p.VaultAddress
+	cfg.VaultNamespace = p.VaultNamespace
+	cfg.VaultPaths = p.VaultPaths
+	cfg.Paths = p.Paths
+	cfg.VaultApproleRoleID = p.VaultApproleRoleID
+	cfg.VaultTokenEnv = p.VaultTokenEnv
+	cfg.AWSRegion = p.AWSRegion
+	cfg.AWSPaths = p.AWSPaths
+	return &cfg, nil
+}
+
+// GetRotationGrace returns the configured rotation grace period, or DefaultRotationGrace if unset
+func (c *Config) GetRotationGrace() (time.Duration, error) {
+	if c.RotationGrace == "" {
+		return DefaultRotationGrace, nil
+	}
+	grace, err := ParseDuration(c.RotationGrace)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rotation_grace: %w", err)
+	}
+	return grace, nil
+}
+
+// GetMaxKeyAge returns the configured maximum key age, or DefaultMaxKeyAge if it is not set
+func (c *Config) GetMaxKeyAge() (time.Duration, error) {
+	if c.MaxKeyAge == "" {
+		return DefaultMaxKeyAge, nil
+	}
+	maxAge, err := ParseDuration(c.MaxKeyAge)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max_key_age: %w", err)
+	}
+	return maxAge, nil
+}
+
+// ParseDuration parses a duration such as "12h" or "90m", and also accepts a whole number of
+// days such as "7d"
+func ParseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// ExplicitPath is the config file given with the --config flag. It takes precedence over
+// SM_SSH_ADD_CONFIG, XDG_CONFIG_HOME and ~/.config.
+var ExplicitPath string
+
+// SelectedProfile is the profile given with the --profile flag. It takes precedence over
+// SM_SSH_ADD_PROFILE.
+var SelectedProfile string
+
+// SystemPath is the system-wide config file. Its settings apply unless the user config overrides
+// them, and its paths are loaded in addition to the user's.
+var SystemPath = defaultSystemPath()
+
+// getConfigFilePath returns the path to the user config file
 func getConfigFilePath() (string, error) {
+	if ExplicitPath != "" {
+		return ExplicitPath, nil
+	}
+	if path := os.Getenv("SM_SSH_ADD_CONFIG"); path != "" {
+		return path, nil
+	}
+	// Relative paths are ignored, as the XDG base directory specification requires
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, ConfigFileName), nil
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get home directory: %w", err)
@@ -40,17 +221,137 @@ func getConfigFilePath() (string, error) {
 	return filepath.Join(home, ".config", ConfigFileName), nil
 }
 
-// Read reads and parses the config file from ~/.config/sm-ssh-add.json
+// Path returns the path of the user config file, whether or not it exists
+func Path() (string, error) {
+	return getConfigFilePath()
+}
+
+// HasSystemConfig reports whether the system-wide config file exists
+func HasSystemConfig() bool {
+	_, err := os.Stat(SystemPath)
+	return err == nil
+}
+
+// Read reads the user config file merged over the system-wide one. Either may be missing, but not both.
 func Read() (*Config, error) {
 	configPath, err := getConfigFilePath()
 	if err != nil {
 		return nil, wrapError(err, "failed to get config path")
 	}
 
+	system, err := readSystemFile()
+	if err != nil {
+		return nil, err
+	}
+	user, err := readFile(configPath)
+	switch {
+	case errors.Is(err, ErrConfigFileNotFound) && system != nil:
+		user = &Config{}
+	case err != nil:
+		return nil, err
+	}
+
+	cfg, err := merge(system, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile := selectedProfile(); profile != "" {
+		if cfg, err = cfg.WithProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.validateProvider(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// selectedProfile returns the profile selected with --profile or SM_SSH_ADD_PROFILE
+func selectedProfile() string {
+	if SelectedProfile != "" {
+		return SelectedProfile
+	}
+	return os.Getenv("SM_SSH_ADD_PROFILE")
+}
+
+// readSystemFile reads the system-wide config file, returning nil if it does not exist
+func readSystemFile() (*Config, error) {
+	system, err := readFile(SystemPath)
+	switch {
+	case errors.Is(err, ErrConfigFileNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, wrapError(err, SystemPath)
+	}
+	return system, nil
+}
+
+// merge returns the user config applied over the system config. Settings set in the user config
+// win, key options are replaced per path, and the user's paths are added to the system's.
+func merge(system, user *Config) (*Config, error) {
+	if system == nil {
+		return user, nil
+	}
+
+	// Decoding the user config over a copy of the system config keeps the settings it omits
+	data, err := json.Marshal(system)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to merge config: %w", err)
+	}
+	if data, err = json.Marshal(user); err != nil {
+		return nil, fmt.Errorf("failed to merge config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to merge config: %w", err)
+	}
+
+	cfg.VaultPaths = mergePaths(system.VaultPaths, user.VaultPaths)
+	cfg.AWSPaths = mergePaths(system.AWSPaths, user.AWSPaths)
+	cfg.Paths = mergePaths(system.Paths, user.Paths)
+
+	// Profiles defined in both files are merged like the top-level settings
+	for name, p := range user.Profiles {
+		sp := system.Profiles[name]
+		if sp == nil || p == nil {
+			continue
+		}
+		merged := *sp
+		if data, err = json.Marshal(p); err != nil {
+			return nil, fmt.Errorf("failed to merge config: %w", err)
+		}
+		if err := json.Unmarshal(data, &merged); err != nil {
+			return nil, fmt.Errorf("failed to merge config: %w", err)
+		}
+		merged.VaultPaths = mergePaths(sp.VaultPaths, p.VaultPaths)
+		merged.AWSPaths = mergePaths(sp.AWSPaths, p.AWSPaths)
+		merged.Paths = mergePaths(sp.Paths, p.Paths)
+		cfg.Profiles[name] = &merged
+	}
+	return &cfg, nil
+}
+
+// mergePaths returns the system paths followed by the user paths that are not among them
+func mergePaths(system, user []string) []string {
+	paths := slices.Clone(system)
+	for _, path := range user {
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// readFile reads and parses the config file at configPath without validating it
+func readFile(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, ErrConfigFileNotFound
+			return nil, fmt.Errorf("%w: %s", ErrConfigFileNotFound, configPath)
 		}
 		return nil, wrapError(err, "failed to read config file")
 	}
@@ -60,60 +361,339 @@ func Read() (*Config, error) {
 	if err != nil {
 		return nil, wrapError(err, "failed to parse config file (invalid JSON)")
 	}
+	return &cfg, nil
+}
 
-	// Validate configuration
-	if cfg.DefaultProvider == "" {
-		return nil, ErrEmptyProvider
+// validateProvider checks that the default provider and the providers of profiles are supported.
+// The default provider may only be left out when profiles provide one.
+func (c *Config) validateProvider() error {
+	for _, name := range c.ProfileNames() {
+		p := c.Profiles[name]
+		if p == nil {
+			return fmt.Errorf("profile %s: empty profile", name)
+		}
+		if p.Provider != "" && p.Provider != ProviderVault && p.Provider != ProviderAWS {
+			return fmt.Errorf("profile %s: %w", name, ErrInvalidProvider)
+		}
+		if p.Provider == "" && c.DefaultProvider == "" && len(p.Paths) == 0 {
+			return fmt.Errorf("profile %s: %w", name, ErrEmptyProvider)
+		}
+	}
+	if c.DefaultProvider == "" && (len(c.Profiles) > 0 || len(c.Paths) > 0) {
+		// Paths without a provider scheme fail when they are used, with ErrNoProfile if there are
+		// profiles to select from
+		return nil
+	}
+	if c.DefaultProvider == "" {
+		return ErrEmptyProvider
 	}
 
-	switch cfg.DefaultProvider {
-	case ProviderVault:
+	switch c.DefaultProvider {
+	case ProviderVault, ProviderAWS:
 		// Valid provider
 	default:
-		return nil, ErrInvalidProvider
+		return ErrInvalidProvider
 	}
+	return nil
+}
 
-	return &cfg, nil
+// Validate checks the whole configuration. Read only checks the provider, so that commands keep
+// working when a setting they don't use is invalid.
+func (c *Config) Validate() error {
+	if err := c.validateProvider(); err != nil {
+		return err
+	}
+	if _, err := c.GetRotationGrace(); err != nil {
+		return err
+	}
+	if _, err := c.GetMaxKeyAge(); err != nil {
+		return err
+	}
+	if c.PassphrasePolicy.MinLength < 0 {
+		return fmt.Errorf("invalid passphrase_policy.min_length: must not be negative")
+	}
+	if c.PassphrasePolicy.MinEntropy < 0 {
+		return fmt.Errorf("invalid passphrase_policy.min_entropy: must not be negative")
+	}
+	paths := [][]string{c.Paths}
+	for _, p := range c.Profiles {
+		paths = append(paths, p.Paths)
+	}
+	for _, path := range slices.Concat(paths...) {
+		switch provider, _ := ParsePath(path); provider {
+		case "":
+			return fmt.Errorf("invalid path %s in paths: missing provider scheme such as vault://", path)
+		case ProviderVault, ProviderAWS:
+			// Valid provider
+		default:
+			return fmt.Errorf("invalid path %s: %w %s", path, ErrInvalidProvider, provider)
+		}
+	}
+	for path, opts := range c.KeyOptions {
+		if slices.Contains(opts.Restrict, "") {
+			return fmt.Errorf("invalid key_options for %s: empty restrict destination", path)
+		}
+	}
+	return nil
 }
 
-// GetPaths returns all configured paths for the default provider
+// GetPaths returns all configured paths: the paths of the default provider followed by the paths
+// naming their provider
 func (c *Config) GetPaths() []string {
+	paths := []string{}
 	switch c.DefaultProvider {
 	case ProviderVault:
-		if c.VaultPaths == nil {
-			return []string{}
-		}
-		return c.VaultPaths
-	// Future: add case for AWS, Azure, etc.
+		paths = append(paths, c.VaultPaths...)
+	case ProviderAWS:
+		paths = append(paths, c.AWSPaths...)
+	}
+	return append(paths, c.Paths...)
+}
+
+// ParsePath splits a path such as vault://secret/ssh/a into its provider and the path within the
+// provider. Paths without a scheme have an empty provider and are returned unchanged.
+func ParsePath(path string) (string, string) {
+	provider, rest, ok := strings.Cut(path, "://")
+	if !ok || provider == "" || strings.Contains(provider, "/") {
+		return "", path
+	}
+	return provider, rest
+}
+
+// pathList returns the list of c that holds path: paths for paths naming their provider,
+// otherwise the paths of the default provider
+func (c *Config) pathList(path string) (*[]string, error) {
+	if provider, _ := ParsePath(path); provider != "" {
+		return &c.Paths, nil
+	}
+	switch c.DefaultProvider {
+	case ProviderVault:
+		return &c.VaultPaths, nil
+	case ProviderAWS:
+		return &c.AWSPaths, nil
+	case "":
+		return nil, fmt.Errorf("path %s has no provider scheme such as vault:// and default_provider is not set", path)
 	default:
-		return []string{}
+		return nil, fmt.Errorf("unsupported provider: %s", c.DefaultProvider)
 	}
 }
 
+// GetKeyOptions returns the options configured for the given path.
+// Paths without an entry get the zero value (no constraints).
+func (c *Config) GetKeyOptions(path string) KeyOptions {
+	return c.KeyOptions[path]
+}
+
 // AddPath adds a new path to the appropriate provider's path list and writes the config file
 func (c *Config) AddPath(path string) error {
-	switch c.DefaultProvider {
-	case ProviderVault:
-		// If path already exists, do nothing (no-op)
-		if slices.Contains(c.VaultPaths, path) {
-			return nil
+	paths, err := c.pathList(path)
+	if err != nil {
+		return err
+	}
+	// If path already exists, do nothing (no-op)
+	if slices.Contains(*paths, path) {
+		return nil
+	}
+
+	// Add the path to the file as it is now, it may have changed since c was read
+	err = update(c, func(saved *Config) error {
+		paths := c.savedPaths(saved, path)
+		if !slices.Contains(*paths, path) {
+			*paths = append(*paths, path)
 		}
-		c.VaultPaths = append(c.VaultPaths, path)
-	// Future: add case for AWS, Azure, etc.
-	default:
-		return fmt.Errorf("unsupported provider: %s", c.DefaultProvider)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*paths = append(*paths, path)
+	return nil
+}
+
+// savedPaths returns the list in saved that holds path, in the selected profile if there is one
+func (c *Config) savedPaths(saved *Config, path string) *[]string {
+	provider, _ := ParsePath(path)
+	if c.profile == "" {
+		switch {
+		case provider != "":
+			return &saved.Paths
+		case c.DefaultProvider == ProviderAWS:
+			return &saved.AWSPaths
+		}
+		return &saved.VaultPaths
+	}
+
+	p := c.savedProfile(saved)
+	switch {
+	case provider != "":
+		return &p.Paths
+	case c.DefaultProvider == ProviderAWS:
+		return &p.AWSPaths
+	}
+	return &p.VaultPaths
+}
+
+// savedProfile returns the selected profile in saved. The profile is added to saved if it is
+// missing, as when it is defined in the system config.
+func (c *Config) savedProfile(saved *Config) *Profile {
+	if saved.Profiles == nil {
+		saved.Profiles = map[string]*Profile{}
+	}
+	p := saved.Profiles[c.profile]
+	if p == nil {
+		p = &Profile{}
+		saved.Profiles[c.profile] = p
+	}
+	return p
+}
+
+// RemovePath removes a path from the appropriate provider's path list together with its key
+// options, and writes the config file
+func (c *Config) RemovePath(path string) error {
+	paths, err := c.pathList(path)
+	if err != nil {
+		return err
 	}
+	if !slices.Contains(*paths, path) {
+		return fmt.Errorf("path %s is not configured", path)
+	}
+
+	err = update(c, func(saved *Config) error {
+		paths := c.savedPaths(saved, path)
+		if !slices.Contains(*paths, path) {
+			return fmt.Errorf("path %s is configured in %s, not in your config", path, SystemPath)
+		}
+		*paths = slices.DeleteFunc(*paths, func(p string) bool { return p == path })
+		delete(saved.KeyOptions, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*paths = slices.DeleteFunc(*paths, func(p string) bool { return p == path })
+	delete(c.KeyOptions, path)
+	return nil
+}
+
+// Save writes the config file, see writeFile
+func (c *Config) Save() error {
+	configPath, err := getConfigFilePath()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.writeFile(configPath)
+}
 
-	// Write the updated config to disk
+// Update applies fn to the current content of the user config file and writes the result if it
+// is valid together with the system config. The file is locked meanwhile, so concurrent updates
+// are not lost.
+func Update(fn func(*Config) error) error {
+	return update(nil, fn)
+}
+
+// update implements Update. If neither config file exists, fn is applied to a copy of base, or to
+// an empty config if base is nil. A config merged with the system config or with a profile applied
+// is never copied, so those settings don't end up at the top level of the user config.
+func update(base *Config, fn func(*Config) error) error {
 	configPath, err := getConfigFilePath()
 	if err != nil {
 		return err
 	}
 
+	unlock, err := lockFile(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	system, err := readSystemFile()
+	if err != nil {
+		return err
+	}
+	cfg, err := readFile(configPath)
+	switch {
+	case errors.Is(err, ErrConfigFileNotFound) && base != nil && base.profile == "" && system == nil:
+		copied := *base
+		cfg = &copied
+	case errors.Is(err, ErrConfigFileNotFound):
+		cfg = &Config{}
+	case err != nil:
+		return err
+	}
+
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	merged, err := merge(system, cfg)
+	if err != nil {
+		return err
+	}
+	if err := merged.Validate(); err != nil {
+		return err
+	}
+	return cfg.writeFile(configPath)
+}
+
+// lockFile takes an exclusive lock on a lock file next to the config file at configPath, creating
+// its directory if needed, and returns the function releasing it. The config file itself can't be
+// locked since writeFile replaces it.
+func lockFile(configPath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	f, err := os.OpenFile(configPath+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config lock: %w", err)
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock config: %w", err)
+	}
+	return func() {
+		unlock(f)
+		f.Close()
+	}, nil
+}
+
+// writeFile atomically replaces the config file at configPath. The file is only readable by the
+// user since it can name AppRole roles and secret paths.
+func (c *Config) writeFile(configPath string) error {
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
+	data = append(data, '\n')
 
-	return os.WriteFile(configPath, data, 0600)
+	// Write to a temporary file next to the config and rename it, so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(configPath), "."+ConfigFileName+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), configPath); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
 }
@@ -2,11 +2,25 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 )
 
+func TestMain(m *testing.M) {
+	// Tests choose the config location through HOME, and don't see the machine's system config
+	os.Unsetenv("SM_SSH_ADD_CONFIG")
+	os.Unsetenv("SM_SSH_ADD_PROFILE")
+	os.Unsetenv("XDG_CONFIG_HOME")
+	SystemPath = filepath.Join(os.TempDir(), "sm-ssh-add-test-missing", "config.json")
+	os.Exit(m.Run())
+}
+
 func TestRead(t *testing.T) {
 	// Set up test config directory
 	origHome := os.Getenv("HOME")
@@ -83,6 +97,7 @@ func TestGetPaths(t *testing.T) {
 }
 
 func TestConfigAddPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
 	cfg := &Config{
 		DefaultProvider: ProviderVault,
 		VaultPaths:      []string{"secret/ssh/existing"},
@@ -103,6 +118,25 @@ func TestConfigAddPath(t *testing.T) {
 	}
 }
 
+func TestConfigAddPath_aws(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := &Config{DefaultProvider: ProviderAWS, VaultPaths: []string{"secret/ssh/a"}}
+	if err := cfg.AddPath("prod/ssh/b"); err != nil {
+		t.Fatalf("AddPath failed: %v", err)
+	}
+	if !slices.Equal(cfg.AWSPaths, []string{"prod/ssh/b"}) || !slices.Equal(cfg.GetPaths(), []string{"prod/ssh/b"}) {
+		t.Errorf("AWSPaths = %v and GetPaths() = %v, want the path in aws_paths", cfg.AWSPaths, cfg.GetPaths())
+	}
+
+	saved, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !slices.Equal(saved.AWSPaths, []string{"prod/ssh/b"}) {
+		t.Errorf("saved aws_paths = %v", saved.AWSPaths)
+	}
+}
+
 func TestConfigAddPath_duplicate(t *testing.T) {
 	// Use temp file for testing
 	tmpDir := t.TempDir()
@@ -161,3 +195,520 @@ func TestConfigAddPath_duplicate(t *testing.T) {
 		t.Errorf("Expected 2 paths in file, got %d", len(readCfg.VaultPaths))
 	}
 }
+
+func TestGetKeyOptions(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{
+		"default_provider": "vault",
+		"vault_paths": ["secret/ssh/prod", "secret/ssh/dev"],
+		"key_options": {"secret/ssh/prod": {"confirm": true}}
+	}`), &cfg); err != nil {
+		t.Fatalf("failed to unmarshal config: %v", err)
+	}
+
+	if !cfg.GetKeyOptions("secret/ssh/prod").Confirm {
+		t.Error("GetKeyOptions(prod).Confirm = false, want true")
+	}
+	if cfg.GetKeyOptions("secret/ssh/dev").Confirm {
+		t.Error("GetKeyOptions(dev).Confirm = true, want false")
+	}
+
+	empty := &Config{DefaultProvider: ProviderVault}
+	if empty.GetKeyOptions("secret/ssh/any").Confirm {
+		t.Error("GetKeyOptions on config without key_options should return zero value")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"7d", 7 * 24 * time.Hour},
+		{"0d", 0},
+		{"36h", 36 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got, err := ParseDuration(tt.value); err != nil || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "d", "1.5d", "-1d", "-1h", "week"} {
+		if _, err := ParseDuration(value); err == nil {
+			t.Errorf("ParseDuration(%q) expected error, got nil", value)
+		}
+	}
+}
+
+func TestGetRotationGrace(t *testing.T) {
+	if grace, err := (&Config{}).GetRotationGrace(); err != nil || grace != DefaultRotationGrace {
+		t.Errorf("GetRotationGrace without config = %v, %v, want %v", grace, err, DefaultRotationGrace)
+	}
+	if grace, err := (&Config{RotationGrace: "30d"}).GetRotationGrace(); err != nil || grace != 30*24*time.Hour {
+		t.Errorf("GetRotationGrace = %v, %v, want 720h", grace, err)
+	}
+	if _, err := (&Config{RotationGrace: "soon"}).GetRotationGrace(); err == nil {
+		t.Error("expected error for invalid rotation_grace, got nil")
+	}
+}
+
+func TestGetMaxKeyAge(t *testing.T) {
+	if maxAge, err := (&Config{}).GetMaxKeyAge(); err != nil || maxAge != DefaultMaxKeyAge {
+		t.Errorf("GetMaxKeyAge without config = %v, %v, want %v", maxAge, err, DefaultMaxKeyAge)
+	}
+	if maxAge, err := (&Config{MaxKeyAge: "90d"}).GetMaxKeyAge(); err != nil || maxAge != 90*24*time.Hour {
+		t.Errorf("GetMaxKeyAge = %v, %v, want 2160h", maxAge, err)
+	}
+	if _, err := (&Config{MaxKeyAge: "3 months"}).GetMaxKeyAge(); err == nil {
+		t.Error("expected error for invalid max_key_age, got nil")
+	}
+}
+
+func TestUpdate_concurrent(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := (&Config{DefaultProvider: ProviderVault}).Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Every update reads the file under the lock, so none of the paths is lost
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Update(func(cfg *Config) error {
+				cfg.VaultPaths = append(cfg.VaultPaths, fmt.Sprintf("secret/data/ssh/%d", i))
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Update failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cfg, err := Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(cfg.VaultPaths) != 20 {
+		t.Errorf("got %d paths, want 20: %v", len(cfg.VaultPaths), cfg.VaultPaths)
+	}
+
+	// Invalid results are not written
+	err = Update(func(cfg *Config) error {
+		cfg.MaxKeyAge = "soon"
+		return nil
+	})
+	if err == nil {
+		t.Error("expected error for invalid max_key_age, got nil")
+	}
+	if cfg, _ := Read(); cfg.MaxKeyAge != "" {
+		t.Errorf("invalid max_key_age was written: %q", cfg.MaxKeyAge)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(home, ".config"))
+	for _, entry := range entries {
+		if entry.Name() != ConfigFileName && entry.Name() != ConfigFileName+".lock" {
+			t.Errorf("unexpected file left in config directory: %s", entry.Name())
+		}
+	}
+}
+
+func TestSave_restricts_permissions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".config", ConfigFileName)
+	os.Mkdir(filepath.Dir(configPath), 0755)
+	os.WriteFile(configPath, []byte(`{"default_provider": "vault"}`), 0644)
+
+	if err := (&Config{DefaultProvider: ProviderVault, VaultPaths: []string{"secret/data/ssh/a"}}).Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("permissions = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestRemovePath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := &Config{
+		DefaultProvider: ProviderVault,
+		VaultPaths:      []string{"secret/data/ssh/a", "secret/data/ssh/b"},
+		KeyOptions:      map[string]KeyOptions{"secret/data/ssh/a": {Confirm: true}},
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if err := cfg.RemovePath("secret/data/ssh/a"); err != nil {
+		t.Fatalf("RemovePath failed: %v", err)
+	}
+	saved, err := Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !slices.Equal(saved.VaultPaths, []string{"secret/data/ssh/b"}) || len(saved.KeyOptions) != 0 {
+		t.Errorf("saved config = %+v, want only secret/data/ssh/b without key options", saved)
+	}
+	if err := cfg.RemovePath("secret/data/ssh/a"); err == nil {
+		t.Error("expected error for a path that is not configured, got nil")
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	cfg := &Config{DefaultProvider: ProviderVault}
+
+	tests := []struct {
+		key, value, want string
+	}{
+		{key: "vault_address", value: "https://vault:8200", want: "https://vault:8200"},
+		{key: "passphrase_policy.min_length", value: "12", want: "12"},
+		{key: "passphrase_policy.min_entropy", value: "60.5", want: "60.5"},
+		{key: "key_options.secret/data/ssh/a.b.confirm", value: "true", want: "true"},
+		{key: "key_options.secret/data/ssh/a.b.restrict", value: "github.com, bastion", want: "github.com,bastion"},
+	}
+	for _, tt := range tests {
+		if err := cfg.Set(tt.key, tt.value); err != nil {
+			t.Errorf("Set(%q) failed: %v", tt.key, err)
+			continue
+		}
+		if got, err := cfg.Get(tt.key); err != nil || got != tt.want {
+			t.Errorf("Get(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+	if !cfg.KeyOptions["secret/data/ssh/a.b"].Confirm {
+		t.Errorf("key options = %+v, want confirm for secret/data/ssh/a.b", cfg.KeyOptions)
+	}
+
+	// Empty values reset settings, and key options without settings are dropped
+	for _, key := range []string{"passphrase_policy.min_length", "key_options.secret/data/ssh/a.b.confirm", "key_options.secret/data/ssh/a.b.restrict"} {
+		if err := cfg.Set(key, ""); err != nil {
+			t.Errorf("Set(%q, \"\") failed: %v", key, err)
+		}
+	}
+	if cfg.PassphrasePolicy.MinLength != 0 || len(cfg.KeyOptions) != 0 {
+		t.Errorf("config = %+v, want reset settings", cfg)
+	}
+
+	for _, key := range []string{"vault_paths", "key_options.secret/data/ssh/a.unknown", "unknown"} {
+		if _, err := cfg.Get(key); err == nil {
+			t.Errorf("Get(%q) expected error, got nil", key)
+		}
+	}
+	if err := cfg.Set("passphrase_policy.min_length", "twelve"); err == nil {
+		t.Error("expected error for a non-numeric min_length, got nil")
+	}
+}
+
+func TestConfigPath_precedence(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	want := filepath.Join(home, ".config", ConfigFileName)
+	if got, _ := Path(); got != want {
+		t.Errorf("Path() = %q, want %q", got, want)
+	}
+
+	// Relative XDG_CONFIG_HOME values are ignored
+	t.Setenv("XDG_CONFIG_HOME", "relative")
+	if got, _ := Path(); got != want {
+		t.Errorf("Path() with relative XDG_CONFIG_HOME = %q, want %q", got, want)
+	}
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, _ := Path(); got != filepath.Join("/xdg", ConfigFileName) {
+		t.Errorf("Path() with XDG_CONFIG_HOME = %q", got)
+	}
+	t.Setenv("SM_SSH_ADD_CONFIG", "/project/sm-ssh-add.json")
+	if got, _ := Path(); got != "/project/sm-ssh-add.json" {
+		t.Errorf("Path() with SM_SSH_ADD_CONFIG = %q", got)
+	}
+
+	ExplicitPath = "/flag/config.json"
+	t.Cleanup(func() { ExplicitPath = "" })
+	if got, _ := Path(); got != "/flag/config.json" {
+		t.Errorf("Path() with --config = %q", got)
+	}
+}
+
+func TestRead_merges_system_config(t *testing.T) {
+	dir := t.TempDir()
+	userPath := filepath.Join(dir, "user.json")
+	t.Setenv("SM_SSH_ADD_CONFIG", userPath)
+	systemPath := SystemPath
+	SystemPath = filepath.Join(dir, "system.json")
+	t.Cleanup(func() { SystemPath = systemPath })
+
+	os.WriteFile(SystemPath, []byte(`{
+		"default_provider": "vault",
+		"vault_address": "https://vault.corp:8200",
+		"vault_paths": ["secret/data/ssh/team"],
+		"key_options": {"secret/data/ssh/team": {"confirm": true}},
+		"passphrase_policy": {"min_length": 12},
+		"max_key_age": "90d"
+	}`), 0644)
+
+	// Without a user config the system config is used as is
+	cfg, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if cfg.VaultAddress != "https://vault.corp:8200" || !slices.Equal(cfg.VaultPaths, []string{"secret/data/ssh/team"}) {
+		t.Errorf("config = %+v, want the system config", cfg)
+	}
+
+	os.WriteFile(userPath, []byte(`{
+		"vault_paths": ["secret/data/ssh/mine", "secret/data/ssh/team"],
+		"key_options": {"secret/data/ssh/team": {"restrict": ["bastion"]}},
+		"passphrase_policy": {"min_entropy": 60},
+		"max_key_age": "30d"
+	}`), 0600)
+
+	cfg, err = Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if cfg.DefaultProvider != ProviderVault || cfg.VaultAddress != "https://vault.corp:8200" || cfg.MaxKeyAge != "30d" {
+		t.Errorf("settings = %+v, want system settings overridden by the user's", cfg)
+	}
+	if !slices.Equal(cfg.VaultPaths, []string{"secret/data/ssh/team", "secret/data/ssh/mine"}) {
+		t.Errorf("VaultPaths = %v, want system paths followed by the user's", cfg.VaultPaths)
+	}
+	if opts := cfg.GetKeyOptions("secret/data/ssh/team"); opts.Confirm || !slices.Equal(opts.Restrict, []string{"bastion"}) {
+		t.Errorf("key options = %+v, want the user's options replacing the system's", opts)
+	}
+	if cfg.PassphrasePolicy != (PassphrasePolicy{MinLength: 12, MinEntropy: 60}) {
+		t.Errorf("PassphrasePolicy = %+v, want both fields", cfg.PassphrasePolicy)
+	}
+
+	// Writes only change the user config
+	if err := cfg.AddPath("secret/data/ssh/new"); err != nil {
+		t.Fatalf("AddPath failed: %v", err)
+	}
+	user, err := readFile(userPath)
+	if err != nil {
+		t.Fatalf("readFile failed: %v", err)
+	}
+	if user.DefaultProvider != "" || user.VaultAddress != "" ||
+		!slices.Equal(user.VaultPaths, []string{"secret/data/ssh/mine", "secret/data/ssh/team", "secret/data/ssh/new"}) {
+		t.Errorf("user config = %+v, want only the user's settings and the new path", user)
+	}
+
+	os.WriteFile(userPath, []byte(`{}`), 0600)
+	cfg, _ = Read()
+	if err := cfg.RemovePath("secret/data/ssh/team"); err == nil {
+		t.Error("expected error removing a path of the system config, got nil")
+	}
+}
+
+// profilesConfig is a config with a personal and a work profile
+const profilesConfig = `{
+	"default_provider": "vault",
+	"vault_address": "https://vault.corp:8200",
+	"vault_paths": ["secret/data/ssh/default"],
+	"max_key_age": "60d",
+	"profiles": {
+		"personal": {"vault_address": "https://bao.home:8200", "vault_token_env": "HOME_BAO_TOKEN", "vault_paths": ["kv/data/ssh/github"]},
+		"work": {"vault_namespace": "eng", "vault_approle_role_id": "role", "vault_paths": ["secret/data/ssh/prod"]}
+	}
+}`
+
+func TestRead_selects_profile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configPath, []byte(profilesConfig), 0600)
+	t.Setenv("SM_SSH_ADD_CONFIG", configPath)
+
+	cfg, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if cfg.GetProfile() != "" || !slices.Equal(cfg.GetPaths(), []string{"secret/data/ssh/default"}) {
+		t.Errorf("without a profile got profile %q and paths %v, want the top-level settings", cfg.GetProfile(), cfg.GetPaths())
+	}
+	if names := cfg.ProfileNames(); !slices.Equal(names, []string{"personal", "work"}) {
+		t.Errorf("ProfileNames() = %v", names)
+	}
+
+	t.Setenv("SM_SSH_ADD_PROFILE", "personal")
+	cfg, err = Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if cfg.GetProfile() != "personal" || cfg.DefaultProvider != ProviderVault || cfg.VaultAddress != "https://bao.home:8200" ||
+		cfg.VaultTokenEnv != "HOME_BAO_TOKEN" || !slices.Equal(cfg.GetPaths(), []string{"kv/data/ssh/github"}) {
+		t.Errorf("personal profile = %+v", cfg)
+	}
+	if cfg.MaxKeyAge != "60d" {
+		t.Errorf("MaxKeyAge = %q, want the shared setting", cfg.MaxKeyAge)
+	}
+
+	// The flag wins over the environment, and replaces all secret manager settings
+	SelectedProfile = "work"
+	t.Cleanup(func() { SelectedProfile = "" })
+	cfg, err = Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if cfg.GetProfile() != "work" || cfg.VaultAddress != "" || cfg.VaultNamespace != "eng" || cfg.VaultApproleRoleID != "role" {
+		t.Errorf("work profile = %+v", cfg)
+	}
+
+	SelectedProfile = "missing"
+	if _, err := Read(); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Read() error = %v, want ErrUnknownProfile", err)
+	}
+}
+
+func TestValidate_profiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "profiles without default provider", cfg: Config{Profiles: map[string]*Profile{"a": {Provider: ProviderVault}}}},
+		{name: "profile inheriting the default provider", cfg: Config{DefaultProvider: ProviderVault, Profiles: map[string]*Profile{"a": {}}}},
+		{name: "profile without any provider", cfg: Config{Profiles: map[string]*Profile{"a": {}}}, wantErr: true},
+		{name: "unsupported profile provider", cfg: Config{DefaultProvider: ProviderVault, Profiles: map[string]*Profile{"a": {Provider: "gcp"}}}, wantErr: true},
+		{name: "null profile", cfg: Config{DefaultProvider: ProviderVault, Profiles: map[string]*Profile{"a": nil}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddPath_writes_to_selected_profile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configPath, []byte(profilesConfig), 0600)
+	t.Setenv("SM_SSH_ADD_CONFIG", configPath)
+	t.Setenv("SM_SSH_ADD_PROFILE", "work")
+
+	cfg, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if err := cfg.AddPath("secret/data/ssh/staging"); err != nil {
+		t.Fatalf("AddPath failed: %v", err)
+	}
+	if err := cfg.RemovePath("secret/data/ssh/prod"); err != nil {
+		t.Fatalf("RemovePath failed: %v", err)
+	}
+
+	saved, err := readFile(configPath)
+	if err != nil {
+		t.Fatalf("readFile failed: %v", err)
+	}
+	if !slices.Equal(saved.Profiles["work"].VaultPaths, []string{"secret/data/ssh/staging"}) {
+		t.Errorf("work paths = %v, want the added path only", saved.Profiles["work"].VaultPaths)
+	}
+	if !slices.Equal(saved.VaultPaths, []string{"secret/data/ssh/default"}) || saved.VaultNamespace != "" {
+		t.Errorf("top-level settings changed: %+v", saved)
+	}
+}
+
+func TestSaveSetting_writes_to_selected_profile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configPath, []byte(profilesConfig), 0600)
+	t.Setenv("SM_SSH_ADD_CONFIG", configPath)
+	t.Setenv("SM_SSH_ADD_PROFILE", "work")
+
+	if err := SaveSetting("vault_address", "https://vault.eng:8200"); err != nil {
+		t.Fatalf("SaveSetting failed: %v", err)
+	}
+	// Settings that profiles don't replace are shared
+	if err := SaveSetting("max_key_age", "30d"); err != nil {
+		t.Fatalf("SaveSetting failed: %v", err)
+	}
+
+	saved, err := readFile(configPath)
+	if err != nil {
+		t.Fatalf("readFile failed: %v", err)
+	}
+	if saved.Profiles["work"].VaultAddress != "https://vault.eng:8200" || saved.Profiles["work"].VaultNamespace != "eng" {
+		t.Errorf("work profile = %+v, want the new address", saved.Profiles["work"])
+	}
+	if saved.VaultAddress != "https://vault.corp:8200" || saved.MaxKeyAge != "30d" {
+		t.Errorf("top-level vault_address = %q, max_key_age = %q, want the address kept and 30d", saved.VaultAddress, saved.MaxKeyAge)
+	}
+
+	cfg, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if value, _ := cfg.Get("vault_address"); value != "https://vault.eng:8200" {
+		t.Errorf("Get(vault_address) = %q with the work profile, want the new address", value)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path, provider, rest string
+	}{
+		{path: "vault://secret/ssh/a", provider: "vault", rest: "secret/ssh/a"},
+		{path: "aws://prod/ssh/b", provider: "aws", rest: "prod/ssh/b"},
+		{path: "secret/ssh/a", provider: "", rest: "secret/ssh/a"},
+		{path: "secret/ssh://a", provider: "", rest: "secret/ssh://a"},
+		{path: "://a", provider: "", rest: "://a"},
+	}
+	for _, tt := range tests {
+		provider, rest := ParsePath(tt.path)
+		if provider != tt.provider || rest != tt.rest {
+			t.Errorf("ParsePath(%q) = %q, %q, want %q, %q", tt.path, provider, rest, tt.provider, tt.rest)
+		}
+	}
+}
+
+func TestPaths_with_provider_scheme(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := &Config{Paths: []string{"vault://secret/ssh/a"}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() without default_provider error = %v", err)
+	}
+
+	// Paths naming their provider go to paths, others to the default provider's list
+	if err := cfg.AddPath("vault://secret/ssh/b"); err != nil {
+		t.Fatalf("AddPath failed: %v", err)
+	}
+	if err := cfg.AddPath("secret/ssh/c"); err == nil {
+		t.Error("expected error adding a path without scheme and default_provider, got nil")
+	}
+	cfg.DefaultProvider = ProviderVault
+	if err := cfg.AddPath("secret/ssh/c"); err != nil {
+		t.Fatalf("AddPath failed: %v", err)
+	}
+	if want := []string{"secret/ssh/c", "vault://secret/ssh/a", "vault://secret/ssh/b"}; !slices.Equal(cfg.GetPaths(), want) {
+		t.Errorf("GetPaths() = %v, want %v", cfg.GetPaths(), want)
+	}
+
+	saved, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !slices.Equal(saved.Paths, []string{"vault://secret/ssh/a", "vault://secret/ssh/b"}) || !slices.Equal(saved.VaultPaths, []string{"secret/ssh/c"}) {
+		t.Errorf("saved paths = %v and vault_paths = %v", saved.Paths, saved.VaultPaths)
+	}
+	if err := saved.RemovePath("vault://secret/ssh/b"); err != nil {
+		t.Fatalf("RemovePath failed: %v", err)
+	}
+
+	// Providers without an implementation are rejected
+	if err := saved.AddPath("aws://prod/ssh/b"); err != nil {
+		t.Errorf("AddPath(aws://...) error = %v", err)
+	}
+	if err := saved.AddPath("gcp://prod/ssh/b"); !errors.Is(err, ErrInvalidProvider) {
+		t.Errorf("AddPath(gcp://...) error = %v, want ErrInvalidProvider", err)
+	}
+	if err := (&Config{Paths: []string{"secret/ssh/a"}}).Validate(); err == nil {
+		t.Error("expected error for a path without scheme in paths, got nil")
+	}
+}
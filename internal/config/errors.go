@@ -10,6 +10,8 @@ var (
 	ErrConfigFileNotFound = errors.New("config file not found")
 	ErrEmptyProvider      = errors.New("default_provider cannot be empty")
 	ErrInvalidProvider    = errors.New("invalid provider")
+	ErrUnknownProfile     = errors.New("unknown profile")
+	ErrNoProfile          = errors.New("no profile selected: use --profile or SM_SSH_ADD_PROFILE")
 )
 
 // wrapError wraps an error with context
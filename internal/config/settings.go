@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// setting reads and writes one config value as a string for the config get and set commands
+type setting struct {
+	get func(c *Config) string
+	set func(c *Config, value string) error
+}
+
+// stringSetting is a setting stored as a plain string field
+func stringSetting(field func(c *Config) *string) setting {
+	return setting{
+		get: func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// settings are the keys accepted by Get and Set. Paths are changed with AddPath and RemovePath,
+// and per-path options with "key_options.<path>.<option>" keys.
+var settings = map[string]setting{
+	"default_provider":              stringSetting(func(c *Config) *string { return &c.DefaultProvider }),
+	"vault_address":                 stringSetting(func(c *Config) *string { return &c.VaultAddress }),
+	"vault_approle_role_id":         stringSetting(func(c *Config) *string { return &c.VaultApproleRoleID }),
+	"vault_namespace":               stringSetting(func(c *Config) *string { return &c.VaultNamespace }),
+	"vault_token_env":               stringSetting(func(c *Config) *string { return &c.VaultTokenEnv }),
+	"aws_region":                    stringSetting(func(c *Config) *string { return &c.AWSRegion }),
+	"pinentry":                      stringSetting(func(c *Config) *string { return &c.Pinentry }),
+	"rotation_grace":                stringSetting(func(c *Config) *string { return &c.RotationGrace }),
+	"max_key_age":                   stringSetting(func(c *Config) *string { return &c.MaxKeyAge }),
+	"passphrase_policy.breach_list": stringSetting(func(c *Config) *string { return &c.PassphrasePolicy.BreachList }),
+	"passphrase_policy.min_length": {
+		get: func(c *Config) string { return strconv.Itoa(c.PassphrasePolicy.MinLength) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid passphrase_policy.min_length %q: must be a number", value)
+			}
+			c.PassphrasePolicy.MinLength = n
+			return nil
+		},
+	},
+	"passphrase_policy.min_entropy": {
+		get: func(c *Config) string { return strconv.FormatFloat(c.PassphrasePolicy.MinEntropy, 'f', -1, 64) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid passphrase_policy.min_entropy %q: must be a number", value)
+			}
+			c.PassphrasePolicy.MinEntropy = n
+			return nil
+		},
+	},
+}
+
+// profileSettings are the settings that a selected profile replaces, see WithProfile
+var profileSettings = map[string]func(p *Profile) *string{
+	"default_provider":      func(p *Profile) *string { return &p.Provider },
+	"vault_address":         func(p *Profile) *string { return &p.VaultAddress },
+	"vault_namespace":       func(p *Profile) *string { return &p.VaultNamespace },
+	"vault_approle_role_id": func(p *Profile) *string { return &p.VaultApproleRoleID },
+	"vault_token_env":       func(p *Profile) *string { return &p.VaultTokenEnv },
+	"aws_region":            func(p *Profile) *string { return &p.AWSRegion },
+}
+
+// keyOptionSettings are the options of "key_options.<path>.<option>" keys
+var keyOptionSettings = map[string]struct {
+	get func(o *KeyOptions) string
+	set func(o *KeyOptions, value string) error
+}{
+	"confirm": {
+		get: func(o *KeyOptions) string { return strconv.FormatBool(o.Confirm) },
+		set: func(o *KeyOptions, value string) error {
+			confirm, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid confirm %q: must be true or false", value)
+			}
+			o.Confirm = confirm
+			return nil
+		},
+	},
+	"restrict": {
+		get: func(o *KeyOptions) string { return strings.Join(o.Restrict, ",") },
+		set: func(o *KeyOptions, value string) error {
+			o.Restrict = nil
+			for _, d := range strings.Split(value, ",") {
+				if d = strings.TrimSpace(d); d != "" {
+					o.Restrict = append(o.Restrict, d)
+				}
+			}
+			return nil
+		},
+	},
+	"passphrase_path": {
+		get: func(o *KeyOptions) string { return o.PassphrasePath },
+		set: func(o *KeyOptions, value string) error {
+			o.PassphrasePath = value
+			return nil
+		},
+	},
+}
+
+// SettingKeys returns the keys accepted by Get and Set, sorted
+func SettingKeys() []string {
+	keys := make([]string, 0, len(settings)+len(keyOptionSettings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	for option := range keyOptionSettings {
+		keys = append(keys, "key_options.<path>."+option)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// splitKeyOption splits a "key_options.<path>.<option>" key. Paths may contain dots, so the option
+// is taken from the end.
+func splitKeyOption(key string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(key, "key_options.")
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, ".")
+	if i <= 0 {
+		return "", "", false
+	}
+	if _, ok := keyOptionSettings[rest[i+1:]]; !ok {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// Get returns the value of a setting as a string
+func (c *Config) Get(key string) (string, error) {
+	if s, ok := settings[key]; ok {
+		return s.get(c), nil
+	}
+	if path, option, ok := splitKeyOption(key); ok {
+		opts := c.KeyOptions[path]
+		return keyOptionSettings[option].get(&opts), nil
+	}
+	return "", fmt.Errorf("unknown setting %q", key)
+}
+
+// Set changes a setting from its string form. An empty value resets it to the default.
+func (c *Config) Set(key, value string) error {
+	if s, ok := settings[key]; ok {
+		if value == "" {
+			// Reset through the zero value of a fresh config so numbers are cleared too
+			return s.set(c, s.get(&Config{}))
+		}
+		return s.set(c, value)
+	}
+
+	path, option, ok := splitKeyOption(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	opts := c.KeyOptions[path]
+	if value == "" {
+		value = keyOptionSettings[option].get(&KeyOptions{})
+	}
+	if err := keyOptionSettings[option].set(&opts, value); err != nil {
+		return err
+	}
+
+	if c.KeyOptions == nil {
+		c.KeyOptions = map[string]KeyOptions{}
+	}
+	if opts.Confirm || len(opts.Restrict) > 0 || opts.PassphrasePath != "" {
+		c.KeyOptions[path] = opts
+	} else {
+		delete(c.KeyOptions, path)
+	}
+	return nil
+}
+
+// SaveSetting changes a setting like Set and writes the config file. Settings that a profile
+// replaces are written to the selected profile if there is one, as AddPath does for paths.
+func SaveSetting(key, value string) error {
+	field, ok := profileSettings[key]
+	if !ok || selectedProfile() == "" {
+		return Update(func(cfg *Config) error {
+			return cfg.Set(key, value)
+		})
+	}
+
+	cfg, err := Read()
+	if err != nil {
+		return err
+	}
+	return update(cfg, func(saved *Config) error {
+		*field(cfg.savedProfile(saved)) = value
+		return nil
+	})
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package config
+
+// defaultSystemPath returns the location of the system-wide config file
+func defaultSystemPath() string {
+	return "/etc/sm-ssh-add/config.json"
+}
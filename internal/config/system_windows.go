@@ -0,0 +1,17 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultSystemPath returns the location of the system-wide config file
+func defaultSystemPath() string {
+	dir := os.Getenv("ProgramData")
+	if dir == "" {
+		dir = `C:\ProgramData`
+	}
+	return filepath.Join(dir, "sm-ssh-add", "config.json")
+}
@@ -0,0 +1,121 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// assuanEscape escapes characters that cannot appear in an Assuan command argument
+func assuanEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// assuanUnescape decodes the percent escapes of an Assuan data line
+func assuanUnescape(s string) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return nil, errors.New("truncated escape in pinentry response")
+		}
+		b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid escape in pinentry response: %w", err)
+		}
+		out = append(out, byte(b))
+		i += 2
+	}
+	return out, nil
+}
+
+// assuanConn is a client connection to an Assuan server over its stdin and stdout
+type assuanConn struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// readResponse reads lines until OK or ERR and returns the decoded data lines
+func (c *assuanConn) readResponse() ([]byte, error) {
+	var data []byte
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pinentry response: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return data, nil
+		case strings.HasPrefix(line, "ERR "):
+			return nil, fmt.Errorf("pinentry: %s", strings.TrimPrefix(line, "ERR "))
+		case strings.HasPrefix(line, "D "):
+			chunk, err := assuanUnescape(strings.TrimPrefix(line, "D "))
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, chunk...)
+		}
+		// Status (S) and comment (#) lines are ignored
+	}
+}
+
+// command sends a command and waits for its response
+func (c *assuanConn) command(cmd string) ([]byte, error) {
+	if _, err := fmt.Fprintf(c.w, "%s\n", cmd); err != nil {
+		return nil, fmt.Errorf("failed to write to pinentry: %w", err)
+	}
+	return c.readResponse()
+}
+
+// pinentryPassword asks for a secret with a pinentry program using the Assuan protocol
+func pinentryPassword(program, prompt string) ([]byte, error) {
+	cmd := exec.Command(program)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start pinentry: %w", err)
+	}
+	defer func() {
+		stdin.Close()
+		_ = cmd.Wait()
+	}()
+
+	conn := &assuanConn{r: bufio.NewReader(stdout), w: stdin}
+	// Greeting
+	if _, err := conn.readResponse(); err != nil {
+		return nil, err
+	}
+
+	description := strings.TrimSuffix(strings.TrimSpace(prompt), ":")
+	for _, cmd := range []string{
+		"SETTITLE sm-ssh-add",
+		"SETDESC " + assuanEscape(description),
+		"SETPROMPT Passphrase:",
+	} {
+		if _, err := conn.command(cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	password, err := conn.command("GETPIN")
+	if err != nil {
+		return nil, err
+	}
+	_, _ = conn.command("BYE")
+	return password, nil
+}
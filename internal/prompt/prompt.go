@@ -0,0 +1,81 @@
+// Package prompt reads passphrases without echoing them. It uses the controlling terminal when
+// there is one and falls back to SSH_ASKPASS or a pinentry program, so prompts also work from
+// desktop autostart and systemd units.
+package prompt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrNoPrompt is returned when there is no way to ask the user for a passphrase
+var ErrNoPrompt = errors.New("no terminal to read the passphrase from: set SSH_ASKPASS or configure pinentry")
+
+// Pinentry is the pinentry program used when there is no terminal and SSH_ASKPASS is not usable.
+// It is set from the configuration.
+var Pinentry string
+
+// openTTY opens the controlling terminal, returning where to read input and write the prompt
+var openTTY = openTerminal
+
+// Password asks the user for a secret. prompt is shown as is, e.g. "Enter passphrase: ".
+// SSH_ASKPASS_REQUIRE is honoured the same way as by ssh: "force" always uses SSH_ASKPASS,
+// "prefer" uses it before the terminal and "never" disables it.
+func Password(prompt string) ([]byte, error) {
+	askpass := os.Getenv("SSH_ASKPASS")
+	require := os.Getenv("SSH_ASKPASS_REQUIRE")
+	hasDisplay := os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+
+	if askpass != "" && (require == "force" || (require == "prefer" && hasDisplay)) {
+		return askpassPassword(askpass, prompt)
+	}
+
+	in, out, err := openTTY()
+	if err == nil {
+		defer in.Close()
+		return terminalPassword(in, out, prompt)
+	}
+
+	if askpass != "" && require != "never" && hasDisplay {
+		return askpassPassword(askpass, prompt)
+	}
+	if Pinentry != "" {
+		return pinentryPassword(Pinentry, prompt)
+	}
+	return nil, ErrNoPrompt
+}
+
+// terminalPassword reads a line from the terminal with echo disabled
+func terminalPassword(in *os.File, out io.Writer, prompt string) ([]byte, error) {
+	fmt.Fprint(out, prompt)
+	password, err := term.ReadPassword(int(in.Fd()))
+	// The newline typed by the user is not echoed either
+	fmt.Fprintln(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from terminal: %w", err)
+	}
+	return password, nil
+}
+
+// askpassPassword runs the SSH_ASKPASS program, which prints the secret on stdout
+func askpassPassword(askpass, prompt string) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd := exec.Command(askpass, strings.TrimSpace(prompt))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s was cancelled or failed: %w", askpass, err)
+	}
+
+	password := stdout.Bytes()
+	password = bytes.TrimSuffix(password, []byte("\n"))
+	password = bytes.TrimSuffix(password, []byte("\r"))
+	return password, nil
+}
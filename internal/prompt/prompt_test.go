@@ -0,0 +1,164 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// helperEnv selects the fake askpass or pinentry the test binary acts as when run by a test
+const helperEnv = "PROMPT_TEST_HELPER"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperEnv) {
+	case "askpass":
+		// Echo the prompt back as the answer so tests can check it was passed
+		fmt.Printf("answer to %s\n", os.Args[len(os.Args)-1])
+		os.Exit(0)
+	case "pinentry", "pinentry-cancel":
+		fakePinentry(os.Getenv(helperEnv) == "pinentry-cancel")
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakePinentry speaks enough of the Assuan protocol to answer GETPIN with the description
+func fakePinentry(cancel bool) {
+	fmt.Println("OK Pleased to meet you")
+	description := ""
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		cmd, arg, _ := strings.Cut(scanner.Text(), " ")
+		switch cmd {
+		case "SETDESC":
+			description = arg
+			fmt.Println("OK")
+		case "GETPIN":
+			if cancel {
+				fmt.Println("ERR 83886179 Operation cancelled <Pinentry>")
+				continue
+			}
+			fmt.Println("S PASSWORD_FROMCACHE")
+			fmt.Printf("D %%25 %s\n", description)
+			fmt.Println("OK")
+		case "BYE":
+			fmt.Println("OK closing connection")
+			return
+		default:
+			fmt.Println("OK")
+		}
+	}
+}
+
+// withoutTerminal simulates running without a controlling terminal
+func withoutTerminal(t *testing.T) {
+	t.Helper()
+	open := openTTY
+	openTTY = func() (*os.File, io.Writer, error) {
+		return nil, nil, errors.New("no terminal")
+	}
+	t.Cleanup(func() { openTTY = open })
+}
+
+// withPinentry configures the pinentry program for the duration of the test
+func withPinentry(t *testing.T, program string) {
+	t.Helper()
+	pinentry := Pinentry
+	Pinentry = program
+	t.Cleanup(func() { Pinentry = pinentry })
+}
+
+func TestPasswordAskpass(t *testing.T) {
+	withoutTerminal(t)
+	t.Setenv(helperEnv, "askpass")
+	t.Setenv("SSH_ASKPASS", os.Args[0])
+	t.Setenv("SSH_ASKPASS_REQUIRE", "")
+	t.Setenv("DISPLAY", ":0")
+
+	password, err := Password("Enter passphrase for key secret/ssh/a: ")
+	if err != nil {
+		t.Fatalf("Password failed: %v", err)
+	}
+	if want := "answer to Enter passphrase for key secret/ssh/a:"; string(password) != want {
+		t.Errorf("password = %q, want %q", password, want)
+	}
+}
+
+func TestPasswordAskpassForced(t *testing.T) {
+	open := openTTY
+	openTTY = func() (*os.File, io.Writer, error) {
+		t.Error("terminal should not be used when SSH_ASKPASS_REQUIRE=force")
+		return nil, nil, errors.New("no terminal")
+	}
+	t.Cleanup(func() { openTTY = open })
+	t.Setenv(helperEnv, "askpass")
+	t.Setenv("SSH_ASKPASS", os.Args[0])
+	t.Setenv("SSH_ASKPASS_REQUIRE", "force")
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+
+	if _, err := Password("Enter passphrase: "); err != nil {
+		t.Fatalf("Password failed: %v", err)
+	}
+}
+
+func TestPasswordPinentry(t *testing.T) {
+	withoutTerminal(t)
+	withPinentry(t, os.Args[0])
+	t.Setenv(helperEnv, "pinentry")
+	// Without a display SSH_ASKPASS is not used
+	t.Setenv("SSH_ASKPASS", "/nonexistent/askpass")
+	t.Setenv("SSH_ASKPASS_REQUIRE", "")
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+
+	password, err := Password("Enter passphrase for key 100%\n: ")
+	if err != nil {
+		t.Fatalf("Password failed: %v", err)
+	}
+	// The fake pinentry answers "%25 " followed by the escaped description it received
+	if want := "% Enter passphrase for key 100%\n"; string(password) != want {
+		t.Errorf("password = %q, want %q", password, want)
+	}
+}
+
+func TestPasswordPinentryCancelled(t *testing.T) {
+	withoutTerminal(t)
+	withPinentry(t, os.Args[0])
+	t.Setenv(helperEnv, "pinentry-cancel")
+	t.Setenv("SSH_ASKPASS", "")
+
+	if _, err := Password("Enter passphrase: "); err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("expected cancellation error, got %v", err)
+	}
+}
+
+func TestPasswordNoPrompt(t *testing.T) {
+	withoutTerminal(t)
+	withPinentry(t, "")
+	t.Setenv("SSH_ASKPASS", "")
+
+	if _, err := Password("Enter passphrase: "); !errors.Is(err, ErrNoPrompt) {
+		t.Errorf("expected ErrNoPrompt, got %v", err)
+	}
+}
+
+func TestAssuanUnescape(t *testing.T) {
+	got, err := assuanUnescape("a%25b%0Ac%0d")
+	if err != nil {
+		t.Fatalf("assuanUnescape failed: %v", err)
+	}
+	if string(got) != "a%b\nc\r" {
+		t.Errorf("assuanUnescape = %q, want %q", got, "a%b\nc\r")
+	}
+
+	for _, invalid := range []string{"%", "%2", "%zz"} {
+		if _, err := assuanUnescape(invalid); err == nil {
+			t.Errorf("assuanUnescape(%q) expected error, got nil", invalid)
+		}
+	}
+}
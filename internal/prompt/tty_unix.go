@@ -0,0 +1,17 @@
+//go:build !windows
+
+package prompt
+
+import (
+	"io"
+	"os"
+)
+
+// openTerminal opens the controlling terminal for both input and the prompt
+func openTerminal() (*os.File, io.Writer, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tty, tty, nil
+}
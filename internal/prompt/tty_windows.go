@@ -0,0 +1,17 @@
+//go:build windows
+
+package prompt
+
+import (
+	"io"
+	"os"
+)
+
+// openTerminal opens the console input; the prompt is written to stderr
+func openTerminal() (*os.File, io.Writer, error) {
+	console, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return console, os.Stderr, nil
+}
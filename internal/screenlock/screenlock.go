@@ -0,0 +1,3 @@
+// Package screenlock reports when the screen of the desktop session is locked, so agents can
+// lock themselves with it.
+package screenlock
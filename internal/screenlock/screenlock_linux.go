@@ -0,0 +1,73 @@
+//go:build linux
+
+package screenlock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// matchRules select the ActiveChanged signals of the freedesktop and GNOME screen savers
+var matchRules = []string{
+	"type='signal',interface='org.freedesktop.ScreenSaver',member='ActiveChanged'",
+	"type='signal',interface='org.gnome.ScreenSaver',member='ActiveChanged'",
+}
+
+// Watch returns a channel that receives whenever the screen is locked, as reported by the screen
+// saver on the D-Bus session bus. Signals are read with dbus-monitor until ctx is cancelled, and
+// the channel is closed when it stops.
+func Watch(ctx context.Context) (<-chan struct{}, error) {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, errors.New("screen lock signals need a D-Bus session bus (DBUS_SESSION_BUS_ADDRESS is not set)")
+	}
+	monitor, err := exec.LookPath("dbus-monitor")
+	if err != nil {
+		return nil, fmt.Errorf("screen lock signals need dbus-monitor: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, monitor, append([]string{"--session"}, matchRules...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start dbus-monitor: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start dbus-monitor: %w", err)
+	}
+
+	locked := make(chan struct{}, 1)
+	go func() {
+		defer close(locked)
+		parseMonitor(stdout, locked)
+		_ = cmd.Wait()
+	}()
+	return locked, nil
+}
+
+// parseMonitor reads dbus-monitor output and sends on locked for every ActiveChanged signal
+// whose argument is true. Locks that are not received yet are merged into one.
+func parseMonitor(r io.Reader, locked chan<- struct{}) {
+	scanner := bufio.NewScanner(r)
+	activeChanged := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "signal ") {
+			activeChanged = strings.Contains(line, "member=ActiveChanged")
+			continue
+		}
+
+		// The argument follows on the next line
+		if activeChanged && line == "boolean true" {
+			select {
+			case locked <- struct{}{}:
+			default:
+			}
+		}
+		activeChanged = false
+	}
+}
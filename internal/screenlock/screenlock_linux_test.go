@@ -0,0 +1,32 @@
+//go:build linux
+
+package screenlock
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMonitor(t *testing.T) {
+	output := `signal time=1767322800.000000 sender=org.freedesktop.DBus -> destination=:1.42 serial=2 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameAcquired
+   string ":1.42"
+signal time=1767322801.000000 sender=:1.7 -> destination=(null destination) serial=10 path=/org/freedesktop/ScreenSaver; interface=org.freedesktop.ScreenSaver; member=ActiveChanged
+   boolean false
+signal time=1767322802.000000 sender=:1.7 -> destination=(null destination) serial=11 path=/org/freedesktop/ScreenSaver; interface=org.freedesktop.ScreenSaver; member=ActiveChanged
+   boolean true
+`
+
+	locked := make(chan struct{}, 1)
+	parseMonitor(strings.NewReader(output), locked)
+
+	select {
+	case <-locked:
+	default:
+		t.Fatal("expected a lock for ActiveChanged true")
+	}
+	select {
+	case <-locked:
+		t.Error("expected only one lock")
+	default:
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package screenlock
+
+import (
+	"context"
+	"errors"
+)
+
+// Watch is only supported on Linux, where screen savers report locking on D-Bus
+func Watch(ctx context.Context) (<-chan struct{}, error) {
+	return nil, errors.New("screen lock signals are only supported on Linux")
+}
@@ -0,0 +1,376 @@
+package sm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// AWSConfig is the interface for the AWS region configuration, like VaultConfig
+type AWSConfig interface {
+	GetAWSRegion() string
+	GetProfile() string
+}
+
+// secretsManagerAPI is the part of the Secrets Manager client used by AWSClient
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+	ListSecretVersionIds(ctx context.Context, params *secretsmanager.ListSecretVersionIdsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretVersionIdsOutput, error)
+	TagResource(ctx context.Context, params *secretsmanager.TagResourceInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.TagResourceOutput, error)
+	UntagResource(ctx context.Context, params *secretsmanager.UntagResourceInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UntagResourceOutput, error)
+}
+
+// AWSClient implements Provider for AWS Secrets Manager. Paths are secret names, and each secret
+// holds the same fields as a Vault secret as a JSON object.
+type AWSClient struct {
+	client secretsManagerAPI
+}
+
+// NewAWSClient creates a Secrets Manager client with the default AWS credential chain: environment
+// variables, shared config and credentials files (including SSO) and instance roles. The region
+// of a profile wins over AWS_REGION, like the Vault address does.
+func NewAWSClient(cfg AWSConfig) (*AWSClient, error) {
+	ctx := context.Background()
+
+	var opts []func(*awsconfig.LoadOptions) error
+	var region string
+	if cfg != nil {
+		region = configOrEnv(cfg, cfg.GetAWSRegion(), "AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, wrapError(err, "failed to load AWS config")
+	}
+	if awsCfg.Region == "" {
+		return nil, fmt.Errorf("aws region required: set AWS_REGION or aws_region in the config")
+	}
+
+	// Verify credentials
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, wrapError(err, ErrAWSCredentials.Error())
+	}
+
+	return &AWSClient{client: secretsmanager.NewFromConfig(awsCfg)}, nil
+}
+
+// isNotFound reports whether err means the secret or secret version does not exist
+func isNotFound(err error) bool {
+	var notFound *types.ResourceNotFoundException
+	return errors.As(err, &notFound)
+}
+
+// getSecretData reads the JSON object of the secret at path, of its current version if versionID
+// is empty
+func (a *AWSClient) getSecretData(path, versionID string) (map[string]interface{}, error) {
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(path)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	out, err := a.client.GetSecretValue(context.Background(), input)
+	if isNotFound(err) {
+		return nil, ErrPathNotFound
+	}
+	if err != nil {
+		return nil, wrapError(err, "failed to read from aws secrets manager")
+	}
+
+	var data map[string]interface{}
+	if out.SecretString == nil || json.Unmarshal([]byte(*out.SecretString), &data) != nil {
+		return nil, ErrInvalidKeyFormat
+	}
+	return data, nil
+}
+
+// putSecretData writes data as the new version of the secret at path, creating the secret if it
+// does not exist
+func (a *AWSClient) putSecretData(path string, data map[string]interface{}) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return wrapError(err, "failed to encode secret")
+	}
+
+	_, err = a.client.PutSecretValue(context.Background(), &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(path),
+		SecretString: aws.String(string(value)),
+	})
+	if isNotFound(err) {
+		_, err = a.client.CreateSecret(context.Background(), &secretsmanager.CreateSecretInput{
+			Name:         aws.String(path),
+			SecretString: aws.String(string(value)),
+		})
+	}
+	if err != nil {
+		return wrapError(err, "failed to write to aws secrets manager")
+	}
+	return nil
+}
+
+// Get retrieves the key stored in the secret named path
+func (a *AWSClient) Get(path string) (*KeyValue, error) {
+	data, err := a.getSecretData(path, "")
+	if err != nil {
+		return nil, err
+	}
+	return keyValueWithPrevious(data)
+}
+
+// Store writes kv as the new version of the secret named path, creating the secret if needed
+func (a *AWSClient) Store(path string, kv *KeyValue) error {
+	return a.putSecretData(path, keyValueSecretData(kv))
+}
+
+// CheckExists checks if a key already exists at the given path
+func (a *AWSClient) CheckExists(path string) (bool, error) {
+	data, err := a.getSecretData(path, "")
+	if errors.Is(err, ErrPathNotFound) {
+		return false, nil
+	}
+	if errors.Is(err, ErrInvalidKeyFormat) {
+		// The secret exists but doesn't hold a key; overwriting it still needs --overwrite
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(data) > 0, nil
+}
+
+// GetPassphrase reads a key passphrase from the "passphrase" field of the secret at path
+func (a *AWSClient) GetPassphrase(path string) ([]byte, error) {
+	data, err := a.getSecretData(path, "")
+	if errors.Is(err, ErrInvalidKeyFormat) {
+		return nil, ErrInvalidPassphraseFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, ok := data["passphrase"].(string)
+	if !ok || passphrase == "" {
+		return nil, ErrInvalidPassphraseFormat
+	}
+	return []byte(passphrase), nil
+}
+
+// StorePassphrase writes a key passphrase to the "passphrase" field of the secret at path,
+// keeping its other fields
+func (a *AWSClient) StorePassphrase(path string, passphrase []byte) error {
+	data := map[string]interface{}{}
+	existing, err := a.getSecretData(path, "")
+	switch {
+	case err == nil:
+		maps.Copy(data, existing)
+	case !errors.Is(err, ErrPathNotFound):
+		return err
+	}
+	data["passphrase"] = string(passphrase)
+	return a.putSecretData(path, data)
+}
+
+// KeyCreated returns when the key currently stored at path was first written, from the creation
+// dates of the secret versions. Earlier versions holding the same public key, such as those
+// replaced by a passphrase change, count towards the age of the key.
+func (a *AWSClient) KeyCreated(path string) (time.Time, error) {
+	var versions []types.SecretVersionsListEntry
+	input := &secretsmanager.ListSecretVersionIdsInput{
+		SecretId:          aws.String(path),
+		IncludeDeprecated: aws.Bool(true),
+	}
+	for {
+		out, err := a.client.ListSecretVersionIds(context.Background(), input)
+		if isNotFound(err) {
+			return time.Time{}, ErrPathNotFound
+		}
+		if err != nil {
+			return time.Time{}, wrapError(err, "failed to list secret versions")
+		}
+		versions = append(versions, out.Versions...)
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+
+	// Newest first, starting from the current version
+	versions = slices.DeleteFunc(versions, func(v types.SecretVersionsListEntry) bool {
+		return v.VersionId == nil || v.CreatedDate == nil
+	})
+	slices.SortFunc(versions, func(a, b types.SecretVersionsListEntry) int {
+		return b.CreatedDate.Compare(*a.CreatedDate)
+	})
+	current := slices.IndexFunc(versions, func(v types.SecretVersionsListEntry) bool {
+		return slices.Contains(v.VersionStages, "AWSCURRENT")
+	})
+	if current < 0 {
+		return time.Time{}, fmt.Errorf("secret %s has no current version", path)
+	}
+
+	data, err := a.getSecretData(path, *versions[current].VersionId)
+	if err != nil {
+		return time.Time{}, err
+	}
+	publicKey, _ := data["public_key"].(string)
+
+	created := *versions[current].CreatedDate
+	for _, older := range versions[current+1:] {
+		// Stop at versions that were removed and at the version before the key was replaced
+		olderData, err := a.getSecretData(path, *older.VersionId)
+		if errors.Is(err, ErrPathNotFound) || errors.Is(err, ErrInvalidKeyFormat) {
+			break
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if olderData["public_key"] != publicKey {
+			break
+		}
+		created = *older.CreatedDate
+	}
+	return created, nil
+}
+
+// Public keys are published in tags of the secret, which can be read with DescribeSecret without
+// access to the secret value. Tag values are limited in length and characters, so the
+// authorized_keys line is base64 encoded and split into chunks.
+const awsTagChunkSize = 256
+
+// publicKeyTags adds the tags holding publicKey to tags, with names starting with prefix, and
+// returns the names of the unused chunks, which must be removed
+func publicKeyTags(tags map[string]string, publicKey []byte, prefix string) ([]string, error) {
+	encoded := ""
+	if line := strings.TrimSpace(string(publicKey)); line != "" {
+		encoded = base64.StdEncoding.EncodeToString([]byte(line))
+	}
+	if len(encoded) > awsTagChunkSize*publicKeyMaxChunks {
+		return nil, fmt.Errorf("public key is too long to publish (%d bytes)", len(publicKey))
+	}
+
+	var unused []string
+	for i := range publicKeyMaxChunks {
+		name := fmt.Sprintf("%spublic_key_%d", prefix, i)
+		if start := i * awsTagChunkSize; start < len(encoded) {
+			tags[name] = encoded[start:min(start+awsTagChunkSize, len(encoded))]
+		} else {
+			unused = append(unused, name)
+		}
+	}
+	return unused, nil
+}
+
+// publicKeyFromTags joins and decodes the chunks of a public key published with prefix, or
+// returns nil if there are none
+func publicKeyFromTags(tags map[string]string, prefix string) ([]byte, error) {
+	var encoded strings.Builder
+	for i := range publicKeyMaxChunks {
+		chunk, ok := tags[fmt.Sprintf("%spublic_key_%d", prefix, i)]
+		if !ok {
+			break
+		}
+		encoded.WriteString(chunk)
+	}
+	if encoded.Len() == 0 {
+		return nil, nil
+	}
+
+	line, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, wrapError(err, "invalid published public key")
+	}
+	return append(line, '\n'), nil
+}
+
+// PublishPublicKey stores the public keys of the secret at path in its tags, so that principals
+// allowed to describe the secret but not to read its value can read them
+func (a *AWSClient) PublishPublicKey(path string, keys *PublicKeys) error {
+	tags := map[string]string{}
+	unused, err := publicKeyTags(tags, keys.PublicKey, "")
+	if err != nil {
+		return err
+	}
+	// Without a previous key all its chunks are removed, including those of an earlier rotation
+	unusedPrevious, err := publicKeyTags(tags, keys.Previous, previousPrefix)
+	if err != nil {
+		return err
+	}
+	unused = append(unused, unusedPrevious...)
+	if keys.Previous != nil {
+		tags[previousPrefix+"expires"] = keys.PreviousExpires.UTC().Format(time.RFC3339)
+	} else {
+		unused = append(unused, previousPrefix+"expires")
+	}
+
+	input := &secretsmanager.TagResourceInput{SecretId: aws.String(path)}
+	for _, name := range slices.Sorted(maps.Keys(tags)) {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(name), Value: aws.String(tags[name])})
+	}
+	if _, err := a.client.TagResource(context.Background(), input); err != nil {
+		return wrapError(err, "failed to tag secret")
+	}
+	_, err = a.client.UntagResource(context.Background(), &secretsmanager.UntagResourceInput{
+		SecretId: aws.String(path),
+		TagKeys:  unused,
+	})
+	if err != nil {
+		return wrapError(err, "failed to untag secret")
+	}
+	return nil
+}
+
+// GetPublicKey reads the public keys published by PublishPublicKey
+func (a *AWSClient) GetPublicKey(path string) (*PublicKeys, error) {
+	out, err := a.client.DescribeSecret(context.Background(), &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(path),
+	})
+	if isNotFound(err) {
+		return nil, ErrPathNotFound
+	}
+	if err != nil {
+		return nil, wrapError(err, "failed to describe secret")
+	}
+
+	tags := map[string]string{}
+	for _, tag := range out.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+
+	publicKey, err := publicKeyFromTags(tags, "")
+	if err != nil {
+		return nil, err
+	}
+	if publicKey == nil {
+		return nil, ErrPublicKeyNotPublished
+	}
+	keys := &PublicKeys{PublicKey: publicKey}
+
+	previous, err := publicKeyFromTags(tags, previousPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		keys.PreviousExpires, err = time.Parse(time.RFC3339, tags[previousPrefix+"expires"])
+		if err != nil {
+			return nil, wrapError(err, "failed to parse previous_expires")
+		}
+		keys.Previous = previous
+	}
+	return keys, nil
+}
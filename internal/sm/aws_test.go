@@ -0,0 +1,338 @@
+package sm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// fakeSecretVersion is a version of a secret in fakeSecretsManager
+type fakeSecretVersion struct {
+	id      string
+	value   string
+	created time.Time
+}
+
+// fakeSecret is a secret in fakeSecretsManager, its current version last
+type fakeSecret struct {
+	versions []fakeSecretVersion
+	tags     map[string]string
+}
+
+// fakeSecretsManager is an in-memory secretsManagerAPI
+type fakeSecretsManager struct {
+	secrets map[string]*fakeSecret
+	now     time.Time
+}
+
+func newFakeSecretsManager() *fakeSecretsManager {
+	return &fakeSecretsManager{
+		secrets: map[string]*fakeSecret{},
+		now:     time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (f *fakeSecretsManager) secret(id *string) (*fakeSecret, error) {
+	secret, ok := f.secrets[aws.ToString(id)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret not found")}
+	}
+	return secret, nil
+}
+
+// addVersion makes value the current version of the secret, an hour after the previous one
+func (f *fakeSecretsManager) addVersion(secret *fakeSecret, value string) {
+	f.now = f.now.Add(time.Hour)
+	secret.versions = append(secret.versions, fakeSecretVersion{
+		id:      fmt.Sprintf("v%d", len(secret.versions)+1),
+		value:   value,
+		created: f.now,
+	})
+}
+
+func (f *fakeSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	secret, err := f.secret(params.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	version := secret.versions[len(secret.versions)-1]
+	if params.VersionId != nil {
+		i := slices.IndexFunc(secret.versions, func(v fakeSecretVersion) bool { return v.id == *params.VersionId })
+		if i < 0 {
+			return nil, &types.ResourceNotFoundException{Message: aws.String("version not found")}
+		}
+		version = secret.versions[i]
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(version.value), VersionId: aws.String(version.id)}, nil
+}
+
+func (f *fakeSecretsManager) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	secret, err := f.secret(params.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	f.addVersion(secret, aws.ToString(params.SecretString))
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func (f *fakeSecretsManager) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	if _, ok := f.secrets[aws.ToString(params.Name)]; ok {
+		return nil, &types.ResourceExistsException{Message: aws.String("secret exists")}
+	}
+	secret := &fakeSecret{tags: map[string]string{}}
+	f.secrets[aws.ToString(params.Name)] = secret
+	f.addVersion(secret, aws.ToString(params.SecretString))
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func (f *fakeSecretsManager) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	secret, err := f.secret(params.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	out := &secretsmanager.DescribeSecretOutput{}
+	for key, value := range secret.tags {
+		out.Tags = append(out.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return out, nil
+}
+
+func (f *fakeSecretsManager) ListSecretVersionIds(ctx context.Context, params *secretsmanager.ListSecretVersionIdsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretVersionIdsOutput, error) {
+	secret, err := f.secret(params.SecretId)
+	if err != nil {
+		return nil, err
+	}
+
+	// One version per page, to exercise pagination
+	i := 0
+	if params.NextToken != nil {
+		fmt.Sscan(*params.NextToken, &i)
+	}
+	version := secret.versions[i]
+	entry := types.SecretVersionsListEntry{VersionId: aws.String(version.id), CreatedDate: aws.Time(version.created)}
+	if i == len(secret.versions)-1 {
+		entry.VersionStages = []string{"AWSCURRENT"}
+	}
+	out := &secretsmanager.ListSecretVersionIdsOutput{Versions: []types.SecretVersionsListEntry{entry}}
+	if i+1 < len(secret.versions) {
+		out.NextToken = aws.String(fmt.Sprint(i + 1))
+	}
+	return out, nil
+}
+
+func (f *fakeSecretsManager) TagResource(ctx context.Context, params *secretsmanager.TagResourceInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.TagResourceOutput, error) {
+	secret, err := f.secret(params.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range params.Tags {
+		if len(aws.ToString(tag.Value)) > 256 {
+			return nil, &types.InvalidParameterException{Message: aws.String("tag value too long")}
+		}
+		secret.tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return &secretsmanager.TagResourceOutput{}, nil
+}
+
+func (f *fakeSecretsManager) UntagResource(ctx context.Context, params *secretsmanager.UntagResourceInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UntagResourceOutput, error) {
+	secret, err := f.secret(params.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range params.TagKeys {
+		delete(secret.tags, key)
+	}
+	return &secretsmanager.UntagResourceOutput{}, nil
+}
+
+func TestAWSClient_stores_and_reads_keys(t *testing.T) {
+	client := &AWSClient{client: newFakeSecretsManager()}
+
+	if _, err := client.Get("prod/ssh/a"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Get() of a missing secret error = %v, want ErrPathNotFound", err)
+	}
+	if exists, err := client.CheckExists("prod/ssh/a"); err != nil || exists {
+		t.Errorf("CheckExists() = %v, %v, want false", exists, err)
+	}
+
+	expires := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	kv := &KeyValue{
+		PrivateKey: []byte("private"),
+		PublicKey:  []byte("ssh-ed25519 AAAA"),
+		Comment:    "a@example.com",
+		KeyType:    "ssh-ed25519",
+		Previous:   &KeyValue{PrivateKey: []byte("old private"), PublicKey: []byte("ssh-ed25519 BBBB")},
+
+		PreviousExpires: expires,
+	}
+	// The first store creates the secret and the second adds a version
+	for range 2 {
+		if err := client.Store("prod/ssh/a", kv); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	got, err := client.Get("prod/ssh/a")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if string(got.PrivateKey) != "private" || got.Comment != "a@example.com" || got.KeyType != "ssh-ed25519" {
+		t.Errorf("Get() = %+v", got)
+	}
+	if got.Previous == nil || string(got.Previous.PrivateKey) != "old private" || !got.PreviousExpires.Equal(expires) {
+		t.Errorf("Get() previous = %+v expiring %s", got.Previous, got.PreviousExpires)
+	}
+	if exists, err := client.CheckExists("prod/ssh/a"); err != nil || !exists {
+		t.Errorf("CheckExists() = %v, %v, want true", exists, err)
+	}
+}
+
+func TestAWSClient_passphrases(t *testing.T) {
+	fake := newFakeSecretsManager()
+	client := &AWSClient{client: fake}
+
+	if err := client.StorePassphrase("prod/ssh/a-passphrase", []byte("first")); err != nil {
+		t.Fatalf("StorePassphrase() error = %v", err)
+	}
+	fake.addVersion(fake.secrets["prod/ssh/a-passphrase"], `{"passphrase":"first","owner":"ops"}`)
+	if err := client.StorePassphrase("prod/ssh/a-passphrase", []byte("second")); err != nil {
+		t.Fatalf("StorePassphrase() error = %v", err)
+	}
+
+	passphrase, err := client.GetPassphrase("prod/ssh/a-passphrase")
+	if err != nil || string(passphrase) != "second" {
+		t.Errorf("GetPassphrase() = %q, %v, want second", passphrase, err)
+	}
+	if data, _ := client.getSecretData("prod/ssh/a-passphrase", ""); data["owner"] != "ops" {
+		t.Errorf("StorePassphrase() dropped other fields: %v", data)
+	}
+
+	fake.addVersion(fake.secrets["prod/ssh/a-passphrase"], "not json")
+	if _, err := client.GetPassphrase("prod/ssh/a-passphrase"); !errors.Is(err, ErrInvalidPassphraseFormat) {
+		t.Errorf("GetPassphrase() error = %v, want ErrInvalidPassphraseFormat", err)
+	}
+}
+
+func TestAWSClient_KeyCreated_skips_versions_with_the_same_key(t *testing.T) {
+	fake := newFakeSecretsManager()
+	client := &AWSClient{client: fake}
+
+	stored := func(publicKey string) time.Time {
+		t.Helper()
+		if err := client.Store("prod/ssh/a", &KeyValue{PrivateKey: []byte("private"), PublicKey: []byte(publicKey)}); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		return fake.now
+	}
+	stored("ssh-ed25519 OLD")
+	created := stored("ssh-ed25519 NEW")
+	stored("ssh-ed25519 NEW") // e.g. a passphrase change
+
+	got, err := client.KeyCreated("prod/ssh/a")
+	if err != nil {
+		t.Fatalf("KeyCreated() error = %v", err)
+	}
+	if !got.Equal(created) {
+		t.Errorf("KeyCreated() = %s, want %s when the key was first stored", got, created)
+	}
+	if _, err := client.KeyCreated("prod/ssh/missing"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("KeyCreated() of a missing secret error = %v, want ErrPathNotFound", err)
+	}
+}
+
+func TestAWSClient_PublishPublicKey_round_trips_through_tags(t *testing.T) {
+	fake := newFakeSecretsManager()
+	client := &AWSClient{client: fake}
+	if err := client.Store("prod/ssh/a", &KeyValue{PrivateKey: []byte("private"), PublicKey: []byte("ssh-rsa AAAA")}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if _, err := client.GetPublicKey("prod/ssh/a"); !errors.Is(err, ErrPublicKeyNotPublished) {
+		t.Errorf("GetPublicKey() before publishing error = %v, want ErrPublicKeyNotPublished", err)
+	}
+
+	// A long RSA key with a comment tag values can't hold as is
+	long := []byte("ssh-rsa " + strings.Repeat("A", 700) + " a <a@example.com>\n")
+	expires := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	keys := &PublicKeys{PublicKey: long, Previous: []byte("ssh-ed25519 OLD\n"), PreviousExpires: expires}
+	if err := client.PublishPublicKey("prod/ssh/a", keys); err != nil {
+		t.Fatalf("PublishPublicKey() error = %v", err)
+	}
+	got, err := client.GetPublicKey("prod/ssh/a")
+	if err != nil {
+		t.Fatalf("GetPublicKey() error = %v", err)
+	}
+	if !bytes.Equal(got.PublicKey, long) || string(got.Previous) != "ssh-ed25519 OLD\n" || !got.PreviousExpires.Equal(expires) {
+		t.Errorf("GetPublicKey() = %+v", got)
+	}
+
+	// Publishing a shorter key without a previous one removes the tags left by the longer one
+	if err := client.PublishPublicKey("prod/ssh/a", &PublicKeys{PublicKey: []byte("ssh-ed25519 NEW\n")}); err != nil {
+		t.Fatalf("PublishPublicKey() error = %v", err)
+	}
+	got, err = client.GetPublicKey("prod/ssh/a")
+	if err != nil {
+		t.Fatalf("GetPublicKey() error = %v", err)
+	}
+	if string(got.PublicKey) != "ssh-ed25519 NEW\n" || got.Previous != nil {
+		t.Errorf("GetPublicKey() = %+v, want only the new key", got)
+	}
+	if tags := fake.secrets["prod/ssh/a"].tags; len(tags) != 1 {
+		t.Errorf("tags = %v, want a single chunk", tags)
+	}
+
+	if _, err := client.GetPublicKey("prod/ssh/missing"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("GetPublicKey() of a missing secret error = %v, want ErrPathNotFound", err)
+	}
+}
+
+func TestNewAWSClient_requires_region(t *testing.T) {
+	isolateAWSConfig(t)
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	if _, err := NewAWSClient(&mockAWSConfig{}); err == nil || !strings.Contains(err.Error(), "region required") {
+		t.Errorf("NewAWSClient() error = %v, want region required", err)
+	}
+
+	// The region of a profile wins over the environment; credentials are still required
+	t.Setenv("AWS_REGION", "us-east-1")
+	_, err := NewAWSClient(&mockAWSConfig{AWSRegion: "eu-west-1", Profile: "work"})
+	if err == nil || !strings.HasPrefix(err.Error(), ErrAWSCredentials.Error()) {
+		t.Errorf("NewAWSClient() without credentials error = %v, want ErrAWSCredentials", err)
+	}
+}
+
+// mockAWSConfig implements AWSConfig
+type mockAWSConfig struct {
+	AWSRegion string
+	Profile   string
+}
+
+func (c *mockAWSConfig) GetAWSRegion() string { return c.AWSRegion }
+func (c *mockAWSConfig) GetProfile() string   { return c.Profile }
+
+// isolateAWSConfig keeps the AWS SDK from reading the credentials and config of whoever runs the
+// tests, or an instance role
+func isolateAWSConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", dir+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", dir+"/credentials")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
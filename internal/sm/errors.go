@@ -7,11 +7,18 @@ import (
 
 // Errors returned by the secret manager package
 var (
-	ErrPathNotFound     = errors.New("path not found in secret manager")
-	ErrInvalidKeyFormat = errors.New("invalid key format in secret manager")
-	ErrKeyExistsInAgent = errors.New("key already exists in ssh-agent")
-	ErrVaultConnection  = errors.New("failed to connect to vault")
-	ErrSSHAgentNotFound = errors.New("ssh-agent not found")
+	ErrPathNotFound            = errors.New("path not found in secret manager")
+	ErrInvalidKeyFormat        = errors.New("invalid key format in secret manager")
+	ErrInvalidPassphraseFormat = errors.New("invalid passphrase format in secret manager: expected a \"passphrase\" field")
+	ErrMissingMetadata         = errors.New("secret has no version metadata (is it a KV v2 secret?)")
+	ErrPublicKeyNotPublished   = errors.New("public key not published in secret metadata")
+	ErrKeyExistsInAgent        = errors.New("key already exists in ssh-agent")
+	ErrKeyNotInAgent           = errors.New("key not found in ssh-agent")
+	ErrVaultConnection         = errors.New("failed to connect to vault")
+	ErrVaultSealed             = errors.New("vault is sealed or not initialized")
+	ErrAWSCredentials          = errors.New("failed to get AWS credentials")
+	ErrSSHAgentNotFound        = errors.New("ssh-agent not found")
+	ErrNotSupported            = errors.New("not supported by the secret manager")
 )
 
 // wrapError wraps an error with additional context
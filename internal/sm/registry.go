@@ -0,0 +1,156 @@
+package sm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+// Registry is a Provider for the paths of several secret managers at once. Paths name their
+// provider with a URI scheme, e.g. vault://secret/ssh/a, and paths without one use the default
+// provider of the config. Each provider is created, and authenticates, the first time one of its
+// paths is used.
+type Registry struct {
+	cfg *config.Config
+
+	mu        sync.Mutex // Serializes provider creation, which may prompt for credentials
+	providers map[string]Provider
+	errs      map[string]error // Providers that failed to initialize, so they are not retried for every path
+}
+
+// NewRegistry creates a Registry for cfg without initializing any provider
+func NewRegistry(cfg *config.Config) *Registry {
+	return &Registry{
+		cfg:       cfg,
+		providers: map[string]Provider{},
+		errs:      map[string]error{},
+	}
+}
+
+// provider returns the provider of path and the path within it, initializing the provider on
+// first use
+func (r *Registry) provider(path string) (Provider, string, error) {
+	name, providerPath := config.ParsePath(path)
+	if name == "" {
+		name = r.cfg.DefaultProvider
+	}
+	if name == "" {
+		if len(r.cfg.Profiles) > 0 {
+			return nil, "", config.ErrNoProfile
+		}
+		return nil, "", fmt.Errorf("path %s has no provider scheme such as vault:// and default_provider is not set", path)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if provider, ok := r.providers[name]; ok {
+		return provider, providerPath, nil
+	}
+	if err, ok := r.errs[name]; ok {
+		return nil, "", err
+	}
+
+	cfg := *r.cfg
+	cfg.DefaultProvider = name
+	provider, err := InitProvider(&cfg)
+	if err != nil {
+		r.errs[name] = err
+		return nil, "", err
+	}
+	r.providers[name] = provider
+	return provider, providerPath, nil
+}
+
+// Get reads the key at path from its provider
+func (r *Registry) Get(path string) (*KeyValue, error) {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Get(providerPath)
+}
+
+// Store writes the key at path to its provider
+func (r *Registry) Store(path string, kv *KeyValue) error {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return err
+	}
+	return provider.Store(providerPath, kv)
+}
+
+// CheckExists reports whether a key exists at path in its provider
+func (r *Registry) CheckExists(path string) (bool, error) {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return false, err
+	}
+	return provider.CheckExists(providerPath)
+}
+
+// GetPassphrase implements PassphraseReader for providers that support it
+func (r *Registry) GetPassphrase(path string) ([]byte, error) {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, ok := provider.(PassphraseReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: reading passphrases", ErrNotSupported)
+	}
+	return reader.GetPassphrase(providerPath)
+}
+
+// StorePassphrase implements PassphraseWriter for providers that support it
+func (r *Registry) StorePassphrase(path string, passphrase []byte) error {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return err
+	}
+	writer, ok := provider.(PassphraseWriter)
+	if !ok {
+		return fmt.Errorf("%w: storing passphrases", ErrNotSupported)
+	}
+	return writer.StorePassphrase(providerPath, passphrase)
+}
+
+// KeyCreated implements KeyAgeReader for providers that support it
+func (r *Registry) KeyCreated(path string) (time.Time, error) {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	reader, ok := provider.(KeyAgeReader)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: recording when keys were created", ErrNotSupported)
+	}
+	return reader.KeyCreated(providerPath)
+}
+
+// PublishPublicKey implements PublicKeyPublisher for providers that support it
+func (r *Registry) PublishPublicKey(path string, keys *PublicKeys) error {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return err
+	}
+	publisher, ok := provider.(PublicKeyPublisher)
+	if !ok {
+		return fmt.Errorf("%w: publishing public keys", ErrNotSupported)
+	}
+	return publisher.PublishPublicKey(providerPath, keys)
+}
+
+// GetPublicKey implements PublicKeyReader for providers that support it
+func (r *Registry) GetPublicKey(path string) (*PublicKeys, error) {
+	provider, providerPath, err := r.provider(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, ok := provider.(PublicKeyReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: reading published public keys", ErrNotSupported)
+	}
+	return reader.GetPublicKey(providerPath)
+}
@@ -0,0 +1,111 @@
+package sm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/config"
+)
+
+func TestRegistry_routes_paths_by_scheme(t *testing.T) {
+	var logins int
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/token/lookup-self" {
+			logins++
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ttl": 0}})
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("BAO_ADDR", "")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("BAO_TOKEN", "")
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	registry := NewRegistry(&config.Config{DefaultProvider: config.ProviderVault})
+	if logins != 0 {
+		t.Fatalf("NewRegistry logged in %d times, want no login before a path is used", logins)
+	}
+	for _, path := range []string{"vault://secret/data/ssh/a", "secret/data/ssh/b"} {
+		if _, err := registry.CheckExists(path); err != nil {
+			t.Fatalf("CheckExists(%q) error = %v", path, err)
+		}
+	}
+	if logins != 1 {
+		t.Errorf("logged in %d times, want once for all Vault paths", logins)
+	}
+	if strings.Join(paths, ",") != "/v1/secret/data/ssh/a,/v1/secret/data/ssh/b" {
+		t.Errorf("requested %v, want the paths without scheme", paths)
+	}
+
+	// Paths of other providers fail on their own, without affecting Vault paths
+	if _, err := registry.Get("gcp://prod/ssh/b"); err == nil || !strings.Contains(err.Error(), "unsupported provider: gcp") {
+		t.Errorf("Get(gcp://...) error = %v, want unsupported provider", err)
+	}
+	if _, err := registry.CheckExists("vault://secret/data/ssh/a"); err != nil {
+		t.Errorf("CheckExists() after a failed provider error = %v", err)
+	}
+}
+
+func TestRegistry_creates_aws_provider_on_first_use(t *testing.T) {
+	var targets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targets = append(targets, r.Header.Get("X-Amz-Target"))
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "ResourceNotFoundException", "message": "not found"})
+	}))
+	t.Cleanup(server.Close)
+
+	isolateAWSConfig(t)
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+
+	registry := NewRegistry(&config.Config{DefaultProvider: config.ProviderVault, AWSRegion: "eu-west-1"})
+	exists, err := registry.CheckExists("aws://prod/ssh/a")
+	if err != nil || exists {
+		t.Fatalf("CheckExists(aws://...) = %v, %v, want false", exists, err)
+	}
+	if strings.Join(targets, ",") != "secretsmanager.GetSecretValue" {
+		t.Errorf("requested %v, want a single GetSecretValue", targets)
+	}
+}
+
+func TestRegistry_requires_provider(t *testing.T) {
+	registry := NewRegistry(&config.Config{Paths: []string{"vault://secret/data/ssh/a"}})
+	if _, err := registry.Get("secret/data/ssh/a"); err == nil || !strings.Contains(err.Error(), "no provider scheme") {
+		t.Errorf("Get() error = %v, want an error about the missing scheme", err)
+	}
+
+	registry = NewRegistry(&config.Config{Profiles: map[string]*config.Profile{"work": {Provider: config.ProviderVault}}})
+	if _, err := registry.Get("secret/data/ssh/a"); !errors.Is(err, config.ErrNoProfile) {
+		t.Errorf("Get() error = %v, want ErrNoProfile", err)
+	}
+}
+
+func TestRegistry_reports_unsupported_capabilities(t *testing.T) {
+	registry := NewRegistry(&config.Config{})
+	registry.providers["test"] = &mockProvider{}
+
+	if _, err := registry.GetPassphrase("test://a"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("GetPassphrase() error = %v, want ErrNotSupported", err)
+	}
+	if err := registry.StorePassphrase("test://a", nil); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("StorePassphrase() error = %v, want ErrNotSupported", err)
+	}
+	if _, err := registry.KeyCreated("test://a"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("KeyCreated() error = %v, want ErrNotSupported", err)
+	}
+	if err := registry.PublishPublicKey("test://a", nil); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("PublishPublicKey() error = %v, want ErrNotSupported", err)
+	}
+}
@@ -2,6 +2,7 @@ package sm
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 )
@@ -12,6 +13,18 @@ type KeyValue struct {
 	PublicKey         []byte
 	RequirePassphrase bool
 	Comment           string
+	KeyType           string // SSH key type, e.g. ssh-ed25519 (empty for keys stored before it was recorded)
+	PassphrasePath    string // Secret holding the passphrase of an encrypted key, for non-interactive use
+
+	// Previous is the key replaced by the last rotation, kept loadable until PreviousExpires
+	// so servers can be moved to the new public key
+	Previous        *KeyValue
+	PreviousExpires time.Time
+}
+
+// PreviousActive reports whether the previous key is still within its grace period at now
+func (kv *KeyValue) PreviousActive(now time.Time) bool {
+	return kv.Previous != nil && now.Before(kv.PreviousExpires)
 }
 
 // Provider defines the interface for secret manager providers
@@ -21,14 +34,83 @@ type Provider interface {
 	CheckExists(path string) (bool, error)
 }
 
+// PassphraseReader is implemented by providers that can read a key passphrase stored in a
+// separate secret, so encrypted keys can be decrypted without prompting
+type PassphraseReader interface {
+	GetPassphrase(path string) ([]byte, error)
+}
+
+// PassphraseWriter is implemented by providers that can store a key passphrase in a separate
+// secret, so it can be changed together with the key
+type PassphraseWriter interface {
+	StorePassphrase(path string, passphrase []byte) error
+}
+
+// PublicKeys holds the authorized_keys lines of the keys stored at a path, so they can be read
+// without access to the private keys
+type PublicKeys struct {
+	PublicKey []byte
+
+	// Previous is the public key of the key replaced by the last rotation, nil if there is none
+	Previous        []byte
+	PreviousExpires time.Time
+}
+
+// PreviousActive reports whether the previous key is still within its grace period at now
+func (p *PublicKeys) PreviousActive(now time.Time) bool {
+	return p.Previous != nil && now.Before(p.PreviousExpires)
+}
+
+// PublicKeyPublisher is implemented by providers that can store public keys where they can be
+// read without access to the private keys
+type PublicKeyPublisher interface {
+	PublishPublicKey(path string, keys *PublicKeys) error
+}
+
+// PublicKeyReader is implemented by providers that can read public keys stored by PublishPublicKey
+type PublicKeyReader interface {
+	GetPublicKey(path string) (*PublicKeys, error)
+}
+
+// KeyAgeReader is implemented by providers that record when secrets are written, so the age of
+// stored keys can be checked against a rotation policy
+type KeyAgeReader interface {
+	// KeyCreated returns when the key currently stored at path was first written
+	KeyCreated(path string) (time.Time, error)
+}
+
 // InitProvider creates and initializes a Provider based on the config
 // The provider client is created once here and reused for all operations
 func InitProvider(cfg *config.Config) (Provider, error) {
+	if cfg.DefaultProvider == "" && len(cfg.Profiles) > 0 {
+		return nil, config.ErrNoProfile
+	}
+
 	switch cfg.DefaultProvider {
 	case config.ProviderVault:
 		return NewVaultClient(cfg)
-	// Future: add case for AWS, Azure, etc.
+	case config.ProviderAWS:
+		return NewAWSClient(cfg)
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", cfg.DefaultProvider)
 	}
 }
+
+// InitProviders creates a Registry for every profile of the config, keyed by profile name. Like
+// any Registry, they authenticate when their paths are first used.
+func InitProviders(cfg *config.Config) (map[string]Provider, error) {
+	names := cfg.ProfileNames()
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no profiles configured")
+	}
+
+	providers := make(map[string]Provider, len(names))
+	for _, name := range names {
+		profile, err := cfg.WithProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = NewRegistry(profile)
+	}
+	return providers, nil
+}
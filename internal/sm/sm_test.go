@@ -1,7 +1,10 @@
 package sm
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
@@ -69,13 +72,73 @@ func TestKeyValue_Struct(t *testing.T) {
 }
 
 func TestInitProvider_UnsupportedProvider(t *testing.T) {
-	cfg := &config.Config{DefaultProvider: "aws"}
+	cfg := &config.Config{DefaultProvider: "gcp"}
 	_, err := InitProvider(cfg)
 	if err == nil {
 		t.Error("expected error for unsupported provider, got nil")
 	}
 }
 
+func TestInitProvider_requires_profile(t *testing.T) {
+	cfg := &config.Config{Profiles: map[string]*config.Profile{"work": {Provider: config.ProviderVault}}}
+	if _, err := InitProvider(cfg); !errors.Is(err, config.ErrNoProfile) {
+		t.Errorf("InitProvider() error = %v, want ErrNoProfile", err)
+	}
+}
+
+func TestInitProviders_creates_provider_per_profile(t *testing.T) {
+	// Fake servers accepting only the token of their profile
+	serve := func(token string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != token {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ttl": 0}})
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	personal, work := serve("personal-token"), serve("work-token")
+
+	t.Setenv("BAO_ADDR", "")
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("BAO_TOKEN", "")
+	t.Setenv("VAULT_TOKEN", "work-token")
+	t.Setenv("HOME_BAO_TOKEN", "personal-token")
+
+	cfg := &config.Config{Profiles: map[string]*config.Profile{
+		"personal": {Provider: config.ProviderVault, VaultAddress: personal, VaultTokenEnv: "HOME_BAO_TOKEN"},
+		"work":     {Provider: config.ProviderVault, VaultAddress: work},
+	}}
+	providers, err := InitProviders(cfg)
+	if err != nil {
+		t.Fatalf("InitProviders() error = %v", err)
+	}
+	for name, want := range map[string]string{"personal": personal, "work": work} {
+		provider, _, err := providers[name].(*Registry).provider("secret/data/ssh/a")
+		if err != nil {
+			t.Fatalf("provider of %s: %v", name, err)
+		}
+		if client, ok := provider.(*VaultClient); !ok || client.client.Address() != want {
+			t.Errorf("provider of %s = %v, want a Vault client for %s", name, provider, want)
+		}
+	}
+
+	// Logging in is left to the first use of a path
+	t.Setenv("HOME_BAO_TOKEN", "")
+	providers, err = InitProviders(cfg)
+	if err != nil {
+		t.Fatalf("InitProviders() error = %v", err)
+	}
+	if _, err := providers["personal"].CheckExists("secret/data/ssh/a"); err == nil {
+		t.Error("expected error for a profile without token, got nil")
+	}
+	if _, err := InitProviders(&config.Config{DefaultProvider: config.ProviderVault}); err == nil {
+		t.Error("expected error without profiles, got nil")
+	}
+}
+
 func TestProviderConstants(t *testing.T) {
 	if config.ProviderVault != "vault" {
 		t.Errorf("ProviderVault = %s, want 'vault'", config.ProviderVault)
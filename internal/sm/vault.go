@@ -3,18 +3,26 @@ package sm
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/codeignus/sm-ssh-add/internal/prompt"
 	"github.com/hashicorp/vault/api/auth/approle"
 
 	vaultapi "github.com/hashicorp/vault/api"
 )
 
-// VaultApproleConfig is the interface for Vault Approle authentication configuration.
+// VaultConfig is the interface for the Vault address and Approle authentication configuration.
 // Using an interface avoids circular imports with the config package.
-type VaultApproleConfig interface {
+type VaultConfig interface {
+	GetVaultAddress() string
+	GetVaultNamespace() string
 	GetVaultApproleRoleID() string
+	GetVaultTokenEnv() string
+	GetProfile() string
 }
 
 // VaultClient implements SecretManager interface for HashiCorp Vault KV v2
@@ -22,35 +30,68 @@ type VaultClient struct {
 	client *vaultapi.Client
 }
 
-// getVaultAddress returns the Vault/OpenBao address from environment variables.
-func getVaultAddress() string {
-	addr := os.Getenv("BAO_ADDR")
-	if addr == "" {
-		addr = os.Getenv("VAULT_ADDR")
+// configOrEnv returns configured if cfg is a profile that sets it, since the environment can only
+// name one server, and otherwise the first environment variable that is set, falling back to
+// configured
+func configOrEnv(cfg interface{ GetProfile() string }, configured string, envs ...string) string {
+	if cfg != nil && cfg.GetProfile() != "" && configured != "" {
+		return configured
+	}
+	for _, env := range envs {
+		if value := os.Getenv(env); value != "" {
+			return value
+		}
+	}
+	return configured
+}
+
+// VaultAddress returns the Vault/OpenBao address from environment variables, falling back to the
+// configured address. The address of a profile wins over the environment. cfg may be nil.
+func VaultAddress(cfg VaultConfig) string {
+	if cfg == nil {
+		return configOrEnv(nil, "", "BAO_ADDR", "VAULT_ADDR")
 	}
-	return addr
+	return configOrEnv(cfg, cfg.GetVaultAddress(), "BAO_ADDR", "VAULT_ADDR")
 }
 
-// getVaultToken returns the Vault/OpenBao token from environment variables.
-func getVaultToken() string {
+// vaultNamespace returns the Vault/OpenBao namespace like VaultAddress returns the address
+func vaultNamespace(cfg VaultConfig) string {
+	if cfg == nil {
+		return configOrEnv(nil, "", "BAO_NAMESPACE", "VAULT_NAMESPACE")
+	}
+	return configOrEnv(cfg, cfg.GetVaultNamespace(), "BAO_NAMESPACE", "VAULT_NAMESPACE")
+}
+
+// getVaultToken returns the Vault/OpenBao token from the environment variable configured in
+// vault_token_env, or else from BAO_TOKEN or VAULT_TOKEN. cfg may be nil.
+func getVaultToken(cfg VaultConfig) (string, error) {
+	if cfg != nil && cfg.GetVaultTokenEnv() != "" {
+		if token := os.Getenv(cfg.GetVaultTokenEnv()); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("vault token required: set %s", cfg.GetVaultTokenEnv())
+	}
+
 	token := os.Getenv("BAO_TOKEN")
 	if token == "" {
 		token = os.Getenv("VAULT_TOKEN")
 	}
-	return token
+	if token == "" {
+		return "", fmt.Errorf("vault token required: set BAO_TOKEN or VAULT_TOKEN")
+	}
+	return token, nil
 }
 
 // promptForSecretID prompts the user to enter their AppRole Secret ID.
 func promptForSecretID() (string, error) {
 	fmt.Fprintln(os.Stderr, "Generate a single-use Secret ID using command similar to below:")
 	fmt.Fprintln(os.Stderr, "vault write -f auth/approle/role/sm-ssh-add/secret-id")
-	fmt.Fprint(os.Stderr, "Enter Vault/OpenBao AppRole Secret ID: ")
 
-	var secretID string
-	_, err := fmt.Scanln(&secretID)
+	secret, err := prompt.Password("Enter Vault/OpenBao AppRole Secret ID: ")
 	if err != nil {
 		return "", wrapError(err, "failed to read secret ID")
 	}
+	secretID := string(secret)
 	if secretID == "" {
 		return "", fmt.Errorf("secret ID cannot be empty")
 	}
@@ -84,12 +125,10 @@ func appRoleLogin(client *vaultapi.Client, roleID string) error {
 	return nil
 }
 
-// NewVaultClient creates a new Vault client using environment variables.
-// If cfg is provided and contains VaultApproleRoleID, performs Approle login instead of using token.
-func NewVaultClient(cfg VaultApproleConfig) (*VaultClient, error) {
-	addr := getVaultAddress()
+// newAPIClient creates a Vault API client for addr
+func newAPIClient(addr string) (*vaultapi.Client, error) {
 	if addr == "" {
-		return nil, fmt.Errorf("vault address required: set BAO_ADDR or VAULT_ADDR")
+		return nil, fmt.Errorf("vault address required: set BAO_ADDR, VAULT_ADDR or vault_address in the config")
 	}
 
 	config := vaultapi.DefaultConfig()
@@ -100,6 +139,15 @@ func NewVaultClient(cfg VaultApproleConfig) (*VaultClient, error) {
 	if err != nil {
 		return nil, wrapError(err, "failed to create vault client")
 	}
+	return client, nil
+}
+
+// authenticate performs Approle login if cfg contains VaultApproleRoleID, otherwise sets the token
+// from environment variables. Both happen in the configured namespace.
+func authenticate(client *vaultapi.Client, cfg VaultConfig) error {
+	if namespace := vaultNamespace(cfg); namespace != "" {
+		client.SetNamespace(namespace)
+	}
 
 	// Check if config has VaultApproleRoleID field set
 	var roleID string
@@ -109,15 +157,25 @@ func NewVaultClient(cfg VaultApproleConfig) (*VaultClient, error) {
 
 	// Authenticate: AppRole if configured, otherwise token
 	if roleID != "" {
-		if err := appRoleLogin(client, roleID); err != nil {
-			return nil, err
-		}
-	} else {
-		token := getVaultToken()
-		if token == "" {
-			return nil, fmt.Errorf("vault token required: set BAO_TOKEN or VAULT_TOKEN")
-		}
-		client.SetToken(token)
+		return appRoleLogin(client, roleID)
+	}
+	token, err := getVaultToken(cfg)
+	if err != nil {
+		return err
+	}
+	client.SetToken(token)
+	return nil
+}
+
+// NewVaultClient creates a new Vault client using environment variables and the configured address.
+// If cfg is provided and contains VaultApproleRoleID, performs Approle login instead of using token.
+func NewVaultClient(cfg VaultConfig) (*VaultClient, error) {
+	client, err := newAPIClient(VaultAddress(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if err := authenticate(client, cfg); err != nil {
+		return nil, err
 	}
 
 	// Verify connection
@@ -129,6 +187,9 @@ func NewVaultClient(cfg VaultApproleConfig) (*VaultClient, error) {
 	return &VaultClient{client: client}, nil
 }
 
+// previousPrefix prefixes the fields of the key replaced by the last rotation
+const previousPrefix = "previous_"
+
 // Get retrieves key-value data from Vault KV v2 at the given path
 func (v *VaultClient) Get(path string) (*KeyValue, error) {
 	secret, err := v.client.Logical().Read(path)
@@ -146,18 +207,47 @@ func (v *VaultClient) Get(path string) (*KeyValue, error) {
 		return nil, ErrInvalidKeyFormat
 	}
 
-	privateKey, ok := data["private_key"].(string)
+	return keyValueWithPrevious(data)
+}
+
+// keyValueWithPrevious reads a key and the previous key of its last rotation from secret data
+func keyValueWithPrevious(data map[string]interface{}) (*KeyValue, error) {
+	kv, err := keyValueFromData(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// The previous key of a rotation is kept until its grace period expires
+	if _, ok := data[previousPrefix+"private_key"]; ok {
+		previous, err := keyValueFromData(data, previousPrefix)
+		if err != nil {
+			return nil, wrapError(err, "invalid previous key")
+		}
+		expires, _ := data[previousPrefix+"expires"].(string)
+		kv.PreviousExpires, err = time.Parse(time.RFC3339, expires)
+		if err != nil {
+			return nil, wrapError(err, "failed to parse previous_expires")
+		}
+		kv.Previous = previous
+	}
+
+	return kv, nil
+}
+
+// keyValueFromData reads the key fields starting with prefix from secret data
+func keyValueFromData(data map[string]interface{}, prefix string) (*KeyValue, error) {
+	privateKey, ok := data[prefix+"private_key"].(string)
 	if !ok || privateKey == "" {
 		return nil, ErrInvalidKeyFormat
 	}
 
-	publicKey, ok := data["public_key"].(string)
+	publicKey, ok := data[prefix+"public_key"].(string)
 	if !ok || publicKey == "" {
 		return nil, ErrInvalidKeyFormat
 	}
 
 	requirePassphrase := false
-	requirePassphraseStr, ok := data["require_passphrase"].(string)
+	requirePassphraseStr, ok := data[prefix+"require_passphrase"].(string)
 	if ok {
 		var err error
 		requirePassphrase, err = strconv.ParseBool(requirePassphraseStr)
@@ -167,29 +257,55 @@ func (v *VaultClient) Get(path string) (*KeyValue, error) {
 	}
 
 	comment := ""
-	if c, ok := data["comment"].(string); ok {
+	if c, ok := data[prefix+"comment"].(string); ok {
 		comment = c
 	}
 
+	keyType := ""
+	if t, ok := data[prefix+"key_type"].(string); ok {
+		keyType = t
+	}
+
+	passphrasePath := ""
+	if p, ok := data[prefix+"passphrase_path"].(string); ok {
+		passphrasePath = p
+	}
+
 	return &KeyValue{
 		PrivateKey:        []byte(privateKey),
 		PublicKey:         []byte(publicKey),
 		RequirePassphrase: requirePassphrase,
 		Comment:           comment,
+		KeyType:           keyType,
+		PassphrasePath:    passphrasePath,
 	}, nil
 }
 
-// Store stores key-value data in Vault KV v2 at the given path
-func (v *VaultClient) Store(path string, kv *KeyValue) error {
-	secretData := map[string]interface{}{
-		"private_key":        string(kv.PrivateKey),
-		"public_key":         string(kv.PublicKey),
-		"require_passphrase": fmt.Sprintf("%v", kv.RequirePassphrase),
-		"comment":            kv.Comment,
+// addKeyValueData adds the key fields of kv to secret data, with names starting with prefix
+func addKeyValueData(data map[string]interface{}, kv *KeyValue, prefix string) {
+	data[prefix+"private_key"] = string(kv.PrivateKey)
+	data[prefix+"public_key"] = string(kv.PublicKey)
+	data[prefix+"require_passphrase"] = fmt.Sprintf("%v", kv.RequirePassphrase)
+	data[prefix+"comment"] = kv.Comment
+	data[prefix+"key_type"] = kv.KeyType
+	data[prefix+"passphrase_path"] = kv.PassphrasePath
+}
+
+// keyValueSecretData returns the secret data holding kv and its previous key
+func keyValueSecretData(kv *KeyValue) map[string]interface{} {
+	secretData := map[string]interface{}{}
+	addKeyValueData(secretData, kv, "")
+	if kv.Previous != nil {
+		addKeyValueData(secretData, kv.Previous, previousPrefix)
+		secretData[previousPrefix+"expires"] = kv.PreviousExpires.UTC().Format(time.RFC3339)
 	}
+	return secretData
+}
 
+// Store stores key-value data in Vault KV v2 at the given path
+func (v *VaultClient) Store(path string, kv *KeyValue) error {
 	data := map[string]interface{}{
-		"data": secretData,
+		"data": keyValueSecretData(kv),
 	}
 
 	_, err := v.client.Logical().Write(path, data)
@@ -200,6 +316,231 @@ func (v *VaultClient) Store(path string, kv *KeyValue) error {
 	return nil
 }
 
+// GetPassphrase reads a key passphrase from the "passphrase" field of the secret at path
+func (v *VaultClient) GetPassphrase(path string) ([]byte, error) {
+	secret, err := v.client.Logical().Read(path)
+	if err != nil {
+		return nil, wrapError(err, "failed to read from vault")
+	}
+
+	if secret == nil {
+		return nil, ErrPathNotFound
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidPassphraseFormat
+	}
+
+	passphrase, ok := data["passphrase"].(string)
+	if !ok || passphrase == "" {
+		return nil, ErrInvalidPassphraseFormat
+	}
+
+	return []byte(passphrase), nil
+}
+
+// StorePassphrase writes a key passphrase to the "passphrase" field of the secret at path,
+// keeping its other fields
+func (v *VaultClient) StorePassphrase(path string, passphrase []byte) error {
+	data := map[string]interface{}{}
+	secret, err := v.client.Logical().Read(path)
+	if err != nil {
+		return wrapError(err, "failed to read from vault")
+	}
+	if secret != nil {
+		if existing, ok := secret.Data["data"].(map[string]interface{}); ok {
+			maps.Copy(data, existing)
+		}
+	}
+	data["passphrase"] = string(passphrase)
+
+	if _, err := v.client.Logical().Write(path, map[string]interface{}{"data": data}); err != nil {
+		return wrapError(err, "failed to write to vault")
+	}
+	return nil
+}
+
+// KeyCreated returns when the key currently stored at path was first written, from the KV v2
+// version metadata. Earlier versions holding the same public key, such as those replaced by a
+// passphrase change, count towards the age of the key.
+func (v *VaultClient) KeyCreated(path string) (time.Time, error) {
+	secret, err := v.client.Logical().Read(path)
+	if err != nil {
+		return time.Time{}, wrapError(err, "failed to read from vault")
+	}
+	if secret == nil {
+		return time.Time{}, ErrPathNotFound
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return time.Time{}, ErrInvalidKeyFormat
+	}
+	publicKey, _ := data["public_key"].(string)
+
+	version, created, err := versionMetadata(secret)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for ; version > 1; version-- {
+		older, err := v.client.Logical().ReadWithData(path, map[string][]string{
+			"version": {strconv.Itoa(version - 1)},
+		})
+		if err != nil {
+			return time.Time{}, wrapError(err, "failed to read from vault")
+		}
+		// Stop at deleted or destroyed versions and at the version before the key was replaced
+		if older == nil {
+			break
+		}
+		olderData, ok := older.Data["data"].(map[string]interface{})
+		if !ok || olderData["public_key"] != publicKey {
+			break
+		}
+		if _, created, err = versionMetadata(older); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return created, nil
+}
+
+// versionMetadata returns the version and creation time from the metadata of a KV v2 read
+func versionMetadata(secret *vaultapi.Secret) (int, time.Time, error) {
+	metadata, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return 0, time.Time{}, ErrMissingMetadata
+	}
+
+	createdTime, _ := metadata["created_time"].(string)
+	created, err := time.Parse(time.RFC3339Nano, createdTime)
+	if err != nil {
+		return 0, time.Time{}, wrapError(err, "failed to parse created_time")
+	}
+
+	version, err := strconv.Atoi(fmt.Sprint(metadata["version"]))
+	if err != nil {
+		return 0, time.Time{}, wrapError(err, "failed to parse version")
+	}
+
+	return version, created, nil
+}
+
+// Public keys are published in the custom metadata of the secret, split into chunks because
+// KV v2 limits the size of custom metadata values
+const (
+	publicKeyChunkSize = 512
+	publicKeyMaxChunks = 8 // enough for 16384-bit RSA keys
+)
+
+// metadataPath returns the KV v2 metadata path of a data path such as secret/data/ssh/github
+func metadataPath(path string) (string, error) {
+	mount, rest, ok := strings.Cut(path, "/data/")
+	if !ok {
+		return "", fmt.Errorf("cannot find the metadata of %s: KV v2 paths must contain /data/", path)
+	}
+	return mount + "/metadata/" + rest, nil
+}
+
+// addPublicKeyChunks adds the chunks of an authorized_keys line to custom metadata, with names
+// starting with prefix. Unused chunks are set to null, which deletes those left by a longer key.
+func addPublicKeyChunks(customMetadata map[string]interface{}, publicKey []byte, prefix string) error {
+	line := strings.TrimSpace(string(publicKey))
+	if len(line) > publicKeyChunkSize*publicKeyMaxChunks {
+		return fmt.Errorf("public key is too long to publish (%d bytes)", len(line))
+	}
+	for i := range publicKeyMaxChunks {
+		var chunk interface{}
+		if start := i * publicKeyChunkSize; start < len(line) {
+			chunk = line[start:min(start+publicKeyChunkSize, len(line))]
+		}
+		customMetadata[fmt.Sprintf("%spublic_key_%d", prefix, i)] = chunk
+	}
+	return nil
+}
+
+// publicKeyFromChunks joins the chunks of a public key published with prefix, or returns nil if
+// there are none
+func publicKeyFromChunks(customMetadata map[string]interface{}, prefix string) []byte {
+	var line strings.Builder
+	for i := range publicKeyMaxChunks {
+		chunk, ok := customMetadata[fmt.Sprintf("%spublic_key_%d", prefix, i)].(string)
+		if !ok {
+			break
+		}
+		line.WriteString(chunk)
+	}
+	if line.Len() == 0 {
+		return nil
+	}
+	return []byte(line.String() + "\n")
+}
+
+// PublishPublicKey stores the public keys of the secret at path in its custom metadata, so that
+// tokens allowed to read the metadata but not the secret can read them
+func (v *VaultClient) PublishPublicKey(path string, keys *PublicKeys) error {
+	mpath, err := metadataPath(path)
+	if err != nil {
+		return err
+	}
+
+	customMetadata := map[string]interface{}{}
+	if err := addPublicKeyChunks(customMetadata, keys.PublicKey, ""); err != nil {
+		return err
+	}
+	// Without a previous key its chunks are all null, removing those of an earlier rotation
+	if err := addPublicKeyChunks(customMetadata, keys.Previous, previousPrefix); err != nil {
+		return err
+	}
+	customMetadata[previousPrefix+"expires"] = nil
+	if keys.Previous != nil {
+		customMetadata[previousPrefix+"expires"] = keys.PreviousExpires.UTC().Format(time.RFC3339)
+	}
+
+	_, err = v.client.Logical().JSONMergePatch(context.Background(), mpath, map[string]interface{}{
+		"custom_metadata": customMetadata,
+	})
+	if err != nil {
+		return wrapError(err, "failed to write secret metadata")
+	}
+	return nil
+}
+
+// GetPublicKey reads the public keys published by PublishPublicKey
+func (v *VaultClient) GetPublicKey(path string) (*PublicKeys, error) {
+	mpath, err := metadataPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := v.client.Logical().Read(mpath)
+	if err != nil {
+		return nil, wrapError(err, "failed to read secret metadata")
+	}
+	if secret == nil {
+		return nil, ErrPathNotFound
+	}
+
+	customMetadata, _ := secret.Data["custom_metadata"].(map[string]interface{})
+	keys := &PublicKeys{PublicKey: publicKeyFromChunks(customMetadata, "")}
+	if keys.PublicKey == nil {
+		return nil, ErrPublicKeyNotPublished
+	}
+
+	if previous := publicKeyFromChunks(customMetadata, previousPrefix); previous != nil {
+		expires, _ := customMetadata[previousPrefix+"expires"].(string)
+		keys.PreviousExpires, err = time.Parse(time.RFC3339, expires)
+		if err != nil {
+			return nil, wrapError(err, "failed to parse previous_expires")
+		}
+		keys.Previous = previous
+	}
+
+	return keys, nil
+}
+
 // CheckExists checks if a key already exists at the given path
 func (v *VaultClient) CheckExists(path string) (bool, error) {
 	secret, err := v.client.Logical().Read(path)
@@ -0,0 +1,118 @@
+package sm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// VaultDiagnostics checks a Vault connection one step at a time, so the doctor command can tell
+// which step fails. Unlike NewVaultClient, it does not stop at the first problem.
+type VaultDiagnostics struct {
+	client *vaultapi.Client
+}
+
+// VaultMount describes the secrets engine mounted at a path
+type VaultMount struct {
+	Path    string // Mount path with a trailing slash, e.g. "secret/"
+	Type    string // Secrets engine type, "kv" for key/value mounts
+	Version int    // KV version, 1 or 2, or 0 for other engines
+}
+
+// NewVaultDiagnostics creates an unauthenticated client for addr
+func NewVaultDiagnostics(addr string) (*VaultDiagnostics, error) {
+	client, err := newAPIClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &VaultDiagnostics{client: client}, nil
+}
+
+// Address returns the Vault address in use
+func (d *VaultDiagnostics) Address() string {
+	return d.client.Address()
+}
+
+// Health checks that Vault is reachable, initialized and unsealed, and returns its version
+func (d *VaultDiagnostics) Health() (string, error) {
+	health, err := d.client.Sys().Health()
+	if err != nil {
+		return "", wrapError(err, ErrVaultConnection.Error())
+	}
+	if !health.Initialized || health.Sealed {
+		return health.Version, ErrVaultSealed
+	}
+	return health.Version, nil
+}
+
+// Login authenticates like NewVaultClient and returns the remaining lifetime of the token,
+// 0 if it does not expire
+func (d *VaultDiagnostics) Login(cfg VaultConfig) (time.Duration, error) {
+	if err := authenticate(d.client, cfg); err != nil {
+		return 0, err
+	}
+	return d.tokenTTL()
+}
+
+// LoginToken checks token instead of the one from environment variables, see Login
+func (d *VaultDiagnostics) LoginToken(token string) (time.Duration, error) {
+	d.client.SetToken(token)
+	return d.tokenTTL()
+}
+
+// tokenTTL looks up the token of the client and returns its remaining lifetime
+func (d *VaultDiagnostics) tokenTTL() (time.Duration, error) {
+	secret, err := d.client.Auth().Token().LookupSelf()
+	if err != nil {
+		return 0, wrapError(err, "token lookup failed")
+	}
+	return secret.TokenTTL()
+}
+
+// Mount returns the secrets engine mounted at path
+func (d *VaultDiagnostics) Mount(path string) (*VaultMount, error) {
+	secret, err := d.client.Logical().Read("sys/internal/ui/mounts/" + path)
+	if err != nil {
+		return nil, wrapError(err, "failed to look up mount")
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no secrets engine mounted at %s", path)
+	}
+
+	mount := &VaultMount{}
+	mount.Path, _ = secret.Data["path"].(string)
+	mount.Type, _ = secret.Data["type"].(string)
+	if mount.Type == "kv" || mount.Type == "generic" {
+		// KV v1 mounts have no version option or version "1"
+		mount.Version = 1
+		if options, ok := secret.Data["options"].(map[string]interface{}); ok && options["version"] == "2" {
+			mount.Version = 2
+		}
+	}
+	return mount, nil
+}
+
+// CanRead reports whether the token may read path
+func (d *VaultDiagnostics) CanRead(path string) (bool, error) {
+	capabilities, err := d.client.Sys().CapabilitiesSelf(path)
+	if err != nil {
+		return false, wrapError(err, "failed to check capabilities")
+	}
+	return slices.Contains(capabilities, "root") || slices.Contains(capabilities, "read"), nil
+}
+
+// KVv2DataPath returns the path to use for a KV v2 secret given a path that may lack the "data/"
+// segment after the mount, and whether the given path already had it
+func KVv2DataPath(mount, path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, mount)
+	if !ok {
+		return path, false
+	}
+	if strings.HasPrefix(rest, "data/") {
+		return path, true
+	}
+	return mount + "data/" + rest, false
+}
@@ -5,6 +5,7 @@ package sm
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 )
@@ -451,3 +452,181 @@ func TestCheckExists_handles_deleted_path(t *testing.T) {
 		t.Error("Expected CheckExists to return false for deleted key")
 	}
 }
+
+func TestGetPassphrase_reads_passphrase_field(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+	client, err := NewVaultClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Vault client: %v", err)
+	}
+
+	// Setup: Store a passphrase and a key referring to it
+	passphrasePath := "secret/data/ssh/test-passphrase"
+	_, err = client.client.Logical().Write(passphrasePath, map[string]interface{}{
+		"data": map[string]interface{}{"passphrase": "stored-passphrase"},
+	})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	keyPath := "secret/data/ssh/test-passphrase-key"
+	err = client.Store(keyPath, &KeyValue{
+		PrivateKey:        []byte("test-private"),
+		PublicKey:         []byte("test-public"),
+		RequirePassphrase: true,
+		PassphrasePath:    passphrasePath,
+	})
+	if err != nil {
+		t.Fatalf("Setup failed: Store error: %v", err)
+	}
+
+	// Test: The key carries the passphrase path, which holds the passphrase
+	kv, err := client.Get(keyPath)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if kv.PassphrasePath != passphrasePath {
+		t.Errorf("PassphrasePath mismatch: got %q, want %q", kv.PassphrasePath, passphrasePath)
+	}
+	passphrase, err := client.GetPassphrase(kv.PassphrasePath)
+	if err != nil {
+		t.Fatalf("GetPassphrase failed: %v", err)
+	}
+	if string(passphrase) != "stored-passphrase" {
+		t.Errorf("passphrase mismatch: got %q, want %q", passphrase, "stored-passphrase")
+	}
+
+	// Verify: A key secret is not a passphrase secret
+	if _, err := client.GetPassphrase(keyPath); err != ErrInvalidPassphraseFormat {
+		t.Errorf("Expected ErrInvalidPassphraseFormat, got: %v", err)
+	}
+
+	// Cleanup
+	client.client.Logical().Delete(passphrasePath)
+	client.client.Logical().Delete(keyPath)
+}
+
+func TestGet_retrieves_previous_key_after_rotation(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+	client, err := NewVaultClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Vault client: %v", err)
+	}
+
+	// Setup: Store a rotated key with its previous key
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	testPath := "secret/data/ssh/test-rotated"
+	err = client.Store(testPath, &KeyValue{
+		PrivateKey: []byte("test-private-new"),
+		PublicKey:  []byte("test-public-new"),
+		Previous: &KeyValue{
+			PrivateKey:        []byte("test-private-old"),
+			PublicKey:         []byte("test-public-old"),
+			RequirePassphrase: true,
+			Comment:           "old",
+		},
+		PreviousExpires: expires,
+	})
+	if err != nil {
+		t.Fatalf("Setup failed: Store error: %v", err)
+	}
+
+	// Test: Both keys are read back
+	kv, err := client.Get(testPath)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if string(kv.PublicKey) != "test-public-new" {
+		t.Errorf("PublicKey mismatch: got %q, want %q", kv.PublicKey, "test-public-new")
+	}
+	if kv.Previous == nil {
+		t.Fatal("Previous key missing")
+	}
+	if string(kv.Previous.PrivateKey) != "test-private-old" || !kv.Previous.RequirePassphrase || kv.Previous.Comment != "old" {
+		t.Errorf("Previous key mismatch: got %+v", kv.Previous)
+	}
+	if !kv.PreviousExpires.Equal(expires) {
+		t.Errorf("PreviousExpires mismatch: got %v, want %v", kv.PreviousExpires, expires)
+	}
+
+	// Verify: Storing without a previous key drops it
+	if err := client.Store(testPath, &KeyValue{PrivateKey: []byte("a"), PublicKey: []byte("b")}); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if kv, err := client.Get(testPath); err != nil || kv.Previous != nil {
+		t.Errorf("Expected no previous key, got %+v, %v", kv, err)
+	}
+
+	// Cleanup
+	client.client.Logical().Delete(testPath)
+}
+
+func TestKeyCreated_reports_when_the_key_was_first_written(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+	client, err := NewVaultClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Vault client: %v", err)
+	}
+
+	testPath := "secret/data/ssh/test-key-created"
+	defer client.client.Logical().Delete("secret/metadata/ssh/test-key-created")
+
+	// Setup: Write a key, then a new version with only the passphrase flag changed
+	before := time.Now().Add(-time.Minute)
+	if err := client.Store(testPath, &KeyValue{PrivateKey: []byte("private-1"), PublicKey: []byte("public-1")}); err != nil {
+		t.Fatalf("Setup failed: Store error: %v", err)
+	}
+	first, err := client.KeyCreated(testPath)
+	if err != nil {
+		t.Fatalf("KeyCreated failed: %v", err)
+	}
+	if first.Before(before) {
+		t.Errorf("KeyCreated = %v, want a recent time", first)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if err := client.Store(testPath, &KeyValue{PrivateKey: []byte("private-2"), PublicKey: []byte("public-1"), RequirePassphrase: true}); err != nil {
+		t.Fatalf("Setup failed: Store error: %v", err)
+	}
+
+	// Verify: The age of the same key is kept
+	if created, err := client.KeyCreated(testPath); err != nil || !created.Equal(first) {
+		t.Errorf("KeyCreated after passphrase change = %v, %v, want %v", created, err, first)
+	}
+
+	// Verify: A new key starts a new age
+	if err := client.Store(testPath, &KeyValue{PrivateKey: []byte("private-3"), PublicKey: []byte("public-3")}); err != nil {
+		t.Fatalf("Setup failed: Store error: %v", err)
+	}
+	if created, err := client.KeyCreated(testPath); err != nil || !created.After(first) {
+		t.Errorf("KeyCreated after new key = %v, %v, want after %v", created, err, first)
+	}
+}
+
+func TestGetPublicKey_reads_published_public_key(t *testing.T) {
+	cfg := &config.Config{DefaultProvider: config.ProviderVault}
+	client, err := NewVaultClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Vault client: %v", err)
+	}
+
+	testPath := "secret/data/ssh/test-published"
+	defer client.client.Logical().Delete("secret/metadata/ssh/test-published")
+
+	// Setup: Store a key and publish its public key
+	err = client.Store(testPath, &KeyValue{PrivateKey: []byte("test-private"), PublicKey: []byte("test-public")})
+	if err != nil {
+		t.Fatalf("Setup failed: Store error: %v", err)
+	}
+	if err := client.PublishPublicKey(testPath, &PublicKeys{PublicKey: []byte("ssh-ed25519 AAAA test@example.com\n")}); err != nil {
+		t.Fatalf("PublishPublicKey failed: %v", err)
+	}
+
+	// Test: The public key is read from the metadata
+	keys, err := client.GetPublicKey(testPath)
+	if err != nil {
+		t.Fatalf("GetPublicKey failed: %v", err)
+	}
+	if string(keys.PublicKey) != "ssh-ed25519 AAAA test@example.com\n" || keys.Previous != nil {
+		t.Errorf("public keys mismatch: got %q, previous %q", keys.PublicKey, keys.Previous)
+	}
+}
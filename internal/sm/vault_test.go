@@ -1,20 +1,52 @@
 package sm
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
 )
 
-// mockConfig is a test helper that implements the VaultApproleConfig interface
+// mockConfig is a test helper that implements the VaultConfig interface
 type mockConfig struct {
+	VaultAddress       string
+	VaultNamespace     string
 	VaultApproleRoleID string
+	VaultTokenEnv      string
+	Profile            string
+}
+
+// GetVaultAddress makes mockConfig implement the VaultConfig interface
+func (c *mockConfig) GetVaultAddress() string {
+	return c.VaultAddress
 }
 
-// GetVaultApproleRoleID makes mockConfig implement the VaultApproleConfig interface
+// GetVaultNamespace makes mockConfig implement the VaultConfig interface
+func (c *mockConfig) GetVaultNamespace() string {
+	return c.VaultNamespace
+}
+
+// GetVaultApproleRoleID makes mockConfig implement the VaultConfig interface
 func (c *mockConfig) GetVaultApproleRoleID() string {
 	return c.VaultApproleRoleID
 }
 
+// GetVaultTokenEnv makes mockConfig implement the VaultConfig interface
+func (c *mockConfig) GetVaultTokenEnv() string {
+	return c.VaultTokenEnv
+}
+
+// GetProfile makes mockConfig implement the VaultConfig interface
+func (c *mockConfig) GetProfile() string {
+	return c.Profile
+}
+
 func TestNewVaultClient_reads_environment_variables(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -170,3 +202,281 @@ func TestNewVaultClient_withAppRoleConfig_performsLogin(t *testing.T) {
 		}
 	}
 }
+
+// newFakeKVClient returns a VaultClient for a fake KV v2 server holding versions of a single
+// secret, where versions[i] is the public key of version i+1 (empty for a deleted version)
+func newFakeKVClient(t *testing.T, versions []string, created []time.Time) *VaultClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := len(versions)
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, _ = strconv.Atoi(v)
+		}
+		metadata := map[string]interface{}{
+			"version":      version,
+			"created_time": created[version-1].Format(time.RFC3339Nano),
+		}
+		if versions[version-1] == "" {
+			// Deleted versions are reported as not found with their metadata
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": nil, "metadata": metadata},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     map[string]interface{}{"private_key": "private", "public_key": versions[version-1]},
+				"metadata": metadata,
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	client, err := vaultapi.NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client.SetToken("test-token")
+	return &VaultClient{client: client}
+}
+
+func TestKeyCreated_skips_versions_with_the_same_key(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := []time.Time{base, base.AddDate(0, 1, 0), base.AddDate(0, 2, 0), base.AddDate(0, 3, 0)}
+
+	tests := []struct {
+		name     string
+		versions []string
+		want     time.Time
+	}{
+		{name: "single version", versions: []string{"key-a"}, want: created[0]},
+		{name: "passphrase changes keep the age", versions: []string{"key-a", "key-b", "key-b", "key-b"}, want: created[1]},
+		{name: "rotated key", versions: []string{"key-a", "key-a", "key-a", "key-b"}, want: created[3]},
+		{name: "deleted older version", versions: []string{"key-a", "", "key-a", "key-a"}, want: created[2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeKVClient(t, tt.versions, created)
+			got, err := client.KeyCreated("secret/data/ssh/test")
+			if err != nil {
+				t.Fatalf("KeyCreated failed: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("KeyCreated = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishPublicKey_round_trips_through_custom_metadata(t *testing.T) {
+	// Fake metadata endpoint applying JSON merge patches to custom_metadata
+	customMetadata := map[string]interface{}{"owner": "ops"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/metadata/ssh/test" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPatch:
+			var patch map[string]map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&patch)
+			for k, v := range patch["custom_metadata"] {
+				if v == nil {
+					delete(customMetadata, k)
+				} else {
+					customMetadata[k] = v
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"custom_metadata": customMetadata},
+			})
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	vault, err := vaultapi.NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client := &VaultClient{client: vault}
+
+	if _, err := client.GetPublicKey("secret/data/ssh/test"); err != ErrPublicKeyNotPublished {
+		t.Errorf("Expected ErrPublicKeyNotPublished before publishing, got: %v", err)
+	}
+
+	// A long key is split into chunks and read back whole, with the previous key of a rotation
+	long := "ssh-rsa " + strings.Repeat("A", 1500) + " user@example.com\n"
+	previous := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPrevious user@example.com\n"
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = client.PublishPublicKey("secret/data/ssh/test", &PublicKeys{
+		PublicKey:       []byte(long),
+		Previous:        []byte(previous),
+		PreviousExpires: expires,
+	})
+	if err != nil {
+		t.Fatalf("PublishPublicKey failed: %v", err)
+	}
+	got, err := client.GetPublicKey("secret/data/ssh/test")
+	if err != nil {
+		t.Fatalf("GetPublicKey failed: %v", err)
+	}
+	if string(got.PublicKey) != long || string(got.Previous) != previous || !got.PreviousExpires.Equal(expires) {
+		t.Errorf("GetPublicKey = %q, %q, %v, want %q, %q, %v", got.PublicKey, got.Previous, got.PreviousExpires, long, previous, expires)
+	}
+
+	// A shorter key removes the chunks of the longer one and the previous key, and keeps other metadata
+	short := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@example.com\n"
+	if err := client.PublishPublicKey("secret/data/ssh/test", &PublicKeys{PublicKey: []byte(short)}); err != nil {
+		t.Fatalf("PublishPublicKey failed: %v", err)
+	}
+	got, err = client.GetPublicKey("secret/data/ssh/test")
+	if err != nil || string(got.PublicKey) != short || got.Previous != nil {
+		t.Errorf("GetPublicKey = %+v, %v, want %q without a previous key", got, err, short)
+	}
+	if _, ok := customMetadata["public_key_1"]; ok || customMetadata["owner"] != "ops" {
+		t.Errorf("unexpected custom metadata after republishing: %v", customMetadata)
+	}
+	if _, ok := customMetadata["previous_expires"]; ok {
+		t.Errorf("previous_expires left in custom metadata: %v", customMetadata)
+	}
+
+	if err := client.PublishPublicKey("secret/ssh/test", &PublicKeys{PublicKey: []byte(short)}); err == nil {
+		t.Error("Expected error for a path without /data/, got nil")
+	}
+}
+
+func TestStorePassphrase_keeps_other_fields(t *testing.T) {
+	// Fake KV v2 data endpoint holding one secret
+	stored := map[string]interface{}{"passphrase": "old", "note": "ci"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/ssh/passphrase" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut, http.MethodPost:
+			var body map[string]map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			stored = body["data"]
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": stored},
+			})
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	vault, err := vaultapi.NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client := &VaultClient{client: vault}
+
+	if err := client.StorePassphrase("secret/data/ssh/passphrase", []byte("new")); err != nil {
+		t.Fatalf("StorePassphrase failed: %v", err)
+	}
+	if passphrase, err := client.GetPassphrase("secret/data/ssh/passphrase"); err != nil || string(passphrase) != "new" {
+		t.Errorf("GetPassphrase = %q, %v, want new", passphrase, err)
+	}
+	if stored["note"] != "ci" {
+		t.Errorf("other fields should be kept, got %v", stored)
+	}
+}
+
+func TestKVv2DataPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "secret/data/ssh/a", want: "secret/data/ssh/a", wantOK: true},
+		{path: "secret/ssh/a", want: "secret/data/ssh/a"},
+		{path: "other/ssh/a", want: "other/ssh/a"},
+	}
+	for _, tt := range tests {
+		got, ok := KVv2DataPath("secret/", tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("KVv2DataPath(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestVaultAddress_prefers_environment(t *testing.T) {
+	cfg := &mockConfig{VaultAddress: "https://config:8200"}
+
+	t.Setenv("BAO_ADDR", "")
+	t.Setenv("VAULT_ADDR", "")
+	if got := VaultAddress(cfg); got != "https://config:8200" {
+		t.Errorf("VaultAddress() = %q, want the configured address", got)
+	}
+	if got := VaultAddress(nil); got != "" {
+		t.Errorf("VaultAddress(nil) = %q, want empty", got)
+	}
+
+	t.Setenv("VAULT_ADDR", "https://vault:8200")
+	if got := VaultAddress(cfg); got != "https://vault:8200" {
+		t.Errorf("VaultAddress() = %q, want VAULT_ADDR", got)
+	}
+	t.Setenv("BAO_ADDR", "https://bao:8200")
+	if got := VaultAddress(cfg); got != "https://bao:8200" {
+		t.Errorf("VaultAddress() = %q, want BAO_ADDR", got)
+	}
+}
+
+func TestVaultAddress_profile_wins_over_environment(t *testing.T) {
+	t.Setenv("BAO_ADDR", "")
+	t.Setenv("VAULT_ADDR", "https://vault:8200")
+
+	cfg := &mockConfig{VaultAddress: "https://bao.home:8200", Profile: "personal"}
+	if got := VaultAddress(cfg); got != "https://bao.home:8200" {
+		t.Errorf("VaultAddress() = %q, want the address of the profile", got)
+	}
+	// Profiles without an address still use the environment
+	cfg.VaultAddress = ""
+	if got := VaultAddress(cfg); got != "https://vault:8200" {
+		t.Errorf("VaultAddress() = %q, want VAULT_ADDR", got)
+	}
+}
+
+func TestLogin_uses_profile_token_and_namespace(t *testing.T) {
+	var token, namespace string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, namespace = r.Header.Get("X-Vault-Token"), r.Header.Get("X-Vault-Namespace")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ttl": 0}})
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("BAO_TOKEN", "")
+	t.Setenv("VAULT_TOKEN", "company-token")
+	t.Setenv("BAO_NAMESPACE", "")
+	t.Setenv("VAULT_NAMESPACE", "")
+	t.Setenv("HOME_BAO_TOKEN", "personal-token")
+
+	cfg := &mockConfig{VaultNamespace: "team/ssh", VaultTokenEnv: "HOME_BAO_TOKEN", Profile: "personal"}
+	diagnostics, err := NewVaultDiagnostics(server.URL)
+	if err != nil {
+		t.Fatalf("NewVaultDiagnostics failed: %v", err)
+	}
+	if _, err := diagnostics.Login(cfg); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if token != "personal-token" || namespace != "team/ssh" {
+		t.Errorf("request had token %q and namespace %q, want personal-token and team/ssh", token, namespace)
+	}
+
+	t.Setenv("HOME_BAO_TOKEN", "")
+	if _, err := diagnostics.Login(cfg); err == nil || !strings.Contains(err.Error(), "HOME_BAO_TOKEN") {
+		t.Errorf("Login() error = %v, want an error naming HOME_BAO_TOKEN", err)
+	}
+}
@@ -1,8 +1,11 @@
 package ssh
 
 import (
+	"fmt"
 	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 	"github.com/codeignus/sm-ssh-add/internal/sm"
@@ -10,6 +13,32 @@ import (
 	"golang.org/x/crypto/ssh/agent"
 )
 
+// managedMarker tags the comment of keys loaded by sm-ssh-add with their secret manager path
+const managedMarker = "sm-ssh-add:"
+
+// ManagedComment returns the agent comment for a key loaded from the given path.
+// The path is appended as a marker so managed keys can be recognised in the agent later.
+func ManagedComment(comment, path string) string {
+	marker := fmt.Sprintf("[%s%s]", managedMarker, path)
+	if comment == "" {
+		return marker
+	}
+	return comment + " " + marker
+}
+
+// ManagedPath returns the secret manager path recorded in an agent comment by ManagedComment
+func ManagedPath(comment string) (string, bool) {
+	start := strings.LastIndex(comment, "["+managedMarker)
+	if start < 0 || !strings.HasSuffix(comment, "]") {
+		return "", false
+	}
+	path := comment[start+len(managedMarker)+1 : len(comment)-1]
+	if path == "" {
+		return "", false
+	}
+	return path, true
+}
+
 // Agent handles SSH agent operations and provides methods to add keys and list existing keys
 type Agent struct {
 	client agent.ExtendedAgent
@@ -36,32 +65,45 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 	}, nil
 }
 
-// AddKey adds a key pair to the SSH agent after checking if it already exists
-func (a *Agent) AddKey(keyPair *KeyPair) error {
-	var privateKey interface{}
-	var signer ssh.Signer
-	var err error
-
-	// Parse private key with or without passphrase
-	if keyPair.Passphrase != nil {
-		privateKey, err = ssh.ParseRawPrivateKeyWithPassphrase(keyPair.PrivateKey, []byte(*keyPair.Passphrase))
-		if err != nil {
-			return wrapError(err, "failed to parse private key with passphrase")
-		}
-		// Also create a signer for fingerprint checking
-		signer, err = ssh.NewSignerFromKey(privateKey)
+// parsePrivateKey parses a PEM encoded private key, decrypting it if a passphrase is given
+func parsePrivateKey(privateKey []byte, passphrase *string) (interface{}, error) {
+	if passphrase != nil {
+		key, err := ssh.ParseRawPrivateKeyWithPassphrase(privateKey, []byte(*passphrase))
 		if err != nil {
-			return wrapError(err, "failed to create signer from private key")
+			return nil, wrapError(err, "failed to parse private key with passphrase")
 		}
-	} else {
-		privateKey, err = ssh.ParseRawPrivateKey(keyPair.PrivateKey)
+		return key, nil
+	}
+
+	key, err := ssh.ParseRawPrivateKey(privateKey)
+	if err != nil {
+		return nil, wrapError(err, "failed to parse private key")
+	}
+	return key, nil
+}
+
+// AddKey adds a key pair to the SSH agent after checking if it already exists.
+// ssh-agent does not report the constraints of loaded keys, so when constraints are
+// requested an existing copy of the key is replaced instead of being reported as a duplicate.
+func (a *Agent) AddKey(keyPair *KeyPair) error {
+	privateKey, err := parsePrivateKey(keyPair.PrivateKey, keyPair.Passphrase)
+	if err != nil {
+		return err
+	}
+	// Also create a signer for fingerprint checking
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return wrapError(err, "failed to create signer from private key")
+	}
+
+	// The stored public key is used to find the key in the agent again, so it must match
+	if len(keyPair.PublicKey) > 0 {
+		fingerprint, err := Fingerprint(keyPair.PublicKey)
 		if err != nil {
-			return wrapError(err, "failed to parse private key")
+			return err
 		}
-		// Also create a signer for fingerprint checking
-		signer, err = ssh.NewSignerFromKey(privateKey)
-		if err != nil {
-			return wrapError(err, "failed to create signer from private key")
+		if fingerprint != ssh.FingerprintSHA256(signer.PublicKey()) {
+			return ErrPublicKeyMismatch
 		}
 	}
 
@@ -70,18 +112,32 @@ func (a *Agent) AddKey(keyPair *KeyPair) error {
 		return wrapError(err, "failed to list keys in agent")
 	}
 
+	constrained := keyPair.ConfirmBeforeUse || len(keyPair.Destinations) > 0 || keyPair.Lifetime > 0
+
 	existingFingerprint := ssh.FingerprintSHA256(signer.PublicKey())
 	for _, key := range keys {
 		if ssh.FingerprintSHA256(key) == existingFingerprint {
-			return sm.ErrKeyExistsInAgent
+			if !constrained {
+				return sm.ErrKeyExistsInAgent
+			}
+			// The existing key may have been loaded with other constraints, re-add it with the requested ones
+			if err := a.client.Remove(signer.PublicKey()); err != nil {
+				return wrapError(err, "failed to remove existing key from agent")
+			}
+			break
 		}
 	}
 
 	addedKey := agent.AddedKey{
 		PrivateKey:       privateKey,
 		Comment:          keyPair.Comment,
-		LifetimeSecs:     0,
-		ConfirmBeforeUse: false,
+		LifetimeSecs:     uint32((keyPair.Lifetime + time.Second - 1) / time.Second),
+		ConfirmBeforeUse: keyPair.ConfirmBeforeUse,
+	}
+	if len(keyPair.Destinations) > 0 {
+		addedKey.ConstraintExtensions = []agent.ConstraintExtension{
+			destinationConstraintExtension(keyPair.Destinations),
+		}
 	}
 
 	err = a.client.Add(addedKey)
@@ -92,6 +148,66 @@ func (a *Agent) AddKey(keyPair *KeyPair) error {
 	return nil
 }
 
+// RemoveKey removes the key with the given authorized_keys format public key from the SSH agent
+func (a *Agent) RemoveKey(publicKey []byte) error {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return wrapError(err, "failed to parse public key")
+	}
+
+	exists, err := a.KeyExists(ssh.FingerprintSHA256(pubKey))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sm.ErrKeyNotInAgent
+	}
+
+	if err := a.client.Remove(pubKey); err != nil {
+		return wrapError(err, "failed to remove key from agent")
+	}
+	return nil
+}
+
+// RemoveManagedKeys removes every key loaded by sm-ssh-add (recognised by its comment marker)
+// and returns the secret manager paths of the removed keys
+func (a *Agent) RemoveManagedKeys() ([]string, error) {
+	keys, err := a.client.List()
+	if err != nil {
+		return nil, wrapError(err, "failed to list keys")
+	}
+
+	var removed []string
+	for _, key := range keys {
+		path, ok := ManagedPath(key.Comment)
+		if !ok {
+			continue
+		}
+		if err := a.client.Remove(key); err != nil {
+			return removed, wrapError(err, fmt.Sprintf("failed to remove key for %s from agent", path))
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// Lock locks the SSH agent with the given passphrase. A locked agent keeps its keys
+// but refuses to list them or sign with them until it is unlocked.
+func (a *Agent) Lock(passphrase []byte) error {
+	if err := a.client.Lock(passphrase); err != nil {
+		return wrapError(err, "failed to lock agent (is it already locked?)")
+	}
+	return nil
+}
+
+// Unlock unlocks the SSH agent with the passphrase it was locked with
+func (a *Agent) Unlock(passphrase []byte) error {
+	if err := a.client.Unlock(passphrase); err != nil {
+		return wrapError(err, "failed to unlock agent (wrong passphrase or not locked?)")
+	}
+	return nil
+}
+
 // List returns all keys currently loaded in the SSH agent
 func (a *Agent) List() ([]*agent.Key, error) {
 	keys, err := a.client.List()
@@ -101,6 +217,29 @@ func (a *Agent) List() ([]*agent.Key, error) {
 	return keys, nil
 }
 
+// AgentKey is a key loaded in the SSH agent
+type AgentKey struct {
+	PublicKey []byte // authorized_keys format, without comment
+	Comment   string
+}
+
+// Keys returns the public keys and comments of all keys loaded in the SSH agent
+func (a *Agent) Keys() ([]AgentKey, error) {
+	keys, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+
+	agentKeys := make([]AgentKey, 0, len(keys))
+	for _, key := range keys {
+		agentKeys = append(agentKeys, AgentKey{
+			PublicKey: ssh.MarshalAuthorizedKey(key),
+			Comment:   key.Comment,
+		})
+	}
+	return agentKeys, nil
+}
+
 // Close closes the connection to the SSH agent
 func (a *Agent) Close() error {
 	if a.conn != nil {
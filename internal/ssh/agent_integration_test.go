@@ -5,6 +5,7 @@ package ssh
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/codeignus/sm-ssh-add/internal/config"
 	"golang.org/x/crypto/ssh"
@@ -271,3 +272,40 @@ func TestEndToEnd_generate_and_load_workflow(t *testing.T) {
 		t.Error("Key was not loaded into agent successfully")
 	}
 }
+
+func TestAddKey_removes_key_after_lifetime(t *testing.T) {
+	sshAuthSock := os.Getenv("SSH_AUTH_SOCK")
+	if sshAuthSock == "" {
+		t.Skip("SSH_AUTH_SOCK not set - skipping agent integration test")
+	}
+
+	agent, err := NewAgent(&config.Config{DefaultProvider: "vault"})
+	if err != nil {
+		t.Fatalf("Failed to connect to ssh-agent: %v", err)
+	}
+	defer agent.Close()
+
+	// Setup: Generate a key that only lives for a second
+	keyPair, err := GenerateKeyPair("test@lifetime", nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	keyPair.Lifetime = time.Second
+	fingerprint, err := Fingerprint(keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	// Test: The key is added and dropped by the agent once its lifetime ends
+	if err := agent.AddKey(keyPair); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if exists, err := agent.KeyExists(fingerprint); err != nil || !exists {
+		t.Fatalf("Key should be in agent: %v, %v", exists, err)
+	}
+
+	time.Sleep(3 * time.Second)
+	if exists, err := agent.KeyExists(fingerprint); err != nil || exists {
+		t.Errorf("Key should have expired from agent: %v, %v", exists, err)
+	}
+}
@@ -0,0 +1,228 @@
+package ssh
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// recordingKeyring wraps an in-memory keyring and records every added key.
+// The keyring rejects constraints it cannot enforce, so they are recorded here and stripped.
+type recordingKeyring struct {
+	agent.Agent
+	mu    sync.Mutex
+	added []agent.AddedKey
+}
+
+func (r *recordingKeyring) Add(key agent.AddedKey) error {
+	r.mu.Lock()
+	r.added = append(r.added, key)
+	r.mu.Unlock()
+
+	key.ConfirmBeforeUse = false
+	key.ConstraintExtensions = nil
+	return r.Agent.Add(key)
+}
+
+func (r *recordingKeyring) lastAdded(t *testing.T) agent.AddedKey {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.added) == 0 {
+		t.Fatal("no key was added to the agent")
+	}
+	return r.added[len(r.added)-1]
+}
+
+// newTestAgent returns an Agent connected to an in-process ssh-agent server
+func newTestAgent(t *testing.T) (*Agent, *recordingKeyring) {
+	t.Helper()
+	keyring := &recordingKeyring{Agent: agent.NewKeyring()}
+
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		_ = agent.ServeAgent(keyring, serverConn)
+	}()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+
+	return &Agent{client: agent.NewClient(clientConn), conn: clientConn}, keyring
+}
+
+func TestAddKey_ConfirmBeforeUse(t *testing.T) {
+	a, keyring := newTestAgent(t)
+
+	keyPair, err := GenerateKeyPair("confirm@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	// First load without confirmation
+	if err := a.AddKey(keyPair); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if keyring.lastAdded(t).ConfirmBeforeUse {
+		t.Error("ConfirmBeforeUse should be false when not requested")
+	}
+
+	// Loading again without confirmation is a duplicate
+	if err := a.AddKey(keyPair); !errors.Is(err, sm.ErrKeyExistsInAgent) {
+		t.Errorf("AddKey duplicate error = %v, want ErrKeyExistsInAgent", err)
+	}
+
+	// Requesting confirmation re-adds the key with the constraint
+	keyPair.ConfirmBeforeUse = true
+	if err := a.AddKey(keyPair); err != nil {
+		t.Fatalf("AddKey with confirm failed: %v", err)
+	}
+	if !keyring.lastAdded(t).ConfirmBeforeUse {
+		t.Error("ConfirmBeforeUse should be true when requested")
+	}
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("expected 1 key in agent, got %d", len(keys))
+	}
+}
+
+func TestManagedComment(t *testing.T) {
+	tests := []struct {
+		comment string
+		path    string
+		want    string
+	}{
+		{comment: "user@example.com", path: "secret/data/ssh/github", want: "user@example.com [sm-ssh-add:secret/data/ssh/github]"},
+		{comment: "", path: "secret/data/ssh/github", want: "[sm-ssh-add:secret/data/ssh/github]"},
+	}
+
+	for _, tt := range tests {
+		got := ManagedComment(tt.comment, tt.path)
+		if got != tt.want {
+			t.Errorf("ManagedComment(%q, %q) = %q, want %q", tt.comment, tt.path, got, tt.want)
+		}
+		path, ok := ManagedPath(got)
+		if !ok || path != tt.path {
+			t.Errorf("ManagedPath(%q) = %q, %v, want %q, true", got, path, ok, tt.path)
+		}
+	}
+
+	for _, comment := range []string{"user@example.com", "", "[sm-ssh-add:]", "key [other:secret/ssh/a]"} {
+		if path, ok := ManagedPath(comment); ok {
+			t.Errorf("ManagedPath(%q) = %q, true, want not managed", comment, path)
+		}
+	}
+}
+
+func TestRemoveKey(t *testing.T) {
+	a, _ := newTestAgent(t)
+
+	keyPair, err := GenerateKeyPair("remove@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	if err := a.RemoveKey(keyPair.PublicKey); !errors.Is(err, sm.ErrKeyNotInAgent) {
+		t.Errorf("RemoveKey on missing key error = %v, want ErrKeyNotInAgent", err)
+	}
+
+	if err := a.AddKey(keyPair); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if err := a.RemoveKey(keyPair.PublicKey); err != nil {
+		t.Fatalf("RemoveKey failed: %v", err)
+	}
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected empty agent after RemoveKey, got %d keys", len(keys))
+	}
+}
+
+func TestRemoveManagedKeys(t *testing.T) {
+	a, _ := newTestAgent(t)
+
+	managed, err := GenerateKeyPair("", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	managed.Comment = ManagedComment("managed@test", "secret/data/ssh/managed")
+
+	unmanaged, err := GenerateKeyPair("unmanaged@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	for _, kp := range []*KeyPair{managed, unmanaged} {
+		if err := a.AddKey(kp); err != nil {
+			t.Fatalf("AddKey failed: %v", err)
+		}
+	}
+
+	removed, err := a.RemoveManagedKeys()
+	if err != nil {
+		t.Fatalf("RemoveManagedKeys failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "secret/data/ssh/managed" {
+		t.Errorf("removed = %v, want [secret/data/ssh/managed]", removed)
+	}
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Comment != "unmanaged@test" {
+		t.Errorf("expected only the unmanaged key to remain, got %v", keys)
+	}
+}
+
+func TestLockUnlock(t *testing.T) {
+	a, _ := newTestAgent(t)
+
+	keyPair, err := GenerateKeyPair("lock@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	if err := a.AddKey(keyPair); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	if err := a.Lock([]byte("lock-passphrase")); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	// A locked agent hides its keys
+	keys, err := a.List()
+	if err != nil {
+		t.Fatalf("List on locked agent failed: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("locked agent listed %d keys, want 0", len(keys))
+	}
+
+	if err := a.Unlock([]byte("wrong-passphrase")); err == nil {
+		t.Error("Unlock with wrong passphrase should fail")
+	}
+	if err := a.Unlock([]byte("lock-passphrase")); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	keys, err = a.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("unlocked agent listed %d keys, want 1", len(keys))
+	}
+}
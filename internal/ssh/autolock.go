@@ -0,0 +1,51 @@
+package ssh
+
+import (
+	"context"
+	"time"
+)
+
+// Lockable is an agent that can be locked automatically
+type Lockable interface {
+	Lock(passphrase []byte) error
+	// LastUsed returns when a signature was last requested or the agent was last unlocked
+	LastUsed() time.Time
+}
+
+// AutoLock locks a with passphrase once idle has passed since it was last used, and whenever
+// screenLocked receives. A zero idle or a nil screenLocked disables that trigger. onLock is
+// called with the reason every time a is locked. AutoLock returns when ctx is cancelled.
+func AutoLock(ctx context.Context, a Lockable, passphrase []byte, idle time.Duration, screenLocked <-chan struct{}, onLock func(reason string)) {
+	var tick <-chan time.Time
+	if idle > 0 {
+		// Check often enough that the agent is locked soon after it becomes idle
+		ticker := time.NewTicker(max(min(idle/4, 30*time.Second), time.Millisecond))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lock := func(reason string) {
+		// An agent that is already locked fails with ErrAgentLocked and keeps its passphrase
+		if err := a.Lock(passphrase); err == nil {
+			onLock(reason)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-screenLocked:
+			if !ok {
+				// The screen lock watcher stopped
+				screenLocked = nil
+				continue
+			}
+			lock("screen locked")
+		case <-tick:
+			if time.Since(a.LastUsed()) >= idle {
+				lock("idle for " + idle.String())
+			}
+		}
+	}
+}
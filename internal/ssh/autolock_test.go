@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAutoLock_LocksIdleAgent(t *testing.T) {
+	provider := newCountingProvider(t, "secret/ssh/a")
+	store, err := NewKeyStore(provider, []string{"secret/ssh/a"}, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewKeyStore failed: %v", err)
+	}
+	client := serveKeyStore(t, store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	locked := make(chan string, 1)
+	go AutoLock(ctx, store, []byte("secret"), 50*time.Millisecond, nil, func(reason string) {
+		locked <- reason
+	})
+
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle agent was not locked")
+	}
+	if keys, _ := client.List(); len(keys) != 0 {
+		t.Errorf("locked agent listed %d keys, want 0", len(keys))
+	}
+	if err := client.Unlock([]byte("secret")); err != nil {
+		t.Fatalf("Unlock with the auto-lock passphrase failed: %v", err)
+	}
+	if keys, _ := client.List(); len(keys) != 1 {
+		t.Errorf("unlocked agent listed %d keys, want 1", len(keys))
+	}
+}
+
+func TestAutoLock_LocksOnScreenLock(t *testing.T) {
+	upstream := newTestUpstream()
+	proxy := NewProxy(upstream.dial, map[string]string{}, &syncBuffer{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	screenLocked := make(chan struct{})
+	locked := make(chan string, 1)
+	go AutoLock(ctx, proxy, []byte("secret"), 0, screenLocked, func(reason string) {
+		locked <- reason
+	})
+
+	screenLocked <- struct{}{}
+	select {
+	case reason := <-locked:
+		if reason != "screen locked" {
+			t.Errorf("reason = %q, want screen locked", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy was not locked when the screen was locked")
+	}
+
+	// A stopped watcher leaves the agent running
+	close(screenLocked)
+	cancel()
+}
@@ -0,0 +1,74 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// Export formats
+const (
+	FormatOpenSSH = "openssh"
+	FormatPEM     = "pem"
+	FormatPKCS8   = "pkcs8"
+	FormatPPK     = "ppk"
+)
+
+// ExportKeyPair decrypts the private key of keyPair with keyPair.Passphrase and encodes it in the
+// given format. If passphrase is non-empty, the exported key is encrypted with it, which is only
+// supported by the openssh and ppk formats.
+func ExportKeyPair(keyPair *KeyPair, format string, passphrase []byte) ([]byte, error) {
+	privKey, err := parsePrivateKey(keyPair.PrivateKey, keyPair.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	privKey = normalizePrivateKey(privKey)
+
+	if len(passphrase) > 0 && format != FormatOpenSSH && format != FormatPPK {
+		return nil, fmt.Errorf("%s format does not support passphrase encryption, use %s or %s", format, FormatOpenSSH, FormatPPK)
+	}
+
+	switch format {
+	case FormatOpenSSH:
+		return MarshalPrivateKey(privKey, keyPair.Comment, passphrase)
+
+	case FormatPEM:
+		switch k := privKey.(type) {
+		case *rsa.PrivateKey:
+			return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+		case *ecdsa.PrivateKey:
+			der, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return nil, wrapError(err, "failed to marshal ecdsa key")
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+		default:
+			return nil, fmt.Errorf("%T keys have no traditional PEM format, use %s or %s", privKey, FormatOpenSSH, FormatPKCS8)
+		}
+
+	case FormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(privKey)
+		if err != nil {
+			return nil, wrapError(err, "failed to marshal pkcs8 key")
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+
+	case FormatPPK:
+		return marshalPPK(privKey, keyPair.Comment, passphrase)
+
+	default:
+		return nil, fmt.Errorf("unsupported format %q: must be %s, %s, %s or %s", format, FormatOpenSSH, FormatPEM, FormatPKCS8, FormatPPK)
+	}
+}
+
+// normalizePrivateKey converts parsed keys to the types accepted by the marshallers.
+// OpenSSH ed25519 keys are parsed to a pointer.
+func normalizePrivateKey(privKey interface{}) interface{} {
+	if k, ok := privKey.(*ed25519.PrivateKey); ok {
+		return *k
+	}
+	return privKey
+}
@@ -0,0 +1,233 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// parsePPK decodes a PPK version 3 file, verifies its MAC and returns the headers, public blob
+// and decrypted private blob
+func parsePPK(t *testing.T, data []byte, passphrase []byte) (map[string]string, []byte, []byte) {
+	t.Helper()
+	headers := map[string]string{}
+	blobs := map[string][]byte{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			t.Fatalf("malformed line %q", scanner.Text())
+		}
+		headers[name] = value
+		if name == "Public-Lines" || name == "Private-Lines" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				t.Fatalf("invalid %s: %v", name, err)
+			}
+			var encoded string
+			for i := 0; i < n && scanner.Scan(); i++ {
+				encoded += scanner.Text()
+			}
+			if blobs[name], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				t.Fatalf("invalid base64 in %s: %v", name, err)
+			}
+		}
+	}
+
+	publicBlob, privateBlob := blobs["Public-Lines"], blobs["Private-Lines"]
+	var macKey []byte
+	if headers["Encryption"] == "aes256-cbc" {
+		salt, _ := hex.DecodeString(headers["Argon2-Salt"])
+		memory, _ := strconv.Atoi(headers["Argon2-Memory"])
+		passes, _ := strconv.Atoi(headers["Argon2-Passes"])
+		parallelism, _ := strconv.Atoi(headers["Argon2-Parallelism"])
+		derived := argon2.IDKey(passphrase, salt, uint32(passes), uint32(memory), uint8(parallelism), 80)
+		block, err := aes.NewCipher(derived[:32])
+		if err != nil {
+			t.Fatalf("failed to create cipher: %v", err)
+		}
+		cipher.NewCBCDecrypter(block, derived[32:48]).CryptBlocks(privateBlob, privateBlob)
+		macKey = derived[48:]
+	}
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(ssh.Marshal(struct {
+		Algorithm, Encryption, Comment string
+		PublicBlob, PrivateBlob        []byte
+	}{headers["PuTTY-User-Key-File-3"], headers["Encryption"], headers["Comment"], publicBlob, privateBlob}))
+	if got := hex.EncodeToString(mac.Sum(nil)); got != headers["Private-MAC"] {
+		t.Fatalf("Private-MAC = %s, want %s", headers["Private-MAC"], got)
+	}
+
+	return headers, publicBlob, privateBlob
+}
+
+func TestExportKeyPair_Formats(t *testing.T) {
+	tests := []struct {
+		keyType string
+		format  string
+		pemType string
+	}{
+		{keyType: KeyTypeEd25519, format: FormatOpenSSH, pemType: "OPENSSH PRIVATE KEY"},
+		{keyType: KeyTypeEd25519, format: FormatPKCS8, pemType: "PRIVATE KEY"},
+		{keyType: KeyTypeRSA, format: FormatPEM, pemType: "RSA PRIVATE KEY"},
+		{keyType: KeyTypeRSA, format: FormatPKCS8, pemType: "PRIVATE KEY"},
+		{keyType: KeyTypeECDSA, format: FormatPEM, pemType: "EC PRIVATE KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keyType+" "+tt.format, func(t *testing.T) {
+			bits := 0
+			if tt.keyType == KeyTypeRSA {
+				bits = MinRSABits
+			}
+			passphrase := "stored-passphrase"
+			keyPair, err := GenerateKeyPairOfType(tt.keyType, bits, "", []byte(passphrase))
+			if err != nil {
+				t.Fatalf("GenerateKeyPairOfType failed: %v", err)
+			}
+			keyPair.Passphrase = &passphrase
+
+			data, err := ExportKeyPair(keyPair, tt.format, nil)
+			if err != nil {
+				t.Fatalf("ExportKeyPair failed: %v", err)
+			}
+			block, _ := pem.Decode(data)
+			if block == nil || block.Type != tt.pemType {
+				t.Fatalf("exported key is not a %s block", tt.pemType)
+			}
+
+			// The exported key is decrypted and matches the stored public key
+			signer, err := ssh.ParsePrivateKey(data)
+			if err != nil {
+				t.Fatalf("failed to parse exported key: %v", err)
+			}
+			pubKey, _, _, _, err := ssh.ParseAuthorizedKey(keyPair.PublicKey)
+			if err != nil {
+				t.Fatalf("failed to parse public key: %v", err)
+			}
+			if !bytes.Equal(pubKey.Marshal(), signer.PublicKey().Marshal()) {
+				t.Error("exported key doesn't match the public key")
+			}
+		})
+	}
+}
+
+func TestExportKeyPair_Reencrypt(t *testing.T) {
+	keyPair, err := GenerateKeyPair("", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	data, err := ExportKeyPair(keyPair, FormatOpenSSH, []byte("new-passphrase"))
+	if err != nil {
+		t.Fatalf("ExportKeyPair failed: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKey(data); err == nil {
+		t.Error("exported key should be encrypted")
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte("new-passphrase")); err != nil {
+		t.Errorf("failed to parse exported key with new passphrase: %v", err)
+	}
+
+	for _, format := range []string{FormatPEM, FormatPKCS8} {
+		if _, err := ExportKeyPair(keyPair, format, []byte("new-passphrase")); err == nil {
+			t.Errorf("expected error encrypting %s export, got nil", format)
+		}
+	}
+}
+
+func TestExportKeyPair_Errors(t *testing.T) {
+	keyPair, err := GenerateKeyPair("", []byte("secret"))
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	if _, err := ExportKeyPair(keyPair, FormatOpenSSH, nil); err == nil {
+		t.Error("expected error exporting encrypted key without passphrase, got nil")
+	}
+
+	passphrase := "secret"
+	keyPair.Passphrase = &passphrase
+	if _, err := ExportKeyPair(keyPair, FormatPEM, nil); err == nil {
+		t.Error("expected error exporting ed25519 key as traditional PEM, got nil")
+	}
+	if _, err := ExportKeyPair(keyPair, "der", nil); err == nil {
+		t.Error("expected error for unsupported format, got nil")
+	}
+}
+
+func TestExportKeyPair_PPK(t *testing.T) {
+	for _, keyType := range []string{KeyTypeEd25519, KeyTypeRSA, KeyTypeECDSA} {
+		for _, passphrase := range []string{"", "ppk-passphrase"} {
+			name := keyType + " unencrypted"
+			if passphrase != "" {
+				name = keyType + " encrypted"
+			}
+			t.Run(name, func(t *testing.T) {
+				bits := 0
+				if keyType == KeyTypeRSA {
+					bits = MinRSABits
+				}
+				keyPair, err := GenerateKeyPairOfType(keyType, bits, "putty@example.com", nil)
+				if err != nil {
+					t.Fatalf("GenerateKeyPairOfType failed: %v", err)
+				}
+
+				data, err := ExportKeyPair(keyPair, FormatPPK, []byte(passphrase))
+				if err != nil {
+					t.Fatalf("ExportKeyPair failed: %v", err)
+				}
+				headers, publicBlob, privateBlob := parsePPK(t, data, []byte(passphrase))
+
+				if headers["PuTTY-User-Key-File-3"] != keyPair.KeyType {
+					t.Errorf("algorithm = %q, want %q", headers["PuTTY-User-Key-File-3"], keyPair.KeyType)
+				}
+				if headers["Comment"] != "putty@example.com" {
+					t.Errorf("Comment = %q, want putty@example.com", headers["Comment"])
+				}
+				wantEncryption := "none"
+				if passphrase != "" {
+					wantEncryption = "aes256-cbc"
+				}
+				if headers["Encryption"] != wantEncryption {
+					t.Errorf("Encryption = %q, want %q", headers["Encryption"], wantEncryption)
+				}
+
+				pubKey, _, _, _, err := ssh.ParseAuthorizedKey(keyPair.PublicKey)
+				if err != nil {
+					t.Fatalf("failed to parse public key: %v", err)
+				}
+				if !bytes.Equal(publicBlob, pubKey.Marshal()) {
+					t.Error("public blob doesn't match the public key")
+				}
+
+				// The private blob starts with the private key fields, followed by padding if encrypted
+				privKey, err := ssh.ParseRawPrivateKey(keyPair.PrivateKey)
+				if err != nil {
+					t.Fatalf("failed to parse private key: %v", err)
+				}
+				want, err := ppkPrivateBlob(normalizePrivateKey(privKey))
+				if err != nil {
+					t.Fatalf("ppkPrivateBlob failed: %v", err)
+				}
+				if !bytes.HasPrefix(privateBlob, want) {
+					t.Error("private blob doesn't contain the private key")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package ssh
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrPassphraseRequired is returned when an encrypted private key is imported without a passphrase
+var ErrPassphraseRequired = errors.New("private key is encrypted")
+
+// ImportKeyPair parses an existing OpenSSH, PEM or PKCS#8 private key and marshals it to OpenSSH
+// format. passphrase decrypts the source key; if it is nil and the key is encrypted,
+// ErrPassphraseRequired is returned. If newPassphrase is non-empty, the imported key is encrypted with it.
+func ImportKeyPair(privateKey []byte, passphrase []byte, comment string, newPassphrase []byte) (*KeyPair, error) {
+	var privKey interface{}
+	var err error
+	if passphrase == nil {
+		privKey, err = ssh.ParseRawPrivateKey(privateKey)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, ErrPassphraseRequired
+		}
+	} else {
+		privKey, err = ssh.ParseRawPrivateKeyWithPassphrase(privateKey, passphrase)
+	}
+	if err != nil {
+		return nil, wrapError(err, "failed to parse private key")
+	}
+
+	privKey = normalizePrivateKey(privKey)
+
+	privateKeyPEM, err := MarshalPrivateKey(privKey, comment, newPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(privKey)
+	if err != nil {
+		return nil, wrapError(err, "failed to convert public key")
+	}
+
+	return &KeyPair{
+		PrivateKey: privateKeyPEM,
+		PublicKey:  ssh.MarshalAuthorizedKey(signer.PublicKey()),
+		Comment:    comment,
+		KeyType:    signer.PublicKey().Type(),
+	}, nil
+}
+
+// PublicKeyComment returns the comment of an authorized_keys format public key
+func PublicKeyComment(publicKey []byte) (string, error) {
+	_, comment, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return "", wrapError(err, "failed to parse public key")
+	}
+	return comment, nil
+}
+
+// PrivateKeyComment returns the comment stored in an OpenSSH private key, or an empty string for
+// formats without one. The comment of an encrypted OpenSSH key is encrypted with the key, so
+// ErrPassphraseRequired is returned for those.
+func PrivateKeyComment(privateKey []byte) (string, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return "", nil
+	}
+	defer clear(block.Bytes)
+
+	const magic = "openssh-key-v1\x00"
+	if !strings.HasPrefix(string(block.Bytes), magic) {
+		return "", errors.New("failed to parse private key: invalid OpenSSH private key format")
+	}
+	var key struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(magic):], &key); err != nil {
+		return "", wrapError(err, "failed to parse private key")
+	}
+	if key.CipherName != "none" {
+		return "", ErrPassphraseRequired
+	}
+
+	var private struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Rest    []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(key.PrivKeyBlock, &private); err != nil {
+		return "", wrapError(err, "failed to parse private key")
+	}
+
+	// The comment follows the key fields, which differ by key type as in x/crypto's parser
+	var comment string
+	var err error
+	switch private.Keytype {
+	case ssh.KeyAlgoRSA:
+		var fields struct {
+			N, E, D, Iqmp, P, Q []byte
+			Comment             string
+			Pad                 []byte `ssh:"rest"`
+		}
+		err = ssh.Unmarshal(private.Rest, &fields)
+		comment = fields.Comment
+	case ssh.KeyAlgoED25519:
+		var fields struct {
+			Pub, Priv []byte
+			Comment   string
+			Pad       []byte `ssh:"rest"`
+		}
+		err = ssh.Unmarshal(private.Rest, &fields)
+		comment = fields.Comment
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		var fields struct {
+			Curve   string
+			Pub, D  []byte
+			Comment string
+			Pad     []byte `ssh:"rest"`
+		}
+		err = ssh.Unmarshal(private.Rest, &fields)
+		comment = fields.Comment
+	default:
+		return "", fmt.Errorf("unsupported key type %s", private.Keytype)
+	}
+	if err != nil {
+		return "", wrapError(err, "failed to parse private key")
+	}
+	return comment, nil
+}
+
+// IsPrivateKey reports whether data is a PEM encoded private key
+func IsPrivateKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && strings.HasSuffix(block.Type, "PRIVATE KEY")
+}
+
+// PrivateKeyFingerprint returns the SHA256 fingerprint of a private key without decrypting it when
+// the format stores the public key in the clear, as OpenSSH does. ErrPassphraseRequired is
+// returned for other encrypted keys.
+func PrivateKeyFingerprint(privateKey []byte) (string, error) {
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err == nil {
+		return ssh.FingerprintSHA256(signer.PublicKey()), nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if missing.PublicKey == nil {
+			return "", ErrPassphraseRequired
+		}
+		return ssh.FingerprintSHA256(missing.PublicKey), nil
+	}
+	return "", wrapError(err, "failed to parse private key")
+}
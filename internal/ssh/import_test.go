@@ -0,0 +1,219 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// TestImportKeyPair_Formats tests that OpenSSH, PKCS#1 and PKCS#8 keys are converted to OpenSSH format
+func TestImportKeyPair_Formats(t *testing.T) {
+	generated, err := GenerateKeyPair("", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ecdsa key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecdsaKey)
+	if err != nil {
+		t.Fatalf("failed to marshal pkcs8 key: %v", err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tests := []struct {
+		name       string
+		privateKey []byte
+		wantType   string
+	}{
+		{name: "openssh ed25519", privateKey: generated.PrivateKey, wantType: ssh.KeyAlgoED25519},
+		{name: "pkcs1 rsa", privateKey: pkcs1, wantType: ssh.KeyAlgoRSA},
+		{name: "pkcs8 ecdsa", privateKey: pkcs8, wantType: ssh.KeyAlgoECDSA256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyPair, err := ImportKeyPair(tt.privateKey, nil, "imported@example.com", nil)
+			if err != nil {
+				t.Fatalf("ImportKeyPair failed: %v", err)
+			}
+			if keyPair.KeyType != tt.wantType {
+				t.Errorf("KeyType = %q, want %q", keyPair.KeyType, tt.wantType)
+			}
+			if keyPair.Comment != "imported@example.com" {
+				t.Errorf("Comment = %q, want %q", keyPair.Comment, "imported@example.com")
+			}
+
+			block, _ := pem.Decode(keyPair.PrivateKey)
+			if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+				t.Fatal("imported private key is not in OpenSSH format")
+			}
+			signer, err := ssh.ParsePrivateKey(keyPair.PrivateKey)
+			if err != nil {
+				t.Fatalf("failed to parse imported private key: %v", err)
+			}
+			pubKey, _, _, _, err := ssh.ParseAuthorizedKey(keyPair.PublicKey)
+			if err != nil {
+				t.Fatalf("failed to parse public key: %v", err)
+			}
+			if !bytes.Equal(pubKey.Marshal(), signer.PublicKey().Marshal()) {
+				t.Error("public key doesn't match private key")
+			}
+		})
+	}
+}
+
+// TestImportKeyPair_Encrypted tests decryption and re-encryption of an encrypted key
+func TestImportKeyPair_Encrypted(t *testing.T) {
+	passphrase := []byte("old-passphrase")
+	generated, err := GenerateKeyPair("", passphrase)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	if _, err := ImportKeyPair(generated.PrivateKey, nil, "", nil); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("expected ErrPassphraseRequired, got %v", err)
+	}
+	if _, err := ImportKeyPair(generated.PrivateKey, []byte("wrong"), "", nil); err == nil {
+		t.Fatal("expected error for wrong passphrase, got nil")
+	}
+
+	newPassphrase := []byte("new-passphrase")
+	keyPair, err := ImportKeyPair(generated.PrivateKey, passphrase, "", newPassphrase)
+	if err != nil {
+		t.Fatalf("ImportKeyPair failed: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(keyPair.PrivateKey, passphrase); err == nil {
+		t.Error("imported key should not accept the old passphrase")
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(keyPair.PrivateKey, newPassphrase); err != nil {
+		t.Errorf("failed to parse imported key with new passphrase: %v", err)
+	}
+
+	decrypted, err := ImportKeyPair(generated.PrivateKey, passphrase, "", nil)
+	if err != nil {
+		t.Fatalf("ImportKeyPair failed: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKey(decrypted.PrivateKey); err != nil {
+		t.Errorf("key imported without new passphrase should be unencrypted: %v", err)
+	}
+}
+
+// TestImportKeyPair_Invalid tests that data that is not a private key is rejected
+func TestImportKeyPair_Invalid(t *testing.T) {
+	if _, err := ImportKeyPair([]byte("not a key"), nil, "", nil); err == nil {
+		t.Error("expected error for invalid key, got nil")
+	}
+}
+
+// TestPrivateKeyFingerprint tests that OpenSSH keys are fingerprinted without their passphrase
+func TestPrivateKeyFingerprint(t *testing.T) {
+	for _, passphrase := range [][]byte{nil, []byte("secret")} {
+		keyPair, err := GenerateKeyPair("", passphrase)
+		if err != nil {
+			t.Fatalf("GenerateKeyPair failed: %v", err)
+		}
+		want, err := Fingerprint(keyPair.PublicKey)
+		if err != nil {
+			t.Fatalf("Fingerprint failed: %v", err)
+		}
+
+		got, err := PrivateKeyFingerprint(keyPair.PrivateKey)
+		if err != nil {
+			t.Fatalf("PrivateKeyFingerprint failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("fingerprint = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestIsPrivateKey(t *testing.T) {
+	keyPair, err := GenerateKeyPair("", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	if !IsPrivateKey(keyPair.PrivateKey) {
+		t.Error("generated private key not detected")
+	}
+	if IsPrivateKey(keyPair.PublicKey) {
+		t.Error("public key detected as private key")
+	}
+	if IsPrivateKey([]byte("Host *\n")) {
+		t.Error("ssh config detected as private key")
+	}
+}
+
+// TestPrivateKeyComment tests reading the comment stored in OpenSSH private keys
+func TestPrivateKeyComment(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ecdsa key: %v", err)
+	}
+	marshal := func(key interface{}, comment string) []byte {
+		t.Helper()
+		privateKey, err := MarshalPrivateKey(key, comment, nil)
+		if err != nil {
+			t.Fatalf("MarshalPrivateKey failed: %v", err)
+		}
+		return privateKey
+	}
+	ed25519Key, err := GenerateKeyPair("ed25519@example.com", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		privateKey []byte
+		want       string
+	}{
+		{name: "ed25519", privateKey: ed25519Key.PrivateKey, want: "ed25519@example.com"},
+		{name: "rsa", privateKey: marshal(rsaKey, "rsa@example.com"), want: "rsa@example.com"},
+		{name: "ecdsa", privateKey: marshal(ecdsaKey, "ecdsa@example.com"), want: "ecdsa@example.com"},
+		{name: "no comment", privateKey: marshal(rsaKey, ""), want: ""},
+		{name: "pkcs1", privateKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment, err := PrivateKeyComment(tt.privateKey)
+			if err != nil {
+				t.Fatalf("PrivateKeyComment failed: %v", err)
+			}
+			if comment != tt.want {
+				t.Errorf("PrivateKeyComment() = %q, want %q", comment, tt.want)
+			}
+		})
+	}
+
+	// The comment of an encrypted key is encrypted too
+	encrypted, err := GenerateKeyPair("encrypted@example.com", []byte("secret"))
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	if _, err := PrivateKeyComment(encrypted.PrivateKey); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("PrivateKeyComment() error = %v, want ErrPassphraseRequired", err)
+	}
+}
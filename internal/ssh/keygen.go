@@ -1,9 +1,16 @@
 package ssh
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"encoding/pem"
+	"fmt"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -14,41 +21,206 @@ type KeyPair struct {
 	PublicKey  []byte
 	Comment    string
 	Passphrase *string
+	KeyType    string // SSH key type of the public key, e.g. ssh-ed25519
+
+	// ConfirmBeforeUse asks ssh-agent to confirm each use of the key
+	ConfirmBeforeUse bool
+	// Destinations restricts the hosts the key may be used for (empty means unrestricted)
+	Destinations []DestinationConstraint
+	// Lifetime asks ssh-agent to remove the key after this time (zero keeps it until unloaded)
+	Lifetime time.Duration
 }
 
+// Key types supported by GenerateKeyPairOfType
+const (
+	KeyTypeEd25519 = "ed25519"
+	KeyTypeRSA     = "rsa"
+	KeyTypeECDSA   = "ecdsa"
+)
+
+// RSA key sizes. The default matches ssh-keygen; keys shorter than 2048 bits are rejected as insecure.
+const (
+	DefaultRSABits = 3072
+	MinRSABits     = 2048
+	MaxRSABits     = 16384
+)
+
 // GenerateKeyPair generates a new ed25519 SSH key pair and marshals it to OpenSSH format
 // If passphrase is non-empty, the private key will be encrypted using the provided passphrase
 func GenerateKeyPair(comment string, passphrase []byte) (*KeyPair, error) {
-	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	return GenerateKeyPairOfType(KeyTypeEd25519, 0, comment, passphrase)
+}
+
+// GenerateKeyPairOfType generates a new SSH key pair of the given type and marshals it to OpenSSH format.
+// bits selects the RSA modulus size or the ECDSA curve (256, 384 or 521); 0 uses the default.
+// If passphrase is non-empty, the private key will be encrypted using the provided passphrase
+func GenerateKeyPairOfType(keyType string, bits int, comment string, passphrase []byte) (*KeyPair, error) {
+	privKey, err := generatePrivateKey(keyType, bits)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyPEM, err := MarshalPrivateKey(privKey, comment, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(privKey)
 	if err != nil {
-		return nil, wrapError(err, "failed to generate ed25519 key")
+		return nil, wrapError(err, "failed to convert public key")
+	}
+
+	return &KeyPair{
+		PrivateKey: privateKeyPEM,
+		PublicKey:  ssh.MarshalAuthorizedKey(signer.PublicKey()),
+		Comment:    comment,
+		KeyType:    signer.PublicKey().Type(),
+	}, nil
+}
+
+// ValidateKeyType checks that the key type is supported and bits is a valid size for it (0 for the default)
+func ValidateKeyType(keyType string, bits int) error {
+	switch keyType {
+	case KeyTypeEd25519:
+		if bits != 0 {
+			return fmt.Errorf("ed25519 keys have a fixed size, --bits is not supported")
+		}
+	case KeyTypeRSA:
+		if bits != 0 && (bits < MinRSABits || bits > MaxRSABits) {
+			return fmt.Errorf("invalid RSA key size %d: must be between %d and %d bits", bits, MinRSABits, MaxRSABits)
+		}
+	case KeyTypeECDSA:
+		if bits != 0 && bits != 256 && bits != 384 && bits != 521 {
+			return fmt.Errorf("invalid ECDSA key size %d: must be 256, 384 or 521", bits)
+		}
+	default:
+		return fmt.Errorf("unsupported key type %q: must be %s, %s or %s", keyType, KeyTypeEd25519, KeyTypeRSA, KeyTypeECDSA)
+	}
+	return nil
+}
+
+// generatePrivateKey generates a raw private key of the given type and size
+func generatePrivateKey(keyType string, bits int) (crypto.PrivateKey, error) {
+	if err := ValidateKeyType(keyType, bits); err != nil {
+		return nil, err
+	}
+
+	switch keyType {
+	case KeyTypeRSA:
+		if bits == 0 {
+			bits = DefaultRSABits
+		}
+		privKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, wrapError(err, "failed to generate rsa key")
+		}
+		return privKey, nil
+
+	case KeyTypeECDSA:
+		curve := elliptic.P256()
+		switch bits {
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		}
+		privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, wrapError(err, "failed to generate ecdsa key")
+		}
+		return privKey, nil
+
+	default:
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, wrapError(err, "failed to generate ed25519 key")
+		}
+		return privKey, nil
 	}
+}
 
-	var privateKeyPEM []byte
+// MarshalPrivateKey marshals a private key to PEM encoded OpenSSH format.
+// If passphrase is non-empty, the private key will be encrypted using the provided passphrase
+func MarshalPrivateKey(privKey crypto.PrivateKey, comment string, passphrase []byte) ([]byte, error) {
 	if len(passphrase) > 0 {
 		privateKeyBlock, err := ssh.MarshalPrivateKeyWithPassphrase(privKey, comment, passphrase)
 		if err != nil {
 			return nil, wrapError(err, "failed to marshal private key with passphrase")
 		}
-		privateKeyPEM = pem.EncodeToMemory(privateKeyBlock)
-	} else {
-		privateKeyBlock, err := ssh.MarshalPrivateKey(privKey, comment)
-		if err != nil {
-			return nil, wrapError(err, "failed to marshal private key")
-		}
-		privateKeyPEM = pem.EncodeToMemory(privateKeyBlock)
+		return pem.EncodeToMemory(privateKeyBlock), nil
 	}
 
-	pubKeySSH, err := ssh.NewPublicKey(pubKey)
+	privateKeyBlock, err := ssh.MarshalPrivateKey(privKey, comment)
 	if err != nil {
-		return nil, wrapError(err, "failed to convert public key")
+		return nil, wrapError(err, "failed to marshal private key")
 	}
+	return pem.EncodeToMemory(privateKeyBlock), nil
+}
 
-	publicKeyBytes := ssh.MarshalAuthorizedKey(pubKeySSH)
+// Fingerprint returns the SHA256 fingerprint of an authorized_keys format public key
+func Fingerprint(publicKey []byte) (string, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return "", wrapError(err, "failed to parse public key")
+	}
+	return ssh.FingerprintSHA256(pubKey), nil
+}
 
-	return &KeyPair{
-		PrivateKey: privateKeyPEM,
-		PublicKey:  publicKeyBytes,
-		Comment:    comment,
-	}, nil
+// FingerprintMD5 returns the legacy MD5 fingerprint of an authorized_keys format public key,
+// in the "MD5:xx:xx:..." format of ssh-keygen -E md5
+func FingerprintMD5(publicKey []byte) (string, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return "", wrapError(err, "failed to parse public key")
+	}
+	return "MD5:" + ssh.FingerprintLegacyMD5(pubKey), nil
+}
+
+// AuthorizedKey returns the authorized_keys line of a public key with the given comment.
+// If comment is empty, the comment of the public key is kept.
+func AuthorizedKey(publicKey []byte, comment string) ([]byte, error) {
+	pubKey, existing, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return nil, wrapError(err, "failed to parse public key")
+	}
+	if comment == "" {
+		comment = existing
+	}
+
+	line := bytes.TrimSpace(ssh.MarshalAuthorizedKey(pubKey))
+	if comment != "" {
+		line = append(line, ' ')
+		line = append(line, comment...)
+	}
+	return append(line, '\n'), nil
+}
+
+// ChangePassphrase decrypts the private key of keyPair with keyPair.Passphrase and marshals it to
+// OpenSSH format encrypted with newPassphrase, or unencrypted if newPassphrase is empty
+func ChangePassphrase(keyPair *KeyPair, newPassphrase []byte) ([]byte, error) {
+	return ExportKeyPair(keyPair, FormatOpenSSH, newPassphrase)
+}
+
+// PublicKeyType returns the key type and size to pass to GenerateKeyPairOfType for a key like the
+// given authorized_keys format public key, so a replacement keeps the same algorithm
+func PublicKeyType(publicKey []byte) (keyType string, bits int, err error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return "", 0, wrapError(err, "failed to parse public key")
+	}
+	cryptoKey, ok := pubKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return "", 0, fmt.Errorf("unsupported key type %s", pubKey.Type())
+	}
+
+	switch k := cryptoKey.CryptoPublicKey().(type) {
+	case ed25519.PublicKey:
+		return KeyTypeEd25519, 0, nil
+	case *rsa.PublicKey:
+		return KeyTypeRSA, k.N.BitLen(), nil
+	case *ecdsa.PublicKey:
+		return KeyTypeECDSA, k.Curve.Params().BitSize, nil
+	default:
+		return "", 0, fmt.Errorf("unsupported key type %s", pubKey.Type())
+	}
 }
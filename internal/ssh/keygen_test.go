@@ -1,6 +1,8 @@
 package ssh
 
 import (
+	"bytes"
+	"crypto/rsa"
 	"strings"
 	"testing"
 
@@ -182,3 +184,201 @@ func TestGenerateKeyPair_PubKeyFormat(t *testing.T) {
 		t.Errorf("expected key type ssh-ed25519, got %s", pubKey.Type())
 	}
 }
+
+// TestGenerateKeyPairOfType tests key generation for each supported type and size
+func TestGenerateKeyPairOfType(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyType  string
+		bits     int
+		wantType string
+	}{
+		{name: "ed25519", keyType: KeyTypeEd25519, wantType: ssh.KeyAlgoED25519},
+		{name: "rsa default size", keyType: KeyTypeRSA, wantType: ssh.KeyAlgoRSA},
+		{name: "ecdsa default size", keyType: KeyTypeECDSA, wantType: ssh.KeyAlgoECDSA256},
+		{name: "ecdsa 384", keyType: KeyTypeECDSA, bits: 384, wantType: ssh.KeyAlgoECDSA384},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase := []byte("test-password-123")
+			keyPair, err := GenerateKeyPairOfType(tt.keyType, tt.bits, "test@example.com", passphrase)
+			if err != nil {
+				t.Fatalf("GenerateKeyPairOfType failed: %v", err)
+			}
+
+			if keyPair.KeyType != tt.wantType {
+				t.Errorf("KeyType = %q, want %q", keyPair.KeyType, tt.wantType)
+			}
+			if !strings.HasPrefix(string(keyPair.PublicKey), tt.wantType+" ") {
+				t.Errorf("public key doesn't start with %s: %s", tt.wantType, keyPair.PublicKey)
+			}
+
+			// The private key is OpenSSH-formatted and encrypted with the passphrase
+			if !strings.Contains(string(keyPair.PrivateKey), "OPENSSH PRIVATE KEY") {
+				t.Error("private key is not in OpenSSH format")
+			}
+			if _, err := ssh.ParsePrivateKey(keyPair.PrivateKey); err == nil {
+				t.Error("private key should require passphrase but didn't")
+			}
+			signer, err := ssh.ParsePrivateKeyWithPassphrase(keyPair.PrivateKey, passphrase)
+			if err != nil {
+				t.Fatalf("failed to parse private key with passphrase: %v", err)
+			}
+			pubKey, _, _, _, err := ssh.ParseAuthorizedKey(keyPair.PublicKey)
+			if err != nil {
+				t.Fatalf("failed to parse public key: %v", err)
+			}
+			if !bytes.Equal(pubKey.Marshal(), signer.PublicKey().Marshal()) {
+				t.Error("public key doesn't match private key")
+			}
+		})
+	}
+}
+
+// TestGenerateKeyPairOfType_RSABits tests that the requested RSA key size is used
+func TestGenerateKeyPairOfType_RSABits(t *testing.T) {
+	keyPair, err := GenerateKeyPairOfType(KeyTypeRSA, 2048, "", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPairOfType failed: %v", err)
+	}
+
+	privateKey, err := ssh.ParseRawPrivateKey(keyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		t.Fatalf("expected *rsa.PrivateKey, got %T", privateKey)
+	}
+	if rsaKey.N.BitLen() != 2048 {
+		t.Errorf("key size = %d, want 2048", rsaKey.N.BitLen())
+	}
+}
+
+// TestValidateKeyType tests rejection of unsupported types and sizes
+func TestValidateKeyType(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyType     string
+		bits        int
+		expectError bool
+	}{
+		{name: "ed25519", keyType: KeyTypeEd25519},
+		{name: "ed25519 with bits", keyType: KeyTypeEd25519, bits: 256, expectError: true},
+		{name: "rsa 4096", keyType: KeyTypeRSA, bits: 4096},
+		{name: "rsa too small", keyType: KeyTypeRSA, bits: 1024, expectError: true},
+		{name: "rsa too large", keyType: KeyTypeRSA, bits: 32768, expectError: true},
+		{name: "ecdsa 521", keyType: KeyTypeECDSA, bits: 521},
+		{name: "ecdsa invalid curve", keyType: KeyTypeECDSA, bits: 512, expectError: true},
+		{name: "dsa", keyType: "dsa", expectError: true},
+		{name: "empty", keyType: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateKeyType(tt.keyType, tt.bits)
+			if tt.expectError && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestChangePassphrase tests re-encrypting and decrypting a key without changing it
+func TestChangePassphrase(t *testing.T) {
+	oldPassphrase := "old-passphrase"
+	keyPair, err := GenerateKeyPair("test@example.com", []byte(oldPassphrase))
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	if _, err := ChangePassphrase(keyPair, []byte("new-passphrase")); err == nil {
+		t.Error("expected error without the old passphrase, got nil")
+	}
+
+	keyPair.Passphrase = &oldPassphrase
+	privateKey, err := ChangePassphrase(keyPair, []byte("new-passphrase"))
+	if err != nil {
+		t.Fatalf("ChangePassphrase failed: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(oldPassphrase)); err == nil {
+		t.Error("old passphrase should no longer work")
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte("new-passphrase"))
+	if err != nil {
+		t.Fatalf("failed to parse key with new passphrase: %v", err)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(keyPair.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+	if !bytes.Equal(pubKey.Marshal(), signer.PublicKey().Marshal()) {
+		t.Error("key changed along with the passphrase")
+	}
+
+	unencrypted, err := ChangePassphrase(keyPair, nil)
+	if err != nil {
+		t.Fatalf("ChangePassphrase failed: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKey(unencrypted); err != nil {
+		t.Errorf("key should be unencrypted: %v", err)
+	}
+}
+
+// TestPublicKeyType tests that the type and size of generated keys are recovered from the public key
+func TestPublicKeyType(t *testing.T) {
+	tests := []struct {
+		keyType string
+		bits    int
+	}{
+		{KeyTypeEd25519, 0},
+		{KeyTypeRSA, 2048},
+		{KeyTypeECDSA, 384},
+	}
+
+	for _, tt := range tests {
+		keyPair, err := GenerateKeyPairOfType(tt.keyType, tt.bits, "", nil)
+		if err != nil {
+			t.Fatalf("GenerateKeyPairOfType failed: %v", err)
+		}
+		keyType, bits, err := PublicKeyType(keyPair.PublicKey)
+		if err != nil || keyType != tt.keyType || bits != tt.bits {
+			t.Errorf("PublicKeyType = %q, %d, %v, want %q, %d", keyType, bits, err, tt.keyType, tt.bits)
+		}
+	}
+
+	if _, _, err := PublicKeyType([]byte("not a key")); err == nil {
+		t.Error("expected error for invalid public key, got nil")
+	}
+}
+
+// TestAuthorizedKey tests adding comments to public keys and MD5 fingerprints
+func TestAuthorizedKey(t *testing.T) {
+	keyPair, err := GenerateKeyPair("", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	line, err := AuthorizedKey(keyPair.PublicKey, "user@example.com")
+	if err != nil {
+		t.Fatalf("AuthorizedKey failed: %v", err)
+	}
+	if want := strings.TrimSpace(string(keyPair.PublicKey)) + " user@example.com\n"; string(line) != want {
+		t.Errorf("AuthorizedKey = %q, want %q", line, want)
+	}
+	if kept, _ := AuthorizedKey(line, ""); !bytes.Equal(kept, line) {
+		t.Errorf("AuthorizedKey without comment = %q, want the existing comment kept", kept)
+	}
+	if _, err := AuthorizedKey([]byte("garbage"), ""); err == nil {
+		t.Error("expected error for invalid public key, got nil")
+	}
+
+	md5, err := FingerprintMD5(keyPair.PublicKey)
+	if err != nil || !strings.HasPrefix(md5, "MD5:") || strings.Count(md5, ":") != 16 {
+		t.Errorf("FingerprintMD5 = %q, %v, want MD5: followed by 16 hex pairs", md5, err)
+	}
+}
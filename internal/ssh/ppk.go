@@ -0,0 +1,127 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// Argon2id parameters for encrypted PuTTY keys, matching puttygen's defaults
+const (
+	ppkArgon2Memory      = 8192 // KiB
+	ppkArgon2Passes      = 13
+	ppkArgon2Parallelism = 1
+	ppkArgon2SaltSize    = 16
+)
+
+// ppkPrivateBlob encodes the private part of a key the way PuTTY stores it
+func ppkPrivateBlob(privKey interface{}) ([]byte, error) {
+	switch k := privKey.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, fmt.Errorf("multi-prime RSA keys are not supported by PuTTY")
+		}
+		p, q := k.Primes[0], k.Primes[1]
+		return ssh.Marshal(struct {
+			D, P, Q, Iqmp *big.Int
+		}{k.D, p, q, new(big.Int).ModInverse(q, p)}), nil
+	case *ecdsa.PrivateKey:
+		return ssh.Marshal(struct{ D *big.Int }{k.D}), nil
+	case ed25519.PrivateKey:
+		return ssh.Marshal(struct{ Seed []byte }{k.Seed()}), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", privKey)
+	}
+}
+
+// writePPKLines writes base64 data wrapped at 64 characters, preceded by its line count
+func writePPKLines(buf *bytes.Buffer, header string, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	lines := (len(encoded) + 63) / 64
+	fmt.Fprintf(buf, "%s: %d\n", header, lines)
+	for i := 0; i < len(encoded); i += 64 {
+		end := min(i+64, len(encoded))
+		fmt.Fprintf(buf, "%s\n", encoded[i:end])
+	}
+}
+
+// marshalPPK encodes a private key in PuTTY's PPK version 3 format. If passphrase is non-empty,
+// the private part is encrypted with AES-256-CBC using a key derived with Argon2id.
+func marshalPPK(privKey interface{}, comment string, passphrase []byte) ([]byte, error) {
+	signer, err := ssh.NewSignerFromKey(privKey)
+	if err != nil {
+		return nil, wrapError(err, "failed to create signer from private key")
+	}
+	algorithm := signer.PublicKey().Type()
+	publicBlob := signer.PublicKey().Marshal()
+
+	privateBlob, err := ppkPrivateBlob(privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encryption := "none"
+	var salt []byte
+	var cipherKey, iv, macKey []byte
+	if len(passphrase) > 0 {
+		encryption = "aes256-cbc"
+
+		// Pad to the cipher block size with a hash of the unpadded blob, as PuTTY does
+		if rem := len(privateBlob) % aes.BlockSize; rem != 0 {
+			digest := sha1.Sum(privateBlob)
+			privateBlob = append(privateBlob, digest[:aes.BlockSize-rem]...)
+		}
+
+		salt = make([]byte, ppkArgon2SaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, wrapError(err, "failed to generate salt")
+		}
+		derived := argon2.IDKey(passphrase, salt, ppkArgon2Passes, ppkArgon2Memory, ppkArgon2Parallelism, 80)
+		cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+	}
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(ssh.Marshal(struct {
+		Algorithm, Encryption, Comment string
+		PublicBlob, PrivateBlob        []byte
+	}{algorithm, encryption, comment, publicBlob, privateBlob}))
+
+	if len(passphrase) > 0 {
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, wrapError(err, "failed to create cipher")
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(privateBlob, privateBlob)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "PuTTY-User-Key-File-3: %s\n", algorithm)
+	fmt.Fprintf(&buf, "Encryption: %s\n", encryption)
+	fmt.Fprintf(&buf, "Comment: %s\n", comment)
+	writePPKLines(&buf, "Public-Lines", publicBlob)
+	if len(passphrase) > 0 {
+		fmt.Fprintf(&buf, "Key-Derivation: Argon2id\n")
+		fmt.Fprintf(&buf, "Argon2-Memory: %d\n", ppkArgon2Memory)
+		fmt.Fprintf(&buf, "Argon2-Passes: %d\n", ppkArgon2Passes)
+		fmt.Fprintf(&buf, "Argon2-Parallelism: %d\n", ppkArgon2Parallelism)
+		fmt.Fprintf(&buf, "Argon2-Salt: %s\n", hex.EncodeToString(salt))
+	}
+	writePPKLines(&buf, "Private-Lines", privateBlob)
+	fmt.Fprintf(&buf, "Private-MAC: %s\n", hex.EncodeToString(mac.Sum(nil)))
+
+	return buf.Bytes(), nil
+}
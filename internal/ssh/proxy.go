@@ -0,0 +1,234 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrProxyForbidden is returned for operations the proxy does not forward to the upstream agent
+var ErrProxyForbidden = errors.New("operation not permitted through sm-ssh-add proxy")
+
+// sessionBindExtension is sent by ssh clients so agents can enforce destination constraints
+const sessionBindExtension = "session-bind@openssh.com"
+
+// Proxy is an ssh-agent that forwards to an upstream agent. It only exposes the allowed keys,
+// refuses to modify the upstream agent and writes an audit line for every signature request.
+// Every client connection gets its own upstream connection, so session bindings of different
+// clients don't accumulate on one connection and a restarted upstream agent only affects the
+// clients connected at the time.
+type Proxy struct {
+	dial    func() (*Agent, error)
+	allowed map[string]string // SHA256 fingerprint to secret manager path
+	now     func() time.Time
+
+	logMu sync.Mutex
+	log   io.Writer
+
+	mu             sync.Mutex
+	locked         bool // set by Lock; clients can unlock but not lock the proxy
+	lockPassphrase []byte
+	lastUsed       time.Time
+}
+
+// NewProxy creates a Proxy in front of the agents returned by dial. allowed maps the SHA256
+// fingerprints of the exposed keys to their secret manager paths; audit lines go to log.
+func NewProxy(dial func() (*Agent, error), allowed map[string]string, log io.Writer) *Proxy {
+	return &Proxy{
+		dial:     dial,
+		allowed:  allowed,
+		now:      time.Now,
+		log:      log,
+		lastUsed: time.Now(),
+	}
+}
+
+// Lock hides the keys of the proxy from all clients until a client unlocks it with passphrase.
+// The upstream agent is not locked.
+func (p *Proxy) Lock(passphrase []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.locked {
+		return ErrAgentLocked
+	}
+	p.locked = true
+	p.lockPassphrase = bytes.Clone(passphrase)
+	return nil
+}
+
+// LastUsed returns when a signature was last requested or the proxy was last unlocked
+func (p *Proxy) LastUsed() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastUsed
+}
+
+// isLocked reports whether the proxy is locked, recording a use if used is set and it is not
+func (p *Proxy) isLocked(used bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.locked && used {
+		p.lastUsed = p.now()
+	}
+	return p.locked
+}
+
+// ServeConn serves a client connection through a new upstream connection, which is closed when
+// the client disconnects
+func (p *Proxy) ServeConn(conn io.ReadWriter) error {
+	upstream, err := p.dial()
+	if err != nil {
+		p.logf("connect failed error=%q", err)
+		return err
+	}
+	defer upstream.Close()
+
+	return agent.ServeAgent(&proxySession{Proxy: p, upstream: upstream.client}, conn)
+}
+
+// proxySession is the agent served to one client connection
+type proxySession struct {
+	*Proxy
+	upstream agent.ExtendedAgent
+}
+
+// logf writes a timestamped line to the audit log
+func (p *Proxy) logf(format string, args ...interface{}) {
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+
+	fmt.Fprintf(p.log, "%s %s\n", p.now().UTC().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// audit writes a log line for a signature request
+func (p *Proxy) audit(result, path, fingerprint string) {
+	if path == "" {
+		path = "-"
+	}
+	p.logf("sign %s path=%s fingerprint=%s", result, path, fingerprint)
+}
+
+// List returns the upstream keys that are allowed through the proxy
+func (s *proxySession) List() ([]*agent.Key, error) {
+	if s.isLocked(false) {
+		// Like ssh-agent, a locked proxy reports no keys
+		return nil, nil
+	}
+
+	keys, err := s.upstream.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []*agent.Key
+	for _, key := range keys {
+		if _, ok := s.allowed[ssh.FingerprintSHA256(key)]; ok {
+			allowed = append(allowed, key)
+		}
+	}
+	return allowed, nil
+}
+
+// Sign forwards a signature request for an allowed key to the upstream agent
+func (s *proxySession) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return s.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags forwards a signature request for an allowed key to the upstream agent
+func (s *proxySession) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	fingerprint := ssh.FingerprintSHA256(key)
+	path, ok := s.allowed[fingerprint]
+	if !ok {
+		s.audit("denied", "", fingerprint)
+		return nil, ErrKeyNotFound
+	}
+	if s.isLocked(true) {
+		s.audit("locked", path, fingerprint)
+		return nil, ErrAgentLocked
+	}
+
+	sig, err := s.upstream.SignWithFlags(key, data, flags)
+	if err != nil {
+		s.audit("failed", path, fingerprint)
+		return nil, err
+	}
+
+	s.audit("allowed", path, fingerprint)
+	return sig, nil
+}
+
+// Signers returns signers for the allowed upstream keys
+func (s *proxySession) Signers() ([]ssh.Signer, error) {
+	if s.isLocked(false) {
+		return nil, ErrAgentLocked
+	}
+
+	signers, err := s.upstream.Signers()
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []ssh.Signer
+	for _, signer := range signers {
+		if _, ok := s.allowed[ssh.FingerprintSHA256(signer.PublicKey())]; ok {
+			allowed = append(allowed, signer)
+		}
+	}
+	return allowed, nil
+}
+
+// Add is not forwarded
+func (s *proxySession) Add(key agent.AddedKey) error {
+	return ErrProxyForbidden
+}
+
+// Remove is not forwarded
+func (s *proxySession) Remove(key ssh.PublicKey) error {
+	return ErrProxyForbidden
+}
+
+// RemoveAll is not forwarded
+func (s *proxySession) RemoveAll() error {
+	return ErrProxyForbidden
+}
+
+// Lock is not forwarded
+func (s *proxySession) Lock(passphrase []byte) error {
+	return ErrProxyForbidden
+}
+
+// Unlock is not forwarded, but unlocks a proxy locked by Proxy.Lock if the passphrase matches
+func (s *proxySession) Unlock(passphrase []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.locked {
+		return ErrProxyForbidden
+	}
+	if subtle.ConstantTimeCompare(passphrase, s.lockPassphrase) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+	s.locked = false
+	clear(s.lockPassphrase)
+	s.lockPassphrase = nil
+	s.lastUsed = s.now()
+	return nil
+}
+
+// Extension forwards session binding, which the upstream agent needs to enforce destination
+// constraints. Other extensions are not forwarded.
+func (s *proxySession) Extension(extensionType string, contents []byte) ([]byte, error) {
+	if extensionType != sessionBindExtension {
+		return nil, agent.ErrExtensionUnsupported
+	}
+	return s.upstream.Extension(extensionType, contents)
+}
@@ -0,0 +1,293 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// bindingAgent is one upstream agent connection. Like ssh-agent, which limits the session
+// bindings of a connection, it refuses to bind a connection twice.
+type bindingAgent struct {
+	agent.ExtendedAgent
+	mu    sync.Mutex
+	binds int
+}
+
+func (b *bindingAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	if extensionType != sessionBindExtension {
+		return nil, agent.ErrExtensionUnsupported
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.binds > 0 {
+		return nil, errors.New("connection is already bound")
+	}
+	b.binds++
+	return nil, nil
+}
+
+// testUpstream is an in-process upstream agent that serves every dialed connection separately
+type testUpstream struct {
+	keyring agent.ExtendedAgent
+	closed  chan struct{} // receives when an upstream connection is closed
+
+	mu    sync.Mutex
+	conns []*bindingAgent
+}
+
+func newTestUpstream() *testUpstream {
+	return &testUpstream{
+		keyring: agent.NewKeyring().(agent.ExtendedAgent),
+		closed:  make(chan struct{}, 16),
+	}
+}
+
+func (u *testUpstream) dial() (*Agent, error) {
+	conn := &bindingAgent{ExtendedAgent: u.keyring}
+	u.mu.Lock()
+	u.conns = append(u.conns, conn)
+	u.mu.Unlock()
+
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		_ = agent.ServeAgent(conn, serverConn)
+		serverConn.Close()
+		u.closed <- struct{}{}
+	}()
+	return &Agent{client: agent.NewClient(clientConn), conn: clientConn}, nil
+}
+
+// connectProxy returns a client connected to the proxy over an in-process connection
+func connectProxy(t *testing.T, proxy *Proxy) agent.ExtendedAgent {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		_ = proxy.ServeConn(serverConn)
+		serverConn.Close()
+	}()
+	t.Cleanup(func() { clientConn.Close() })
+	return agent.NewClient(clientConn)
+}
+
+// newTestProxy returns a client of a proxy in front of an in-process agent holding an allowed
+// and a hidden key, along with the public keys and the audit log
+func newTestProxy(t *testing.T) (agent.ExtendedAgent, ssh.PublicKey, ssh.PublicKey, *syncBuffer) {
+	t.Helper()
+	upstream := newTestUpstream()
+
+	var pubKeys []ssh.PublicKey
+	for _, comment := range []string{"allowed@test", "hidden@test"} {
+		keyPair, err := GenerateKeyPair(comment, nil)
+		if err != nil {
+			t.Fatalf("GenerateKeyPair failed: %v", err)
+		}
+		privateKey, err := ssh.ParseRawPrivateKey(keyPair.PrivateKey)
+		if err != nil {
+			t.Fatalf("failed to parse private key: %v", err)
+		}
+		if err := upstream.keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey(keyPair.PublicKey)
+		if err != nil {
+			t.Fatalf("failed to parse public key: %v", err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	auditLog := &syncBuffer{}
+	proxy := NewProxy(upstream.dial, map[string]string{
+		ssh.FingerprintSHA256(pubKeys[0]): "secret/ssh/allowed",
+	}, auditLog)
+	proxy.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	return connectProxy(t, proxy), pubKeys[0], pubKeys[1], auditLog
+}
+
+func TestProxy_ListOnlyAllowedKeys(t *testing.T) {
+	client, allowed, _, _ := newTestProxy(t)
+
+	keys, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 key through proxy, got %d", len(keys))
+	}
+	if !bytes.Equal(keys[0].Marshal(), allowed.Marshal()) {
+		t.Error("proxy listed the wrong key")
+	}
+}
+
+func TestProxy_SignIsFilteredAndAudited(t *testing.T) {
+	client, allowed, hidden, auditLog := newTestProxy(t)
+
+	data := []byte("data to sign")
+	sig, err := client.Sign(allowed, data)
+	if err != nil {
+		t.Fatalf("Sign with allowed key failed: %v", err)
+	}
+	if err := allowed.Verify(data, sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	if _, err := client.Sign(hidden, data); err == nil {
+		t.Error("Sign with hidden key should fail")
+	}
+
+	lines := strings.Split(strings.TrimSpace(auditLog.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit lines, got %d: %q", len(lines), auditLog.String())
+	}
+	wantAllowed := "2026-01-02T03:04:05Z sign allowed path=secret/ssh/allowed fingerprint=" + ssh.FingerprintSHA256(allowed)
+	if lines[0] != wantAllowed {
+		t.Errorf("audit line = %q, want %q", lines[0], wantAllowed)
+	}
+	wantDenied := "2026-01-02T03:04:05Z sign denied path=- fingerprint=" + ssh.FingerprintSHA256(hidden)
+	if lines[1] != wantDenied {
+		t.Errorf("audit line = %q, want %q", lines[1], wantDenied)
+	}
+}
+
+func TestProxy_RejectsModifications(t *testing.T) {
+	client, allowed, _, _ := newTestProxy(t)
+
+	if err := client.Remove(allowed); err == nil {
+		t.Error("Remove through proxy should fail")
+	}
+	if err := client.RemoveAll(); err == nil {
+		t.Error("RemoveAll through proxy should fail")
+	}
+	if err := client.Lock([]byte("secret")); err == nil {
+		t.Error("Lock through proxy should fail")
+	}
+
+	// The upstream key is still usable
+	keys, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("expected 1 key after rejected modifications, got %d", len(keys))
+	}
+}
+
+func TestProxy_LockHidesKeysUntilUnlocked(t *testing.T) {
+	upstream := newTestUpstream()
+	keyPair, err := GenerateKeyPair("allowed@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	privateKey, err := ssh.ParseRawPrivateKey(keyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+	if err := upstream.keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	pubKey, _, _, _, _ := ssh.ParseAuthorizedKey(keyPair.PublicKey)
+	proxy := NewProxy(upstream.dial, map[string]string{ssh.FingerprintSHA256(pubKey): "secret/ssh/allowed"}, &syncBuffer{})
+	client := connectProxy(t, proxy)
+
+	if err := proxy.Lock([]byte("secret")); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if keys, _ := client.List(); len(keys) != 0 {
+		t.Errorf("locked proxy listed %d keys, want 0", len(keys))
+	}
+	if _, err := client.Sign(pubKey, []byte("data")); err == nil {
+		t.Error("Sign through locked proxy should fail")
+	}
+	if err := client.Unlock([]byte("wrong")); err == nil {
+		t.Error("Unlock with wrong passphrase should fail")
+	}
+	if err := client.Unlock([]byte("secret")); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if _, err := client.Sign(pubKey, []byte("data")); err != nil {
+		t.Errorf("Sign after unlock failed: %v", err)
+	}
+
+	// Clients can only unlock a locked proxy
+	if err := client.Unlock([]byte("secret")); err == nil {
+		t.Error("Unlock of an unlocked proxy should fail")
+	}
+}
+
+func TestProxy_ConnectsUpstreamPerClient(t *testing.T) {
+	upstream := newTestUpstream()
+	proxy := NewProxy(upstream.dial, map[string]string{}, &syncBuffer{})
+
+	// Both clients bind their session at the same time; sharing one upstream connection would
+	// bind it twice
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	clients := make([]net.Conn, 2)
+	for i := range clients {
+		clientConn, serverConn := net.Pipe()
+		clients[i] = clientConn
+		go func() {
+			_ = proxy.ServeConn(serverConn)
+			serverConn.Close()
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := agent.NewClient(clientConn).Extension(sessionBindExtension, []byte("session"))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("session-bind through proxy failed: %v", err)
+		}
+	}
+
+	upstream.mu.Lock()
+	conns := len(upstream.conns)
+	upstream.mu.Unlock()
+	if conns != 2 {
+		t.Errorf("upstream connections = %d, want one per client", conns)
+	}
+
+	// Disconnecting a client closes its upstream connection
+	for _, conn := range clients {
+		conn.Close()
+	}
+	for range clients {
+		select {
+		case <-upstream.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("upstream connection was not closed after its client disconnected")
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// RestrictDestinationExtension is the OpenSSH agent constraint that limits the hosts a key may be used for
+const RestrictDestinationExtension = "restrict-destination-v00@openssh.com"
+
+// DestinationHop is one end of a destination constraint.
+// A hop with an empty Hostname stands for the local host.
+type DestinationHop struct {
+	User     string
+	Hostname string
+	HostKeys []ssh.PublicKey
+}
+
+// DestinationConstraint permits use of a key on a connection from one hop to another
+type DestinationConstraint struct {
+	From DestinationHop
+	To   DestinationHop
+}
+
+// appendString appends data as an SSH wire format string (uint32 length followed by the bytes)
+func appendString(buf []byte, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	return append(buf, data...)
+}
+
+// marshal encodes the hop as described in OpenSSH PROTOCOL.agent
+func (h DestinationHop) marshal() []byte {
+	var buf []byte
+	buf = appendString(buf, []byte(h.User))
+	buf = appendString(buf, []byte(h.Hostname))
+	buf = appendString(buf, nil) // reserved
+	for _, key := range h.HostKeys {
+		buf = appendString(buf, key.Marshal())
+		buf = append(buf, 0) // is_ca: known_hosts lookups only return plain host keys
+	}
+	return buf
+}
+
+// marshal encodes the constraint as described in OpenSSH PROTOCOL.agent
+func (c DestinationConstraint) marshal() []byte {
+	var buf []byte
+	buf = appendString(buf, c.From.marshal())
+	buf = appendString(buf, c.To.marshal())
+	buf = appendString(buf, nil) // reserved
+	return buf
+}
+
+// destinationConstraintExtension encodes the constraints into a restrict-destination agent extension
+func destinationConstraintExtension(constraints []DestinationConstraint) agent.ConstraintExtension {
+	var details []byte
+	for _, c := range constraints {
+		details = appendString(details, c.marshal())
+	}
+	return agent.ConstraintExtension{
+		ExtensionName:    RestrictDestinationExtension,
+		ExtensionDetails: details,
+	}
+}
+
+// DefaultKnownHostsFiles returns the user and system known_hosts files that exist on this machine
+func DefaultKnownHostsFiles() []string {
+	var candidates []string
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".ssh", "known_hosts"))
+	}
+	candidates = append(candidates, "/etc/ssh/ssh_known_hosts")
+
+	var files []string
+	for _, file := range candidates {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// splitHostPort splits "host", "host:port" or "[host]:port" into the host and its SSH port,
+// which defaults to 22. A bare IPv6 address is a host without a port.
+func splitHostPort(hostPort string) (string, int, error) {
+	if !strings.HasPrefix(hostPort, "[") && strings.Count(hostPort, ":") != 1 {
+		return hostPort, 22, nil
+	}
+	if strings.HasPrefix(hostPort, "[") && strings.HasSuffix(hostPort, "]") {
+		return hostPort[1 : len(hostPort)-1], 22, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", portStr)
+	}
+	return host, port, nil
+}
+
+// ParseDestinations builds destination constraints from "[user@]host[:port]" specs, with IPv6
+// hosts written as "[host]:port", allowing use of the key from the local host to each
+// destination. The host keys of every destination are looked up in the given known_hosts files,
+// as ssh-agent identifies destinations by their host keys.
+func ParseDestinations(specs []string, knownHostsFiles []string) ([]DestinationConstraint, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	if len(knownHostsFiles) == 0 {
+		return nil, fmt.Errorf("no known_hosts file found to look up destination host keys")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHostsFiles...)
+	if err != nil {
+		return nil, wrapError(err, "failed to read known_hosts")
+	}
+
+	// knownhosts only reports the accepted keys for a host when checking a key that does not match,
+	// so probe each host with a throwaway key
+	probePub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, wrapError(err, "failed to generate probe key")
+	}
+	probeKey, err := ssh.NewPublicKey(probePub)
+	if err != nil {
+		return nil, wrapError(err, "failed to convert probe key")
+	}
+
+	constraints := make([]DestinationConstraint, 0, len(specs))
+	for _, spec := range specs {
+		user, hostPort := "", spec
+		if i := strings.LastIndex(spec, "@"); i >= 0 {
+			user, hostPort = spec[:i], spec[i+1:]
+		}
+		host, port, err := splitHostPort(hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q: %w", spec, err)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("invalid destination %q: host is required", spec)
+		}
+
+		// knownhosts looks up hosts on other ports than 22 as [host]:port
+		err = hostKeyCallback(net.JoinHostPort(host, strconv.Itoa(port)), &net.TCPAddr{IP: net.IPv4zero, Port: port}, probeKey)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("no host keys found for %s in known_hosts", hostPort)
+		}
+
+		hostKeys := make([]ssh.PublicKey, 0, len(keyErr.Want))
+		for _, known := range keyErr.Want {
+			hostKeys = append(hostKeys, known.Key)
+		}
+
+		constraints = append(constraints, DestinationConstraint{
+			To: DestinationHop{User: user, Hostname: host, HostKeys: hostKeys},
+		})
+	}
+
+	return constraints, nil
+}
@@ -0,0 +1,202 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// readString reads an SSH wire format string and returns it with the remaining bytes
+func readString(t *testing.T, buf []byte) ([]byte, []byte) {
+	t.Helper()
+	if len(buf) < 4 {
+		t.Fatalf("buffer too short for string length: %d bytes", len(buf))
+	}
+	n := binary.BigEndian.Uint32(buf)
+	if uint32(len(buf)-4) < n {
+		t.Fatalf("buffer too short for string of length %d", n)
+	}
+	return buf[4 : 4+n], buf[4+n:]
+}
+
+// newHostKey returns a random ed25519 public key to use as a host key
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to convert host key: %v", err)
+	}
+	return key
+}
+
+// writeKnownHosts writes a known_hosts file mapping each host to its key
+func writeKnownHosts(t *testing.T, hosts map[string]ssh.PublicKey) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for host, key := range hosts {
+		buf.WriteString(host + " ")
+		buf.Write(ssh.MarshalAuthorizedKey(key))
+	}
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(file, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+	return file
+}
+
+func TestParseDestinations(t *testing.T) {
+	hostKey := newHostKey(t)
+	knownHosts := writeKnownHosts(t, map[string]ssh.PublicKey{"bastion.example.com": hostKey})
+
+	constraints, err := ParseDestinations([]string{"deploy@bastion.example.com"}, []string{knownHosts})
+	if err != nil {
+		t.Fatalf("ParseDestinations failed: %v", err)
+	}
+	if len(constraints) != 1 {
+		t.Fatalf("expected 1 constraint, got %d", len(constraints))
+	}
+
+	c := constraints[0]
+	if c.From.Hostname != "" || len(c.From.HostKeys) != 0 {
+		t.Errorf("From hop should be the local host, got %+v", c.From)
+	}
+	if c.To.User != "deploy" || c.To.Hostname != "bastion.example.com" {
+		t.Errorf("To hop = %s@%s, want deploy@bastion.example.com", c.To.User, c.To.Hostname)
+	}
+	if len(c.To.HostKeys) != 1 || !bytes.Equal(c.To.HostKeys[0].Marshal(), hostKey.Marshal()) {
+		t.Error("To hop should carry the host key from known_hosts")
+	}
+}
+
+func TestParseDestinations_Ports(t *testing.T) {
+	hostKey, otherKey := newHostKey(t), newHostKey(t)
+	knownHosts := writeKnownHosts(t, map[string]ssh.PublicKey{
+		"[bastion.example.com]:2222": hostKey,
+		"bastion.example.com":        otherKey,
+		"[2001:db8::1]:2200":         hostKey,
+	})
+
+	tests := []struct {
+		spec string
+		host string
+	}{
+		{spec: "deploy@bastion.example.com:2222", host: "bastion.example.com"},
+		{spec: "[bastion.example.com]:2222", host: "bastion.example.com"},
+		{spec: "[2001:db8::1]:2200", host: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		constraints, err := ParseDestinations([]string{tt.spec}, []string{knownHosts})
+		if err != nil {
+			t.Fatalf("ParseDestinations(%q) failed: %v", tt.spec, err)
+		}
+		to := constraints[0].To
+		if to.Hostname != tt.host {
+			t.Errorf("ParseDestinations(%q) hostname = %q, want %q", tt.spec, to.Hostname, tt.host)
+		}
+		// The key of the non-22 port is used, not that of port 22
+		if len(to.HostKeys) != 1 || !bytes.Equal(to.HostKeys[0].Marshal(), hostKey.Marshal()) {
+			t.Errorf("ParseDestinations(%q) should carry the host key of its port", tt.spec)
+		}
+	}
+
+	if _, err := ParseDestinations([]string{"bastion.example.com:2200"}, []string{knownHosts}); err == nil {
+		t.Error("expected error for a port without known host keys, got nil")
+	}
+}
+
+func TestParseDestinations_Errors(t *testing.T) {
+	knownHosts := writeKnownHosts(t, map[string]ssh.PublicKey{"known.example.com": newHostKey(t)})
+
+	tests := []struct {
+		name  string
+		specs []string
+		files []string
+	}{
+		{name: "unknown host", specs: []string{"unknown.example.com"}, files: []string{knownHosts}},
+		{name: "empty host", specs: []string{"user@"}, files: []string{knownHosts}},
+		{name: "no known_hosts files", specs: []string{"known.example.com"}, files: nil},
+		{name: "invalid port", specs: []string{"known.example.com:ssh"}, files: []string{knownHosts}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDestinations(tt.specs, tt.files); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestAddKey_RestrictDestination(t *testing.T) {
+	a, keyring := newTestAgent(t)
+
+	hostKey := newHostKey(t)
+	keyPair, err := GenerateKeyPair("restrict@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	keyPair.Destinations = []DestinationConstraint{
+		{To: DestinationHop{Hostname: "github.com", HostKeys: []ssh.PublicKey{hostKey}}},
+	}
+
+	if err := a.AddKey(keyPair); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	added := keyring.lastAdded(t)
+	if len(added.ConstraintExtensions) != 1 {
+		t.Fatalf("expected 1 constraint extension, got %d", len(added.ConstraintExtensions))
+	}
+	ext := added.ConstraintExtensions[0]
+	if ext.ExtensionName != RestrictDestinationExtension {
+		t.Errorf("ExtensionName = %q, want %q", ext.ExtensionName, RestrictDestinationExtension)
+	}
+
+	// Decode the constraint as ssh-agent would: constraint { from hop, to hop, reserved }
+	constraint, rest := readString(t, ext.ExtensionDetails)
+	if len(rest) != 0 {
+		t.Errorf("unexpected %d trailing bytes after constraint", len(rest))
+	}
+	from, constraint := readString(t, constraint)
+	to, constraint := readString(t, constraint)
+	if _, constraint = readString(t, constraint); len(constraint) != 0 {
+		t.Errorf("unexpected %d trailing bytes after reserved field", len(constraint))
+	}
+
+	// From hop: empty user, empty hostname, reserved, no keys
+	user, from := readString(t, from)
+	hostname, from := readString(t, from)
+	if _, from = readString(t, from); len(user) != 0 || len(hostname) != 0 || len(from) != 0 {
+		t.Errorf("from hop should be empty, got user=%q host=%q extra=%d", user, hostname, len(from))
+	}
+
+	// To hop: user, hostname, reserved, then (key, is_ca) pairs
+	_, to = readString(t, to)
+	hostname, to = readString(t, to)
+	if string(hostname) != "github.com" {
+		t.Errorf("to hostname = %q, want github.com", hostname)
+	}
+	_, to = readString(t, to)
+	keyBlob, to := readString(t, to)
+	if !bytes.Equal(keyBlob, hostKey.Marshal()) {
+		t.Error("to hop host key does not match")
+	}
+	if len(to) != 1 || to[0] != 0 {
+		t.Errorf("expected is_ca=false after host key, got %v", to)
+	}
+
+	// Restricting an already loaded key re-adds it instead of reporting a duplicate
+	if err := a.AddKey(keyPair); err != nil {
+		t.Errorf("AddKey with restriction on loaded key failed: %v", err)
+	}
+}
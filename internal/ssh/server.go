@@ -0,0 +1,388 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Errors returned by KeyStore
+var (
+	ErrAgentLocked  = errors.New("agent is locked")
+	ErrKeyNotFound  = errors.New("key not found")
+	ErrAddForbidden = errors.New("keys cannot be added to the sm-ssh-add agent, add paths to its configuration instead")
+)
+
+// PassphraseFunc returns the passphrase for the encrypted key stored at path
+type PassphraseFunc func(path string, keyValue *sm.KeyValue) ([]byte, error)
+
+// storedKey is a key advertised by KeyStore. The signer is only set while the private key is cached.
+type storedKey struct {
+	path      string
+	previous  bool // the previous key of a rotation, served until its grace period expires
+	comment   string
+	publicKey ssh.PublicKey
+
+	fetchMu sync.Mutex // serialises fetching the private key (which may prompt for a passphrase)
+	signer  ssh.Signer
+	expires time.Time
+	evict   *time.Timer
+}
+
+// KeyStore is an ssh-agent backed by a secret manager. It advertises the public keys of the
+// configured paths and only fetches a private key from the provider when it is used to sign,
+// caching it for the configured TTL.
+type KeyStore struct {
+	provider   sm.Provider
+	ttl        time.Duration
+	passphrase PassphraseFunc
+	now        func() time.Time
+
+	mu             sync.Mutex
+	keys           []*storedKey
+	locked         bool
+	lockPassphrase []byte
+	lastUsed       time.Time // last signature request or unlock, for locking an idle agent
+}
+
+// NewKeyStore creates a KeyStore for the given paths. Only the published public keys are read up
+// front; private keys are not read until a signature is requested. A ttl of zero disables caching.
+func NewKeyStore(provider sm.Provider, paths []string, ttl time.Duration, passphrase PassphraseFunc) (*KeyStore, error) {
+	reader, ok := provider.(sm.PublicKeyReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: reading published public keys", sm.ErrNotSupported)
+	}
+
+	store := &KeyStore{
+		provider:   provider,
+		ttl:        ttl,
+		passphrase: passphrase,
+		now:        time.Now,
+	}
+	store.lastUsed = store.now()
+
+	for _, path := range paths {
+		keys, err := reader.GetPublicKey(path)
+		if errors.Is(err, sm.ErrPublicKeyNotPublished) {
+			return nil, fmt.Errorf("public key of %s is not published (run: sm-ssh-add pubkey --publish %s)", path, path)
+		}
+		if err != nil {
+			return nil, wrapError(err, fmt.Sprintf("failed to read public key from %s", path))
+		}
+
+		publicKey, comment, _, _, err := ssh.ParseAuthorizedKey(keys.PublicKey)
+		if err != nil {
+			return nil, wrapError(err, fmt.Sprintf("failed to parse public key from %s", path))
+		}
+
+		store.keys = append(store.keys, &storedKey{
+			path:      path,
+			comment:   ManagedComment(comment, path),
+			publicKey: publicKey,
+		})
+
+		if keys.PreviousActive(store.now()) {
+			publicKey, comment, _, _, err := ssh.ParseAuthorizedKey(keys.Previous)
+			if err != nil {
+				return nil, wrapError(err, fmt.Sprintf("failed to parse previous public key from %s", path))
+			}
+
+			store.keys = append(store.keys, &storedKey{
+				path:      path,
+				previous:  true,
+				comment:   ManagedComment(comment, path),
+				publicKey: publicKey,
+			})
+		}
+	}
+
+	return store, nil
+}
+
+// findKey returns the stored key matching the public key
+func (s *KeyStore) findKey(key ssh.PublicKey) (*storedKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked {
+		return nil, ErrAgentLocked
+	}
+
+	s.lastUsed = s.now()
+	wanted := key.Marshal()
+	for _, k := range s.keys {
+		if bytes.Equal(k.publicKey.Marshal(), wanted) {
+			return k, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// LastUsed returns when a signature was last requested or the agent was last unlocked
+func (s *KeyStore) LastUsed() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastUsed
+}
+
+// signer returns the cached signer of the key, fetching the private key from the provider if needed
+func (s *KeyStore) signer(k *storedKey) (ssh.Signer, error) {
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+
+	if k.signer != nil && s.now().Before(k.expires) {
+		return k.signer, nil
+	}
+	s.evictKey(k)
+
+	keyValue, err := s.provider.Get(k.path)
+	if err != nil {
+		return nil, wrapError(err, fmt.Sprintf("failed to fetch private key from %s", k.path))
+	}
+	defer clear(keyValue.PrivateKey)
+
+	if k.previous {
+		if !keyValue.PreviousActive(s.now()) {
+			return nil, fmt.Errorf("previous key at %s has expired", k.path)
+		}
+		keyValue = keyValue.Previous
+		defer clear(keyValue.PrivateKey)
+	}
+
+	var passphrase *string
+	if keyValue.RequirePassphrase {
+		if s.passphrase == nil {
+			return nil, fmt.Errorf("key at %s requires a passphrase", k.path)
+		}
+		p, err := s.passphrase(k.path, keyValue)
+		if err != nil {
+			return nil, wrapError(err, "failed to read passphrase")
+		}
+		pass := string(p)
+		passphrase = &pass
+	}
+
+	privateKey, err := parsePrivateKey(keyValue.PrivateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, wrapError(err, "failed to create signer from private key")
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), k.publicKey.Marshal()) {
+		return nil, fmt.Errorf("private key at %s does not match its advertised public key", k.path)
+	}
+
+	if s.ttl > 0 {
+		k.signer = signer
+		k.expires = s.now().Add(s.ttl)
+		var timer *time.Timer
+		timer = time.AfterFunc(s.ttl, func() {
+			k.fetchMu.Lock()
+			defer k.fetchMu.Unlock()
+			// Ignore timers of earlier fetches that fired while the key was being refetched
+			if k.evict == timer {
+				s.evictKey(k)
+			}
+		})
+		k.evict = timer
+	}
+
+	return signer, nil
+}
+
+// evictKey drops the cached private key. The caller must hold k.fetchMu.
+func (s *KeyStore) evictKey(k *storedKey) {
+	if k.evict != nil {
+		k.evict.Stop()
+		k.evict = nil
+	}
+	k.signer = nil
+}
+
+// evictAll drops every cached private key
+func (s *KeyStore) evictAll(keys []*storedKey) {
+	for _, k := range keys {
+		k.fetchMu.Lock()
+		s.evictKey(k)
+		k.fetchMu.Unlock()
+	}
+}
+
+// List returns the public keys of the configured paths
+func (s *KeyStore) List() ([]*agent.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked {
+		// Like ssh-agent, a locked agent reports no keys
+		return nil, nil
+	}
+
+	keys := make([]*agent.Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, &agent.Key{
+			Format:  k.publicKey.Type(),
+			Blob:    k.publicKey.Marshal(),
+			Comment: k.comment,
+		})
+	}
+	return keys, nil
+}
+
+// Sign signs data with the given key, fetching the private key on first use
+func (s *KeyStore) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return s.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags signs data with the given key using the algorithm selected by flags
+func (s *KeyStore) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	k, err := s.findKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := s.signer(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags == 0 {
+		return signer.Sign(rand.Reader, data)
+	}
+
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("key at %s does not support signature flags", k.path)
+	}
+	switch flags {
+	case agent.SignatureFlagRsaSha256:
+		return algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA256)
+	case agent.SignatureFlagRsaSha512:
+		return algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	default:
+		return nil, fmt.Errorf("unsupported signature flags: %d", flags)
+	}
+}
+
+// storeSigner signs through the KeyStore so the private key is only fetched when used
+type storeSigner struct {
+	store *KeyStore
+	key   *storedKey
+}
+
+func (s storeSigner) PublicKey() ssh.PublicKey {
+	return s.key.publicKey
+}
+
+func (s storeSigner) Sign(_ io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.store.Sign(s.key.publicKey, data)
+}
+
+// Signers returns signers for all keys. Private keys are fetched when a signer is used.
+func (s *KeyStore) Signers() ([]ssh.Signer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked {
+		return nil, ErrAgentLocked
+	}
+
+	signers := make([]ssh.Signer, 0, len(s.keys))
+	for _, k := range s.keys {
+		signers = append(signers, storeSigner{store: s, key: k})
+	}
+	return signers, nil
+}
+
+// Add is not supported: the keys served are defined by the configured paths
+func (s *KeyStore) Add(key agent.AddedKey) error {
+	return ErrAddForbidden
+}
+
+// Remove stops serving the given key until the agent is restarted
+func (s *KeyStore) Remove(key ssh.PublicKey) error {
+	s.mu.Lock()
+	if s.locked {
+		s.mu.Unlock()
+		return ErrAgentLocked
+	}
+
+	wanted := key.Marshal()
+	for i, k := range s.keys {
+		if bytes.Equal(k.publicKey.Marshal(), wanted) {
+			// Copy so snapshots taken by RemoveAll and Lock are not modified
+			s.keys = slices.Delete(slices.Clone(s.keys), i, i+1)
+			s.mu.Unlock()
+			s.evictAll([]*storedKey{k})
+			return nil
+		}
+	}
+	s.mu.Unlock()
+	return ErrKeyNotFound
+}
+
+// RemoveAll stops serving all keys until the agent is restarted
+func (s *KeyStore) RemoveAll() error {
+	s.mu.Lock()
+	if s.locked {
+		s.mu.Unlock()
+		return ErrAgentLocked
+	}
+	keys := s.keys
+	s.keys = nil
+	s.mu.Unlock()
+
+	s.evictAll(keys)
+	return nil
+}
+
+// Lock locks the agent with a passphrase and drops all cached private keys
+func (s *KeyStore) Lock(passphrase []byte) error {
+	s.mu.Lock()
+	if s.locked {
+		s.mu.Unlock()
+		return ErrAgentLocked
+	}
+	s.locked = true
+	s.lockPassphrase = bytes.Clone(passphrase)
+	keys := s.keys
+	s.mu.Unlock()
+
+	s.evictAll(keys)
+	return nil
+}
+
+// Unlock unlocks the agent if the passphrase matches the one it was locked with
+func (s *KeyStore) Unlock(passphrase []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.locked {
+		return errors.New("agent is not locked")
+	}
+	if subtle.ConstantTimeCompare(passphrase, s.lockPassphrase) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+	s.locked = false
+	clear(s.lockPassphrase)
+	s.lockPassphrase = nil
+	s.lastUsed = s.now()
+	return nil
+}
+
+// Extension reports that no agent extensions are supported
+func (s *KeyStore) Extension(extensionType string, contents []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
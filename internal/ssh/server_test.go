@@ -0,0 +1,494 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codeignus/sm-ssh-add/internal/sm"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// countingProvider serves generated keys from memory and counts reads of private keys per path
+type countingProvider struct {
+	mu    sync.Mutex
+	keys  map[string]*KeyPair
+	reads map[string]int
+
+	// previous keys of rotated paths, kept until previousExpires
+	previous        map[string]*KeyPair
+	previousExpires time.Time
+}
+
+func newCountingProvider(t *testing.T, paths ...string) *countingProvider {
+	t.Helper()
+	p := &countingProvider{keys: map[string]*KeyPair{}, reads: map[string]int{}}
+	for _, path := range paths {
+		keyPair, err := GenerateKeyPair(path+"@test", nil)
+		if err != nil {
+			t.Fatalf("GenerateKeyPair failed: %v", err)
+		}
+		p.keys[path] = keyPair
+	}
+	return p
+}
+
+func (p *countingProvider) Get(path string) (*sm.KeyValue, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reads[path]++
+	keyPair, ok := p.keys[path]
+	if !ok {
+		return nil, sm.ErrPathNotFound
+	}
+	// Return copies, the store clears private keys after use
+	kv := &sm.KeyValue{
+		PrivateKey: append([]byte(nil), keyPair.PrivateKey...),
+		PublicKey:  append([]byte(nil), keyPair.PublicKey...),
+		Comment:    keyPair.Comment,
+	}
+	if previous, ok := p.previous[path]; ok {
+		kv.Previous = &sm.KeyValue{
+			PrivateKey: append([]byte(nil), previous.PrivateKey...),
+			PublicKey:  append([]byte(nil), previous.PublicKey...),
+			Comment:    previous.Comment,
+		}
+		kv.PreviousExpires = p.previousExpires
+	}
+	return kv, nil
+}
+
+// GetPublicKey serves the public keys as if published, without counting a read
+func (p *countingProvider) GetPublicKey(path string) (*sm.PublicKeys, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keyPair, ok := p.keys[path]
+	if !ok {
+		return nil, sm.ErrPathNotFound
+	}
+	publicKey, err := AuthorizedKey(keyPair.PublicKey, keyPair.Comment)
+	if err != nil {
+		return nil, err
+	}
+	keys := &sm.PublicKeys{PublicKey: publicKey}
+	if previous, ok := p.previous[path]; ok {
+		if keys.Previous, err = AuthorizedKey(previous.PublicKey, previous.Comment); err != nil {
+			return nil, err
+		}
+		keys.PreviousExpires = p.previousExpires
+	}
+	return keys, nil
+}
+
+func (p *countingProvider) Store(path string, kv *sm.KeyValue) error {
+	return errors.New("not implemented")
+}
+
+func (p *countingProvider) CheckExists(path string) (bool, error) {
+	_, ok := p.keys[path]
+	return ok, nil
+}
+
+func (p *countingProvider) readCount(path string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reads[path]
+}
+
+// serveKeyStore returns an agent client connected to the store over an in-process connection
+func serveKeyStore(t *testing.T, store *KeyStore) agent.ExtendedAgent {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		_ = agent.ServeAgent(store, serverConn)
+	}()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	return agent.NewClient(clientConn)
+}
+
+func TestKeyStore_FetchesPrivateKeyOnFirstSign(t *testing.T) {
+	provider := newCountingProvider(t, "secret/ssh/a", "secret/ssh/b")
+	store, err := NewKeyStore(provider, []string{"secret/ssh/a", "secret/ssh/b"}, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewKeyStore failed: %v", err)
+	}
+	client := serveKeyStore(t, store)
+
+	keys, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+	if path, ok := ManagedPath(keys[0].Comment); !ok || path != "secret/ssh/a" {
+		t.Errorf("key comment %q should carry its path", keys[0].Comment)
+	}
+
+	// Listing only used the published public keys
+	if n := provider.readCount("secret/ssh/a"); n != 0 {
+		t.Errorf("reads before sign = %d, want 0", n)
+	}
+
+	data := []byte("data to sign")
+	sig, err := client.Sign(keys[0], data)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := keys[0].Verify(data, sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if n := provider.readCount("secret/ssh/a"); n != 1 {
+		t.Errorf("reads after first sign = %d, want 1", n)
+	}
+
+	// Cached for the TTL
+	if _, err := client.Sign(keys[0], data); err != nil {
+		t.Fatalf("second Sign failed: %v", err)
+	}
+	if n := provider.readCount("secret/ssh/a"); n != 1 {
+		t.Errorf("reads after cached sign = %d, want 1", n)
+	}
+
+	// Other keys are still untouched
+	if n := provider.readCount("secret/ssh/b"); n != 0 {
+		t.Errorf("reads of unused key = %d, want 0", n)
+	}
+}
+
+func TestKeyStore_RefetchesAfterTTL(t *testing.T) {
+	provider := newCountingProvider(t, "secret/ssh/a")
+	store, err := NewKeyStore(provider, []string{"secret/ssh/a"}, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewKeyStore failed: %v", err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	client := serveKeyStore(t, store)
+
+	keys, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if _, err := client.Sign(keys[0], []byte("data")); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := client.Sign(keys[0], []byte("data")); err != nil {
+		t.Fatalf("Sign after TTL failed: %v", err)
+	}
+	if n := provider.readCount("secret/ssh/a"); n != 2 {
+		t.Errorf("reads after TTL expiry = %d, want 2", n)
+	}
+}
+
+func TestKeyStore_ServesPreviousKeyDuringGracePeriod(t *testing.T) {
+	provider := newCountingProvider(t, "secret/ssh/a")
+	previous, err := GenerateKeyPair("old@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	now := time.Now()
+	provider.previous = map[string]*KeyPair{"secret/ssh/a": previous}
+	provider.previousExpires = now.Add(time.Hour)
+
+	store, err := NewKeyStore(provider, []string{"secret/ssh/a"}, 0, nil)
+	if err != nil {
+		t.Fatalf("NewKeyStore failed: %v", err)
+	}
+	store.now = func() time.Time { return now }
+	client := serveKeyStore(t, store)
+
+	keys, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected current and previous key, got %d keys", len(keys))
+	}
+	if path, ok := ManagedPath(keys[1].Comment); !ok || path != "secret/ssh/a" {
+		t.Errorf("previous key comment %q should carry its path", keys[1].Comment)
+	}
+
+	data := []byte("data to sign")
+	sig, err := client.Sign(keys[1], data)
+	if err != nil {
+		t.Fatalf("Sign with previous key failed: %v", err)
+	}
+	if err := keys[1].Verify(data, sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	// After the grace period the previous key no longer signs
+	now = now.Add(2 * time.Hour)
+	if _, err := client.Sign(keys[1], data); err == nil {
+		t.Error("expected Sign with expired previous key to fail")
+	}
+	if _, err := client.Sign(keys[0], data); err != nil {
+		t.Errorf("Sign with current key failed: %v", err)
+	}
+}
+
+func TestKeyStore_LockUnlock(t *testing.T) {
+	provider := newCountingProvider(t, "secret/ssh/a")
+	store, err := NewKeyStore(provider, []string{"secret/ssh/a"}, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewKeyStore failed: %v", err)
+	}
+	client := serveKeyStore(t, store)
+
+	keys, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if _, err := client.Sign(keys[0], []byte("data")); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	if err := client.Lock([]byte("secret")); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if locked, _ := client.List(); len(locked) != 0 {
+		t.Errorf("locked agent listed %d keys, want 0", len(locked))
+	}
+	if _, err := client.Sign(keys[0], []byte("data")); err == nil {
+		t.Error("Sign on locked agent should fail")
+	}
+	if err := client.Unlock([]byte("wrong")); err == nil {
+		t.Error("Unlock with wrong passphrase should fail")
+	}
+	if err := client.Unlock([]byte("secret")); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	// Locking dropped the cached key, so it is fetched again
+	if _, err := client.Sign(keys[0], []byte("data")); err != nil {
+		t.Fatalf("Sign after unlock failed: %v", err)
+	}
+	if n := provider.readCount("secret/ssh/a"); n != 2 {
+		t.Errorf("reads after unlock = %d, want 2", n)
+	}
+}
+
+func TestKeyStore_AddAndRemove(t *testing.T) {
+	provider := newCountingProvider(t, "secret/ssh/a", "secret/ssh/b")
+	store, err := NewKeyStore(provider, []string{"secret/ssh/a", "secret/ssh/b"}, 0, nil)
+	if err != nil {
+		t.Fatalf("NewKeyStore failed: %v", err)
+	}
+	client := serveKeyStore(t, store)
+
+	other, err := GenerateKeyPair("other@test", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	privateKey, err := ssh.ParseRawPrivateKey(other.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+	if err := client.Add(agent.AddedKey{PrivateKey: privateKey}); err == nil {
+		t.Error("Add should be rejected")
+	}
+
+	keys, err := client.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if err := client.Remove(keys[0]); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if keys, _ = client.List(); len(keys) != 1 {
+		t.Errorf("expected 1 key after Remove, got %d", len(keys))
+	}
+	if err := client.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if keys, _ = client.List(); len(keys) != 0 {
+		t.Errorf("expected no keys after RemoveAll, got %d", len(keys))
+	}
+}
+
+func TestNewKeyStore_MissingPath(t *testing.T) {
+	provider := newCountingProvider(t)
+	if _, err := NewKeyStore(provider, []string{"secret/ssh/missing"}, time.Minute, nil); err == nil {
+		t.Error("expected error for missing path, got nil")
+	}
+}
+
+// unpublishedProvider has keys whose public keys were never published
+type unpublishedProvider struct {
+	*countingProvider
+}
+
+func (p unpublishedProvider) GetPublicKey(path string) (*sm.PublicKeys, error) {
+	return nil, sm.ErrPublicKeyNotPublished
+}
+
+func TestNewKeyStore_UnpublishedKey(t *testing.T) {
+	provider := unpublishedProvider{newCountingProvider(t, "secret/ssh/a")}
+	_, err := NewKeyStore(provider, []string{"secret/ssh/a"}, time.Minute, nil)
+	if err == nil || !strings.Contains(err.Error(), "pubkey --publish secret/ssh/a") {
+		t.Errorf("NewKeyStore() error = %v, want a hint to publish the key", err)
+	}
+	if n := provider.readCount("secret/ssh/a"); n != 0 {
+		t.Errorf("reads of unpublished key = %d, want 0", n)
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	provider := newCountingProvider(t, "secret/ssh/a")
+	store, err := NewKeyStore(provider, []string{"secret/ssh/a"}, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewKeyStore failed: %v", err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ListenAndServe(ctx, socketPath, store)
+	}()
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("unix", socketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to connect to agent socket: %v", err)
+	}
+	keys, err := agent.NewClient(conn).List()
+	conn.Close()
+	if err != nil {
+		t.Fatalf("List over socket failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("expected 1 key over socket, got %d", len(keys))
+	}
+	if info, err := os.Stat(socketPath); err != nil {
+		t.Errorf("failed to stat socket: %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ListenAndServe returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe did not stop after cancel")
+	}
+}
+
+func TestListenAndServe_SocketInUse(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- ListenAndServe(ctx, socketPath, agent.NewKeyring())
+	}()
+
+	var err error
+	for i := 0; i < 50; i++ {
+		var conn net.Conn
+		if conn, err = net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to connect to agent socket: %v", err)
+	}
+
+	// A second agent on the same path must not take the socket of the first
+	err = ListenAndServe(ctx, socketPath, agent.NewKeyring())
+	if err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("second ListenAndServe error = %v, want already in use", err)
+	}
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("first agent is no longer reachable: %v", err)
+	}
+	if _, err := agent.NewClient(conn).List(); err != nil {
+		t.Errorf("List from first agent failed: %v", err)
+	}
+	conn.Close()
+
+	cancel()
+	<-done
+
+	// A socket left behind by an agent that exited is replaced
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		t.Fatalf("failed to create socket: %v", err)
+	}
+	listener.SetUnlinkOnClose(false)
+	listener.Close()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		done <- ListenAndServe(ctx, socketPath, agent.NewKeyring())
+	}()
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("stale socket was not replaced: %v", err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("ListenAndServe over a stale socket error = %v", err)
+	}
+}
+
+func TestDefaultSocketPath(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	socketPath, cleanup, err := DefaultSocketPath("test-agent")
+	if err != nil {
+		t.Fatalf("DefaultSocketPath failed: %v", err)
+	}
+	cleanup()
+	if filepath.Dir(socketPath) != runtimeDir {
+		t.Errorf("socket path = %s, want one in %s", socketPath, runtimeDir)
+	}
+
+	// Without a runtime directory the socket gets a private directory of its own
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	t.Setenv("TMPDIR", t.TempDir())
+	socketPath, cleanup, err = DefaultSocketPath("test-agent")
+	if err != nil {
+		t.Fatalf("DefaultSocketPath failed: %v", err)
+	}
+	dir := filepath.Dir(socketPath)
+	if info, err := os.Stat(dir); err != nil {
+		t.Errorf("failed to stat socket directory: %v", err)
+	} else if info.Mode().Perm() != 0700 {
+		t.Errorf("socket directory mode = %v, want 0700", info.Mode().Perm())
+	}
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cleanup left %s behind: %v", dir, err)
+	}
+}
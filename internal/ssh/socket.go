@@ -0,0 +1,94 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// DefaultSocketPath returns the socket path used when none is given: a file named after the
+// given name in $XDG_RUNTIME_DIR, which only its owner can access. Without it the socket is put
+// in a new private directory in the temp directory, which cleanup removes; a predictable path
+// there could be taken over by another user.
+func DefaultSocketPath(name string) (socketPath string, cleanup func(), err error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, fmt.Sprintf("%s-%d.sock", name, os.Getuid())), func() {}, nil
+	}
+
+	// MkdirTemp creates the directory with mode 0700
+	dir, err := os.MkdirTemp("", name+"-")
+	if err != nil {
+		return "", nil, wrapError(err, "failed to create socket directory")
+	}
+	return filepath.Join(dir, "agent.sock"), func() { os.RemoveAll(dir) }, nil
+}
+
+// ListenAndServe serves the agent on a unix socket at socketPath until ctx is cancelled.
+// A stale socket left at the path is replaced; a socket another agent listens on, or any other
+// existing file, is an error.
+func ListenAndServe(ctx context.Context, socketPath string, a agent.Agent) error {
+	return ListenAndServeConns(ctx, socketPath, func(conn io.ReadWriter) error {
+		return agent.ServeAgent(a, conn)
+	})
+}
+
+// ListenAndServeConns is like ListenAndServe, but calls serve for every client connection, which
+// is closed when serve returns
+func ListenAndServeConns(ctx context.Context, socketPath string, serve func(conn io.ReadWriter) error) error {
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", socketPath)
+		}
+		// Only replace a socket nobody listens on, not that of another running agent
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil {
+			conn.Close()
+			return fmt.Errorf("%s is already in use by another agent", socketPath)
+		}
+		if !isConnRefused(err) {
+			return wrapError(err, "failed to check existing socket")
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return wrapError(err, "failed to remove stale socket")
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return wrapError(err, "failed to listen on socket")
+	}
+	// Closing the listener also removes the socket file
+	defer listener.Close()
+
+	// Only the owner may use the agent. Nobody else can connect before the mode is set, since the
+	// default socket directories are private to the user.
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return wrapError(err, "failed to set socket permissions")
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return wrapError(err, "failed to accept connection")
+		}
+
+		go func() {
+			defer conn.Close()
+			_ = serve(conn)
+		}()
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnRefused reports whether err means nothing is listening on a socket
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
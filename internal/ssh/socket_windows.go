@@ -0,0 +1,14 @@
+//go:build windows
+
+package ssh
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isConnRefused reports whether err means nothing is listening on a socket
+func isConnRefused(err error) bool {
+	return errors.Is(err, windows.WSAECONNREFUSED)
+}
@@ -0,0 +1,59 @@
+package ssh
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Errors returned by VerifyKeyPair
+var (
+	ErrPublicKeyMismatch    = errors.New("stored public key does not match the private key")
+	ErrUnexpectedPassphrase = errors.New("require_passphrase is set but the private key is not encrypted")
+	ErrMissingPassphrase    = errors.New("private key is encrypted but require_passphrase is not set")
+)
+
+// VerifyKeyPair checks that publicKey, in authorized_keys format, belongs to privateKey and that the
+// private key is encrypted exactly when requirePassphrase is set. The public key is taken from the
+// clear part of encrypted OpenSSH keys; other encrypted keys are decrypted with passphrase, and
+// ErrPassphraseRequired is returned if it is nil.
+func VerifyKeyPair(privateKey, publicKey []byte, requirePassphrase bool, passphrase []byte) error {
+	stored, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return wrapError(err, "failed to parse stored public key")
+	}
+
+	var derived ssh.PublicKey
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case err == nil:
+		if requirePassphrase {
+			return ErrUnexpectedPassphrase
+		}
+		derived = signer.PublicKey()
+	case errors.As(err, &missing):
+		if !requirePassphrase {
+			return ErrMissingPassphrase
+		}
+		derived = missing.PublicKey
+	default:
+		return wrapError(err, "failed to parse private key")
+	}
+
+	if derived == nil {
+		if passphrase == nil {
+			return ErrPassphraseRequired
+		}
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(privateKey, passphrase)
+		if err != nil {
+			return wrapError(err, "failed to parse private key with passphrase")
+		}
+		derived = signer.PublicKey()
+	}
+
+	if ssh.FingerprintSHA256(derived) != ssh.FingerprintSHA256(stored) {
+		return ErrPublicKeyMismatch
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// TestVerifyKeyPair tests detecting mismatched public keys and require_passphrase flags
+func TestVerifyKeyPair(t *testing.T) {
+	plain, err := GenerateKeyPair("", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	encrypted, err := GenerateKeyPair("", []byte("secret"))
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	other, err := GenerateKeyPair("", nil)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	// Encrypted PEM keys do not store the public key in the clear
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	// Legacy PEM encryption, as produced by older versions of ssh-keygen
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), []byte("secret"), x509.PEMCipherAES128)
+	if err != nil {
+		t.Fatalf("failed to encrypt pem block: %v", err)
+	}
+	rsaPublic, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to convert public key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(block)
+	pemPublic := ssh.MarshalAuthorizedKey(rsaPublic)
+
+	tests := []struct {
+		name              string
+		privateKey        []byte
+		publicKey         []byte
+		requirePassphrase bool
+		passphrase        []byte
+		wantErr           error
+	}{
+		{name: "matching", privateKey: plain.PrivateKey, publicKey: plain.PublicKey},
+		{name: "matching encrypted", privateKey: encrypted.PrivateKey, publicKey: encrypted.PublicKey, requirePassphrase: true},
+		{name: "mismatch", privateKey: plain.PrivateKey, publicKey: other.PublicKey, wantErr: ErrPublicKeyMismatch},
+		{name: "mismatch encrypted", privateKey: encrypted.PrivateKey, publicKey: other.PublicKey, requirePassphrase: true, wantErr: ErrPublicKeyMismatch},
+		{name: "unexpected passphrase", privateKey: plain.PrivateKey, publicKey: plain.PublicKey, requirePassphrase: true, wantErr: ErrUnexpectedPassphrase},
+		{name: "missing passphrase", privateKey: encrypted.PrivateKey, publicKey: encrypted.PublicKey, wantErr: ErrMissingPassphrase},
+		{name: "pem without passphrase", privateKey: pemKey, publicKey: pemPublic, requirePassphrase: true, wantErr: ErrPassphraseRequired},
+		{name: "pem with passphrase", privateKey: pemKey, publicKey: pemPublic, requirePassphrase: true, passphrase: []byte("secret")},
+		{name: "pem mismatch", privateKey: pemKey, publicKey: other.PublicKey, requirePassphrase: true, passphrase: []byte("secret"), wantErr: ErrPublicKeyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyKeyPair(tt.privateKey, tt.publicKey, tt.requirePassphrase, tt.passphrase)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyKeyPair() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := VerifyKeyPair([]byte("not a key"), plain.PublicKey, false, nil); err == nil {
+		t.Error("expected error for unparsable private key, got nil")
+	}
+	if err := VerifyKeyPair(plain.PrivateKey, []byte("not a key"), false, nil); err == nil {
+		t.Error("expected error for unparsable public key, got nil")
+	}
+}
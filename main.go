@@ -1,35 +1,106 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/codeignus/sm-ssh-add/cmd"
 	"github.com/codeignus/sm-ssh-add/internal/config"
+	"github.com/codeignus/sm-ssh-add/internal/prompt"
 	"github.com/codeignus/sm-ssh-add/internal/sm"
 )
 
+// usage is printed for a missing or unknown command
+const usage = "usage: sm-ssh-add [--config <file>] [--profile <name>] <generate|rotate|stale|import|export|passwd|pubkey|list|verify|load|unload|lock|unlock|agent|proxy|doctor|init|config> [args]\n"
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: sm-ssh-add <generate|load> [args]\n")
+	args := os.Args[1:]
+
+	// Global flags come before the command
+	globalFlags := map[string]*string{"--config": &config.ExplicitPath, "--profile": &config.SelectedProfile}
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		target, ok := globalFlags[name]
+		switch {
+		case ok && hasValue:
+			*target, args = value, args[1:]
+		case ok && len(args) > 1:
+			*target, args = args[1], args[2:]
+		default:
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(1)
+		}
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
 		os.Exit(1)
 	}
+	command, args := args[0], args[1:]
+
+	// Commands that work without a valid config file
+	switch command {
+	case "doctor":
+		if err := cmd.Doctor(args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "init":
+		if err := cmd.Init(args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "config":
+		if err := cmd.Config(args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	cfg, err := config.Read()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	if errors.Is(err, config.ErrConfigFileNotFound) {
+		fmt.Fprintf(os.Stderr, "error: %v\nRun sm-ssh-add init to create it\n", err)
 		os.Exit(1)
 	}
-
-	// Initialize provider once (single authentication)
-	provider, err := sm.InitProvider(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	prompt.Pinentry = cfg.Pinentry
+
+	// Commands that only talk to ssh-agent don't need the secret manager
+	switch command {
+	case "lock":
+		if err := cmd.Lock(cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "unlock":
+		if err := cmd.Unlock(cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Loading from every profile needs a provider per profile
+	if command == "load" && slices.Contains(args, "--all-profiles") {
+		if err := cmd.LoadAllProfiles(cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	command := os.Args[1]
-	args := os.Args[2:]
+	// Providers are initialized once, when the first of their paths is used (single authentication)
+	provider := sm.NewRegistry(cfg)
 
 	switch command {
 	case "generate":
@@ -37,13 +108,68 @@ func main() {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+	case "rotate":
+		if err := cmd.Rotate(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "stale":
+		if err := cmd.Stale(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "import":
+		if err := cmd.Import(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "export":
+		if err := cmd.Export(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "passwd":
+		if err := cmd.Passwd(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "pubkey":
+		if err := cmd.Pubkey(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "list":
+		if err := cmd.List(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "verify":
+		if err := cmd.Verify(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
 	case "load":
 		if err := cmd.Load(provider, cfg, args); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+	case "unload":
+		if err := cmd.Unload(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "agent":
+		if err := cmd.ServeAgent(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	case "proxy":
+		if err := cmd.Proxy(provider, cfg, args); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
 	default:
-		fmt.Fprintf(os.Stderr, "usage: sm-ssh-add <generate|load> [args]\n")
+		fmt.Fprint(os.Stderr, usage)
 		os.Exit(1)
 	}
 }